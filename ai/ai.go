@@ -0,0 +1,370 @@
+// Package ai implements a computer opponent on top of shared.Power, using a
+// negamax search with alpha-beta pruning and a heuristic evaluation, and an
+// exact solver for the classic 6x7 board.
+package ai
+
+import (
+	"errors"
+	"math/rand/v2"
+	"slices"
+	"strings"
+	"time"
+
+	"power4/shared"
+)
+
+type Difficulty int
+
+const (
+	EASY Difficulty = iota
+	MEDIUM
+	HARD
+)
+
+// ErrNoMove is returned when the game is over or every column is full
+var ErrNoMove = errors.New("ai: no legal move")
+
+// ErrTooManyPlayers is returned for games of more than two players, which
+// the two-sided search cannot play
+var ErrTooManyPlayers = errors.New("ai: only two-player games are supported")
+
+// level tunes the search for a difficulty
+type level struct {
+	depth      int           // Maximum search depth in plies
+	randomness float64       // Probability of playing a random legal move
+	budget     time.Duration // Time limit for iterative deepening, zero for none
+}
+
+var levels = map[Difficulty]level{
+	EASY:   {depth: 2, randomness: 0.3},
+	MEDIUM: {depth: 4},
+	HARD:   {depth: 10, budget: 1500 * time.Millisecond},
+}
+
+// solverBudget is how long HARD tries to solve a classic position exactly
+// before falling back to the heuristic search
+const solverBudget = time.Second
+
+// Scores used by the evaluation, from the point of view of the player to move
+const (
+	winScore    = 1_000_000
+	centerBonus = 3
+)
+
+// BestMove picks the column the current player should play. The game itself
+// is not modified: the search runs on a clone.
+func BestMove(p *shared.Power, difficulty Difficulty) (shared.Coordinate, error) {
+	game := p.Clone()
+	if game.Settings.Players > shared.MinPlayers {
+		return shared.Coordinate{}, ErrTooManyPlayers
+	}
+	moves := orderedMoves(game)
+	if game.State != shared.ONGOING || len(moves) == 0 {
+		return shared.Coordinate{}, ErrNoMove
+	}
+
+	lvl, ok := levels[difficulty]
+	if !ok {
+		lvl = levels[MEDIUM]
+	}
+
+	if lvl.randomness > 0 && rand.Float64() < lvl.randomness {
+		return moves[rand.IntN(len(moves))], nil
+	}
+
+	// On the classic board, HARD plays perfectly whenever the solver is
+	// free and finishes in time; games asking while another one holds it
+	// fall back to the search rather than queue
+	if difficulty == HARD && Solvable(game) {
+		if move, err := DefaultSolver().TryBestMove(game, solverBudget); err == nil {
+			return move, nil
+		}
+	}
+
+	s := &searcher{}
+	if lvl.budget > 0 {
+		s.deadline = time.Now().Add(lvl.budget)
+	}
+
+	// Iterative deepening: keep the result of the deepest completed search
+	// and try its move first at the next depth
+	best := moves[0]
+	for depth := 1; depth <= lvl.depth; depth++ {
+		move, score, completed := s.root(game, moves, depth)
+		if !completed {
+			break
+		}
+		best = move
+		moves = moveToFront(moves, move)
+		if score >= winScore-depth || score <= -winScore+depth {
+			// The outcome is decided, searching deeper changes nothing
+			break
+		}
+	}
+	return best, nil
+}
+
+// ParseDifficulty converts a form value such as "hard" into a Difficulty
+func ParseDifficulty(value string) (Difficulty, bool) {
+	switch strings.ToLower(value) {
+	case "easy":
+		return EASY, true
+	case "medium":
+		return MEDIUM, true
+	case "hard":
+		return HARD, true
+	default:
+		return 0, false
+	}
+}
+
+// String returns a string representation of the difficulty
+func (d Difficulty) String() string {
+	switch d {
+	case EASY:
+		return "Easy"
+	case MEDIUM:
+		return "Medium"
+	case HARD:
+		return "Hard"
+	default:
+		return "Unknown"
+	}
+}
+
+// searcher runs a negamax search and stops when its deadline passes
+type searcher struct {
+	deadline time.Time
+	nodes    int
+	timedOut bool
+}
+
+// root searches every move at the given depth and returns the best one. The
+// result is only usable when completed is true.
+func (s *searcher) root(game *shared.Power, moves []shared.Coordinate, depth int) (best shared.Coordinate, score int, completed bool) {
+	alpha, beta := -winScore-1, winScore+1
+	best = moves[0]
+	for _, move := range moves {
+		if _, err := game.MakeMove(move); err != nil {
+			continue
+		}
+		value := -s.negamax(game, depth-1, -beta, -alpha, 1)
+		game.Undo()
+
+		if s.timedOut {
+			return best, alpha, false
+		}
+		if value > alpha {
+			alpha = value
+			best = move
+		}
+	}
+	return best, alpha, true
+}
+
+// negamax returns the value of the position for the player to move
+func (s *searcher) negamax(game *shared.Power, depth, alpha, beta, ply int) int {
+	s.nodes++
+	if s.nodes%1024 == 0 && !s.deadline.IsZero() && time.Now().After(s.deadline) {
+		s.timedOut = true
+	}
+	if s.timedOut {
+		return 0
+	}
+
+	switch game.State {
+	case shared.DRAW:
+		return 0
+	case shared.WON:
+		// The previous move won, so the player to move has lost. Faster
+		// wins (and slower losses) are preferred.
+		return -winScore + ply
+	}
+
+	if depth == 0 {
+		return evaluate(game, game.IsPlaying)
+	}
+
+	for _, move := range orderedMoves(game) {
+		if _, err := game.MakeMove(move); err != nil {
+			continue
+		}
+		value := -s.negamax(game, depth-1, -beta, -alpha, ply+1)
+		game.Undo()
+
+		if value > alpha {
+			alpha = value
+		}
+		if alpha >= beta {
+			break
+		}
+	}
+	return alpha
+}
+
+// orderedMoves lists the playable columns (or rows, when pieces fall
+// sideways), closest to the center first, since central lanes take part in
+// the most lines
+func orderedMoves(game *shared.Power) []shared.Coordinate {
+	if game.Gravity == shared.NONE {
+		return freeMoves(game)
+	}
+
+	sideways := game.Gravity == shared.LEFT || game.Gravity == shared.RIGHT
+	lanes := game.Settings.Columns
+	if sideways {
+		lanes = game.Settings.Rows
+	}
+
+	moves := make([]shared.Coordinate, 0, lanes)
+	for i := 0; i < lanes; i++ {
+		// lanes/2, lanes/2-1, lanes/2+1, ...
+		offset := (i + 1) / 2
+		if i%2 == 1 {
+			offset = -offset
+		}
+		lane := lanes/2 + offset
+		if lane < 0 || lane >= lanes {
+			continue
+		}
+
+		move := shared.Coordinate{Column: lane}
+		if sideways {
+			move = shared.Coordinate{Row: lane}
+		}
+		if game.IsValidMove(move) {
+			moves = append(moves, move)
+		}
+	}
+	return moves
+}
+
+// freeMoves lists the empty cells next to a piece when pieces do not fall,
+// closest to the center first: far away cells would blow up the search
+// without taking part in any line. On an empty board only the center is
+// played.
+func freeMoves(game *shared.Power) []shared.Coordinate {
+	rows, cols := game.Settings.Rows, game.Settings.Columns
+	centerRow, centerCol := rows/2, cols/2
+
+	var moves []shared.Coordinate
+	for row := 0; row < rows; row++ {
+		for col := 0; col < cols; col++ {
+			if game.Board[row][col] == 0 && hasNeighbor(game, row, col) {
+				moves = append(moves, shared.Coordinate{Column: col, Row: row})
+			}
+		}
+	}
+	if len(moves) == 0 && game.Board[centerRow][centerCol] == 0 {
+		return []shared.Coordinate{{Column: centerCol, Row: centerRow}}
+	}
+
+	distance := func(move shared.Coordinate) int {
+		return max(abs(move.Row-centerRow), abs(move.Column-centerCol))
+	}
+	slices.SortStableFunc(moves, func(a, b shared.Coordinate) int {
+		return distance(a) - distance(b)
+	})
+	return moves
+}
+
+// hasNeighbor reports whether one of the eight cells around (row, col) holds
+// a piece
+func hasNeighbor(game *shared.Power, row, col int) bool {
+	for r := row - 1; r <= row+1; r++ {
+		for c := col - 1; c <= col+1; c++ {
+			if r < 0 || r >= game.Settings.Rows || c < 0 || c >= game.Settings.Columns {
+				continue
+			}
+			if game.Board[r][c] != 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+// moveToFront returns moves with move first, keeping the others in order
+func moveToFront(moves []shared.Coordinate, move shared.Coordinate) []shared.Coordinate {
+	ordered := make([]shared.Coordinate, 0, len(moves))
+	ordered = append(ordered, move)
+	for _, m := range moves {
+		if m != move {
+			ordered = append(ordered, m)
+		}
+	}
+	return ordered
+}
+
+// evaluate scores a position for player by looking at every window of
+// WinLength cells: windows only one side can still complete are worth more
+// the fuller they are. Windows through a blocker are worth nothing. On a
+// cylinder, windows wrap across the side edges.
+func evaluate(game *shared.Power, player shared.Player) int {
+	rows, cols := game.Settings.Rows, game.Settings.Columns
+	length := game.Settings.WinLength
+	mine, theirs := player.Piece(), game.NextPlayer(player).Piece()
+	wrap := game.Settings.Topology == shared.CYLINDER && length <= cols
+
+	score := 0
+	for row := 0; row < rows; row++ {
+		// Pieces in the central column take part in the most lines
+		switch game.Board[row][cols/2] {
+		case mine:
+			score += centerBonus
+		case theirs:
+			score -= centerBonus
+		}
+
+		for col := 0; col < cols; col++ {
+			for _, dir := range [4][2]int{{0, 1}, {1, 0}, {1, 1}, {1, -1}} {
+				endRow, endCol := row+dir[0]*(length-1), col+dir[1]*(length-1)
+				if endRow < 0 || endRow >= rows || (!wrap && (endCol < 0 || endCol >= cols)) {
+					continue
+				}
+
+				own, opponent, blocked := 0, 0, false
+				for i := 0; i < length; i++ {
+					switch game.Board[row+dir[0]*i][(col+dir[1]*i+cols)%cols] {
+					case mine:
+						own++
+					case theirs:
+						opponent++
+					case shared.Blocker:
+						blocked = true
+					}
+				}
+				switch {
+				case blocked:
+					// Nobody can complete a window through a blocker
+				case opponent == 0:
+					score += windowWeight(own, length)
+				case own == 0:
+					score -= windowWeight(opponent, length)
+				}
+			}
+		}
+	}
+	return score
+}
+
+// windowWeight values a window holding count pieces of a single player
+func windowWeight(count, length int) int {
+	switch {
+	case count == 0:
+		return 0
+	case count >= length-1:
+		return 50
+	case count == length-2:
+		return 5
+	default:
+		return 1
+	}
+}
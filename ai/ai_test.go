@@ -0,0 +1,103 @@
+package ai
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"power4/shared"
+)
+
+// playColumns starts a classic game and drops pieces in the given columns
+func playColumns(t *testing.T, columns ...int) *shared.Power {
+	t.Helper()
+
+	p := shared.NewGameInstance(shared.GameSettings{Rows: 6, Columns: 7})
+	for _, col := range columns {
+		if _, err := p.MakeMove(shared.Coordinate{Column: col}); err != nil {
+			t.Fatalf("move in column %d: %v", col, err)
+		}
+	}
+	return p
+}
+
+func TestBestMoveTakesWin(t *testing.T) {
+	// Blue has three in column 0 and red three in column 1: blue wins first
+	for _, difficulty := range []Difficulty{MEDIUM, HARD} {
+		p := playColumns(t, 0, 1, 0, 1, 0, 1)
+		move, err := BestMove(p, difficulty)
+		if err != nil || move.Column != 0 {
+			t.Errorf("%v: expected the win in column 0, got %+v, %v", difficulty, move, err)
+		}
+		if len(p.History()) != 6 {
+			t.Errorf("%v: BestMove changed the game", difficulty)
+		}
+	}
+}
+
+func TestBestMoveBlocksWin(t *testing.T) {
+	// Blue threatens to complete column 0 on its next move
+	for _, difficulty := range []Difficulty{MEDIUM, HARD} {
+		p := playColumns(t, 0, 1, 0, 1, 0)
+		move, err := BestMove(p, difficulty)
+		if err != nil || move.Column != 0 {
+			t.Errorf("%v: expected a block in column 0, got %+v, %v", difficulty, move, err)
+		}
+	}
+}
+
+func TestBestMoveHardBudget(t *testing.T) {
+	// Worst case: the solver gives up, then the search uses its own budget
+	limit := solverBudget + levels[HARD].budget + 500*time.Millisecond
+
+	for _, settings := range []shared.GameSettings{
+		{Rows: 6, Columns: 7},
+		{Rows: 12, Columns: 12},
+	} {
+		p := shared.NewGameInstance(settings)
+		p.MakeMove(shared.Coordinate{Column: 3})
+
+		start := time.Now()
+		if _, err := BestMove(p, HARD); err != nil {
+			t.Fatalf("%dx%d: %v", settings.Rows, settings.Columns, err)
+		}
+		if elapsed := time.Since(start); elapsed > limit {
+			t.Errorf("%dx%d: HARD took %v, want at most %v", settings.Rows, settings.Columns, elapsed, limit)
+		}
+	}
+}
+
+func TestBestMoveHardConcurrent(t *testing.T) {
+	// Games asking at the same time do not queue behind the shared solver
+	limit := solverBudget + levels[HARD].budget + 500*time.Millisecond
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			p := shared.NewGameInstance(shared.GameSettings{Rows: 6, Columns: 7})
+			p.MakeMove(shared.Coordinate{Column: 3})
+
+			start := time.Now()
+			if _, err := BestMove(p, HARD); err != nil {
+				t.Error(err)
+			}
+			if elapsed := time.Since(start); elapsed > limit {
+				t.Errorf("HARD took %v, want at most %v", elapsed, limit)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestBestMoveErrors(t *testing.T) {
+	if _, err := BestMove(playColumns(t, 0, 1, 0, 1, 0, 1, 0), MEDIUM); err != ErrNoMove {
+		t.Errorf("expected ErrNoMove once the game is won, got %v", err)
+	}
+
+	p := shared.NewGameInstance(shared.GameSettings{Rows: 6, Columns: 7, Players: 3})
+	if _, err := BestMove(p, MEDIUM); err != ErrTooManyPlayers {
+		t.Errorf("expected ErrTooManyPlayers, got %v", err)
+	}
+}
@@ -0,0 +1,568 @@
+package ai
+
+import (
+	"errors"
+	"math/bits"
+	"sort"
+	"sync"
+	"time"
+
+	"power4/shared"
+)
+
+// The solver only handles the classic board created by the base game
+const (
+	solverWidth  = 7
+	solverHeight = 6
+	solverCells  = solverWidth * solverHeight
+)
+
+// Errors returned by the solver
+var (
+	ErrUnsupportedPosition = errors.New("ai: solver only handles ongoing 6x7 Connect 4 positions")
+	ErrSolverTimeout       = errors.New("ai: solver ran out of time")
+	ErrSolverBusy          = errors.New("ai: solver is busy with another search")
+)
+
+type Outcome int
+
+const (
+	LOSS Outcome = iota - 1
+	DRAW
+	WIN
+)
+
+// String returns a string representation of the outcome
+func (o Outcome) String() string {
+	switch o {
+	case WIN:
+		return "Win"
+	case DRAW:
+		return "Draw"
+	case LOSS:
+		return "Loss"
+	default:
+		return "Unknown"
+	}
+}
+
+// Result is the exact value of a position for the player to move
+type Result struct {
+	Outcome  Outcome
+	Score    int // Positive when the player to move wins; the sooner the win, the higher
+	Distance int // Plies until the game ends when both sides play perfectly
+}
+
+// MoveResult is the exact value of playing a column, for the player playing it
+type MoveResult struct {
+	Column int
+	Result
+}
+
+// Solver computes exact game values on the classic 6x7 board using a
+// bitboard position, a transposition table shared between searches, move
+// ordering and left/right symmetry. A Solver is safe for concurrent use;
+// searches are serialized.
+type Solver struct {
+	mu       sync.Mutex
+	table    *transpositionTable
+	deadline time.Time
+	nodes    int
+	timedOut bool
+}
+
+// NewSolver allocates a solver and its transposition table (about 20 MB)
+func NewSolver() *Solver {
+	return &Solver{table: newTranspositionTable()}
+}
+
+var (
+	defaultSolver     *Solver
+	defaultSolverOnce sync.Once
+)
+
+// DefaultSolver returns a process-wide solver, allocated on first use
+func DefaultSolver() *Solver {
+	defaultSolverOnce.Do(func() {
+		defaultSolver = NewSolver()
+	})
+	return defaultSolver
+}
+
+// Solvable reports whether the solver handles the game's rules
+func Solvable(p *shared.Power) bool {
+	_, err := newBitPosition(p)
+	return err == nil
+}
+
+// Solve returns the exact value of the position for the player to move. A
+// zero budget means no time limit.
+func (s *Solver) Solve(p *shared.Power, budget time.Duration) (Result, error) {
+	pos, err := newBitPosition(p)
+	if err != nil {
+		return Result{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.start(budget)
+
+	score := s.solve(pos)
+	if s.timedOut {
+		return Result{}, ErrSolverTimeout
+	}
+	return newResult(score, pos.moves), nil
+}
+
+// Analyze returns the exact value of every playable column, from the point
+// of view of the player to move. A zero budget means no time limit.
+func (s *Solver) Analyze(p *shared.Power, budget time.Duration) ([]MoveResult, error) {
+	pos, err := newBitPosition(p)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.analyze(pos, budget)
+}
+
+// analyze values every playable column of pos. Callers hold s.mu.
+func (s *Solver) analyze(pos bitPosition, budget time.Duration) ([]MoveResult, error) {
+	s.start(budget)
+
+	var results []MoveResult
+	for _, col := range solverColumnOrder {
+		if !pos.canPlay(col) {
+			continue
+		}
+
+		var score int
+		if pos.isWinningMove(col) {
+			score = (solverCells + 1 - pos.moves) / 2
+		} else {
+			child := pos
+			child.playColumn(col)
+			score = -s.solve(child)
+		}
+		if s.timedOut {
+			return nil, ErrSolverTimeout
+		}
+
+		// The score is seen from the player to move, before their move
+		results = append(results, MoveResult{Column: col, Result: newResult(score, pos.moves)})
+	}
+	return results, nil
+}
+
+// BestMove returns the column with the best exact value, preferring the
+// center among equal moves
+func (s *Solver) BestMove(p *shared.Power, budget time.Duration) (shared.Coordinate, error) {
+	results, err := s.Analyze(p, budget)
+	if err != nil {
+		return shared.Coordinate{}, err
+	}
+	return bestColumn(results)
+}
+
+// TryBestMove is BestMove without waiting: it returns ErrSolverBusy at once
+// when another search holds the solver, so the budget is never spent
+// queuing behind other games
+func (s *Solver) TryBestMove(p *shared.Power, budget time.Duration) (shared.Coordinate, error) {
+	pos, err := newBitPosition(p)
+	if err != nil {
+		return shared.Coordinate{}, err
+	}
+
+	if !s.mu.TryLock() {
+		return shared.Coordinate{}, ErrSolverBusy
+	}
+	defer s.mu.Unlock()
+	results, err := s.analyze(pos, budget)
+	if err != nil {
+		return shared.Coordinate{}, err
+	}
+	return bestColumn(results)
+}
+
+// bestColumn picks the column with the best exact value among results
+func bestColumn(results []MoveResult) (shared.Coordinate, error) {
+	if len(results) == 0 {
+		return shared.Coordinate{}, ErrNoMove
+	}
+
+	best := results[0]
+	for _, r := range results[1:] {
+		if r.Score > best.Score {
+			best = r
+		}
+	}
+	return shared.Coordinate{Column: best.Column}, nil
+}
+
+// start resets the search counters for a new search
+func (s *Solver) start(budget time.Duration) {
+	s.nodes = 0
+	s.timedOut = false
+	s.deadline = time.Time{}
+	if budget > 0 {
+		s.deadline = time.Now().Add(budget)
+	}
+}
+
+// newResult converts a score into an outcome and a distance to the end of
+// the game, for a position where moves pieces have been played
+func newResult(score, moves int) Result {
+	result := Result{Score: score}
+	switch {
+	case score > 0:
+		result.Outcome = WIN
+	case score < 0:
+		result.Outcome = LOSS
+	default:
+		result.Outcome = DRAW
+		result.Distance = solverCells - moves
+		return result
+	}
+
+	// The score tells how many pieces the winner has left when winning:
+	// |score| = (cells + 2 - end) / 2 where end is the total number of
+	// pieces on the board. The winner's parity picks the right end.
+	magnitude := score
+	if magnitude < 0 {
+		magnitude = -magnitude
+	}
+	end := solverCells + 2 - 2*magnitude
+	winnerParity := (moves + 1) % 2 // The player to move plays odd plies from now
+	if score < 0 {
+		winnerParity = moves % 2
+	}
+	if end%2 != winnerParity {
+		end--
+	}
+	result.Distance = end - moves
+	return result
+}
+
+// solve runs a null-window search converging on the exact score
+func (s *Solver) solve(pos bitPosition) int {
+	if pos.canWinNext() {
+		return (solverCells + 1 - pos.moves) / 2
+	}
+
+	min := -(solverCells - pos.moves) / 2
+	max := (solverCells + 1 - pos.moves) / 2
+	for min < max {
+		med := min + (max-min)/2
+		if med <= 0 && min/2 < med {
+			med = min / 2
+		} else if med >= 0 && max/2 > med {
+			med = max / 2
+		}
+
+		r := s.negamax(pos, med, med+1)
+		if s.timedOut {
+			return 0
+		}
+		if r <= med {
+			max = r
+		} else {
+			min = r
+		}
+	}
+	return min
+}
+
+// negamax returns the score of a position where the player to move cannot
+// win immediately, within the [alpha, beta] window
+func (s *Solver) negamax(pos bitPosition, alpha, beta int) int {
+	s.nodes++
+	if s.nodes%4096 == 0 && !s.deadline.IsZero() && time.Now().After(s.deadline) {
+		s.timedOut = true
+	}
+	if s.timedOut {
+		return 0
+	}
+
+	next := pos.possibleNonLosingMoves()
+	if next == 0 {
+		// Every move lets the opponent win right away
+		return -(solverCells - pos.moves) / 2
+	}
+	if pos.moves >= solverCells-2 {
+		// Neither player can win with the last two pieces
+		return 0
+	}
+
+	// The opponent cannot win with their next piece, so the score is bounded
+	min := -(solverCells - 2 - pos.moves) / 2
+	if alpha < min {
+		alpha = min
+		if alpha >= beta {
+			return alpha
+		}
+	}
+
+	max := (solverCells - 1 - pos.moves) / 2
+	key := pos.symmetricKey()
+	if bound, ok := s.table.get(key); ok {
+		max = bound
+	}
+	if beta > max {
+		beta = max
+		if alpha >= beta {
+			return beta
+		}
+	}
+
+	for _, move := range pos.sortedMoves(next) {
+		child := pos
+		child.play(move)
+		score := -s.negamax(child, -beta, -alpha)
+		if s.timedOut {
+			return 0
+		}
+		if score >= beta {
+			return score
+		}
+		if score > alpha {
+			alpha = score
+		}
+	}
+
+	s.table.put(key, alpha)
+	return alpha
+}
+
+// solverColumnOrder tries central columns first
+var solverColumnOrder = [solverWidth]int{3, 2, 4, 1, 5, 0, 6}
+
+// Bitboard layout: each column takes solverHeight+1 bits, bottom cell
+// first; the extra bit keeps lines from wrapping between columns
+const solverColumnBits = solverHeight + 1
+
+var (
+	bottomMask = func() uint64 {
+		var mask uint64
+		for col := 0; col < solverWidth; col++ {
+			mask |= 1 << (col * solverColumnBits)
+		}
+		return mask
+	}()
+	boardMask = bottomMask * ((1 << solverHeight) - 1)
+)
+
+func topMaskCol(col int) uint64    { return 1 << (solverHeight - 1 + col*solverColumnBits) }
+func bottomMaskCol(col int) uint64 { return 1 << (col * solverColumnBits) }
+func columnMask(col int) uint64    { return ((1 << solverHeight) - 1) << (col * solverColumnBits) }
+
+// bitPosition is a position seen from the player to move
+type bitPosition struct {
+	current uint64 // Pieces of the player to move
+	mask    uint64 // All pieces
+	moves   int    // Pieces played so far
+}
+
+// newBitPosition converts a classic game whose pieces all rest on the
+// bottom of their column. It reads a single snapshot of the game, so a move,
+// an Undo or a Redo made meanwhile cannot mix two positions.
+func newBitPosition(p *shared.Power) (bitPosition, error) {
+	game := p.Clone()
+	settings := game.Settings
+	if settings.Rows != solverHeight || settings.Columns != solverWidth || settings.WinLength != shared.DefaultWinLength {
+		return bitPosition{}, ErrUnsupportedPosition
+	}
+	if game.Gravity != shared.DOWN || game.GetVariant().Name() != shared.DefaultVariant || settings.Players != shared.MinPlayers {
+		return bitPosition{}, ErrUnsupportedPosition
+	}
+	if settings.Topology != shared.FLAT || settings.Obstacles != (shared.Obstacles{}) || len(settings.Twists.Twists) > 0 {
+		return bitPosition{}, ErrUnsupportedPosition
+	}
+	if game.State != shared.ONGOING {
+		return bitPosition{}, ErrUnsupportedPosition
+	}
+
+	board := game.Board
+	mine := game.IsPlaying.Piece()
+
+	var pos bitPosition
+	for col := 0; col < solverWidth; col++ {
+		stacked := true
+		for height := 0; height < solverHeight; height++ {
+			cell := board[solverHeight-1-height][col]
+			if cell == 0 {
+				stacked = false
+				continue
+			}
+			if !stacked {
+				// A floating piece cannot happen with normal gravity
+				return bitPosition{}, ErrUnsupportedPosition
+			}
+
+			bit := uint64(1) << (col*solverColumnBits + height)
+			pos.mask |= bit
+			if cell == mine {
+				pos.current |= bit
+			}
+			pos.moves++
+		}
+	}
+	return pos, nil
+}
+
+func (pos *bitPosition) canPlay(col int) bool {
+	return pos.mask&topMaskCol(col) == 0
+}
+
+// play adds a piece (given as a single bit) for the player to move, then
+// hands the turn to the opponent
+func (pos *bitPosition) play(move uint64) {
+	pos.current ^= pos.mask
+	pos.mask |= move
+	pos.moves++
+}
+
+func (pos *bitPosition) playColumn(col int) {
+	pos.play((pos.mask + bottomMaskCol(col)) & columnMask(col))
+}
+
+func (pos *bitPosition) isWinningMove(col int) bool {
+	return pos.winningPosition()&pos.possible()&columnMask(col) != 0
+}
+
+func (pos *bitPosition) canWinNext() bool {
+	return pos.winningPosition()&pos.possible() != 0
+}
+
+// possible returns the cells where a piece can be played
+func (pos *bitPosition) possible() uint64 {
+	return (pos.mask + bottomMask) & boardMask
+}
+
+func (pos *bitPosition) winningPosition() uint64 {
+	return winningCells(pos.current, pos.mask)
+}
+
+func (pos *bitPosition) opponentWinningPosition() uint64 {
+	return winningCells(pos.current^pos.mask, pos.mask)
+}
+
+// possibleNonLosingMoves returns the moves that do not let the opponent win
+// with their next piece
+func (pos *bitPosition) possibleNonLosingMoves() uint64 {
+	possible := pos.possible()
+	opponentWin := pos.opponentWinningPosition()
+	forced := possible & opponentWin
+	if forced != 0 {
+		if forced&(forced-1) != 0 {
+			// Two threats cannot both be blocked
+			return 0
+		}
+		possible = forced
+	}
+	// Do not play right below a cell where the opponent would win
+	return possible &^ (opponentWin >> 1)
+}
+
+// sortedMoves orders moves by the number of winning cells they create,
+// central columns first among equals
+func (pos *bitPosition) sortedMoves(next uint64) []uint64 {
+	type scoredMove struct {
+		move  uint64
+		score int
+	}
+
+	var buf [solverWidth]scoredMove
+	moves := buf[:0]
+	for _, col := range solverColumnOrder {
+		if move := next & columnMask(col); move != 0 {
+			score := bits.OnesCount64(winningCells(pos.current|move, pos.mask))
+			moves = append(moves, scoredMove{move: move, score: score})
+		}
+	}
+	sort.SliceStable(moves, func(i, j int) bool { return moves[i].score > moves[j].score })
+
+	sorted := make([]uint64, len(moves))
+	for i, m := range moves {
+		sorted[i] = m.move
+	}
+	return sorted
+}
+
+// key uniquely identifies the position
+func (pos *bitPosition) key() uint64 {
+	return pos.current + pos.mask
+}
+
+// symmetricKey identifies a position and its mirror image with the same key
+func (pos *bitPosition) symmetricKey() uint64 {
+	key := pos.key()
+	if mirrored := mirrorColumns(pos.current) + mirrorColumns(pos.mask); mirrored < key {
+		return mirrored
+	}
+	return key
+}
+
+// mirrorColumns flips a bitboard left to right
+func mirrorColumns(board uint64) uint64 {
+	const column = (1 << solverColumnBits) - 1
+	var mirrored uint64
+	for col := 0; col < solverWidth; col++ {
+		bitsOfCol := (board >> (col * solverColumnBits)) & column
+		mirrored |= bitsOfCol << ((solverWidth - 1 - col) * solverColumnBits)
+	}
+	return mirrored
+}
+
+// winningCells returns the empty cells that would complete four in a row
+// for the pieces in position
+func winningCells(position, mask uint64) uint64 {
+	// Vertical
+	r := (position << 1) & (position << 2) & (position << 3)
+
+	// Horizontal, then both diagonals
+	for _, shift := range [3]int{solverColumnBits, solverColumnBits - 1, solverColumnBits + 1} {
+		p := (position << shift) & (position << (2 * shift))
+		r |= p & (position << (3 * shift))
+		r |= p & (position >> shift)
+		p = (position >> shift) & (position >> (2 * shift))
+		r |= p & (position << shift)
+		r |= p & (position >> (3 * shift))
+	}
+
+	return r & (boardMask ^ mask)
+}
+
+// transpositionTableSize is a prime close to 2^22: with 32 bits of key stored
+// per entry, the 49-bit position keys are still told apart
+const transpositionTableSize = 4194301
+
+// transpositionTable stores upper bounds of position scores
+type transpositionTable struct {
+	keys   []uint32
+	values []int8
+}
+
+func newTranspositionTable() *transpositionTable {
+	return &transpositionTable{
+		keys:   make([]uint32, transpositionTableSize),
+		values: make([]int8, transpositionTableSize),
+	}
+}
+
+// boundOffset keeps stored values non-zero so zero marks an empty slot
+const boundOffset = solverCells/2 + 1
+
+func (t *transpositionTable) put(key uint64, bound int) {
+	i := key % transpositionTableSize
+	t.keys[i] = uint32(key)
+	t.values[i] = int8(bound + boundOffset)
+}
+
+func (t *transpositionTable) get(key uint64) (int, bool) {
+	i := key % transpositionTableSize
+	if t.keys[i] != uint32(key) || t.values[i] == 0 {
+		return 0, false
+	}
+	return int(t.values[i]) - boundOffset, true
+}
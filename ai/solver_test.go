@@ -0,0 +1,118 @@
+package ai
+
+import (
+	"math/rand/v2"
+	"testing"
+
+	"power4/shared"
+)
+
+// bruteForceScore computes the solver score with a plain negamax on Power
+func bruteForceScore(p *shared.Power, moves int) int {
+	best := -solverCells
+	for col := 0; col < solverWidth; col++ {
+		if _, err := p.MakeMove(shared.Coordinate{Column: col}); err != nil {
+			continue
+		}
+
+		var score int
+		switch p.GetGameState() {
+		case shared.WON:
+			score = (solverCells + 1 - moves) / 2
+		case shared.DRAW:
+			score = 0
+		default:
+			score = -bruteForceScore(p, moves+1)
+		}
+		p.Undo()
+
+		if score > best {
+			best = score
+		}
+	}
+	return best
+}
+
+// randomPosition plays random moves until n pieces are on an ongoing board
+func randomPosition(r *rand.Rand, n int) *shared.Power {
+	for {
+		p := shared.NewGameInstance(shared.GameSettings{Rows: solverHeight, Columns: solverWidth})
+		for len(p.History()) < n && !p.IsGameOver() {
+			p.MakeMove(shared.Coordinate{Column: r.IntN(solverWidth)})
+		}
+		if !p.IsGameOver() {
+			return p
+		}
+	}
+}
+
+func TestSolverMatchesBruteForce(t *testing.T) {
+	r := rand.New(rand.NewPCG(1, 2))
+	s := NewSolver()
+	for i := 0; i < 50; i++ {
+		p := randomPosition(r, 32+r.IntN(4))
+
+		result, err := s.Solve(p, 0)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if want := bruteForceScore(p.Clone(), len(p.History())); result.Score != want {
+			t.Fatalf("position %d: solver score %d, brute force %d", i, result.Score, want)
+		}
+	}
+}
+
+func TestSolverDistance(t *testing.T) {
+	r := rand.New(rand.NewPCG(5, 6))
+	s := NewSolver()
+	for i := 0; i < 20; i++ {
+		p := randomPosition(r, 18+r.IntN(10))
+
+		result, err := s.Solve(p, 0)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		// With perfect play the winner wins as fast as possible and the
+		// loser holds out as long as possible
+		plies := 0
+		for !p.IsGameOver() {
+			move, err := s.BestMove(p, 0)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			p.MakeMove(move)
+			plies++
+		}
+		if plies != result.Distance {
+			t.Fatalf("position %d: solver predicted %d plies (%v), game lasted %d", i, result.Distance, result.Outcome, plies)
+		}
+	}
+}
+
+func TestSolverRejectsOtherRules(t *testing.T) {
+	p := shared.NewGameInstance(shared.GameSettings{Rows: 6, Columns: 7, WinLength: 5})
+	if Solvable(p) {
+		t.Fatal("Connect-5 positions must not be solvable")
+	}
+	if _, err := NewSolver().Solve(p, 0); err != ErrUnsupportedPosition {
+		t.Fatalf("expected ErrUnsupportedPosition, got %v", err)
+	}
+}
+
+func TestSolverTryBestMove(t *testing.T) {
+	s := NewSolver()
+	p := shared.NewGameInstance(shared.GameSettings{Rows: 6, Columns: 7})
+	for _, col := range []int{0, 1, 0, 1, 0, 1} {
+		p.MakeMove(shared.Coordinate{Column: col})
+	}
+
+	s.mu.Lock()
+	if _, err := s.TryBestMove(p, 0); err != ErrSolverBusy {
+		t.Errorf("expected ErrSolverBusy while another search runs, got %v", err)
+	}
+	s.mu.Unlock()
+	if move, err := s.TryBestMove(p, 0); err != nil || move.Column != 0 {
+		t.Errorf("expected the win in column 0, got %+v, %v", move, err)
+	}
+}
@@ -0,0 +1,434 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+
+	"power4/shared"
+)
+
+// maxBodyBytes caps the size of a request body
+const maxBodyBytes = 64 << 10
+
+// maxBoardSize caps the rows and columns of a board, like the bonus setup
+const maxBoardSize = shared.MaxBitboardSize
+
+// maxGames caps the games the API keeps: the least recently used one makes
+// room for a new one
+const maxGames = 1000
+
+// SettingsData describes the rules of a game. Zero values take the
+// engine's defaults: a 6x7 board, 4 in a row and two players.
+type SettingsData struct {
+	Rows      int           `json:"rows"`
+	Columns   int           `json:"columns"`
+	WinLength int           `json:"winLength"`
+	Players   int           `json:"players"`
+	Variant   string        `json:"variant"`  // Name of a registered rule set
+	Gravity   string        `json:"gravity"`  // "down", "up", "left", "right" or "none"
+	Topology  string        `json:"topology"` // "flat" or "cylinder"
+	Obstacles ObstaclesData `json:"obstacles"`
+}
+
+// ObstaclesData describes the blocked cells of a new board
+type ObstaclesData struct {
+	Preset string `json:"preset,omitempty"` // Name of a preset layout
+	Count  int    `json:"count,omitempty"`  // Blockers placed at random when there is no preset
+	Seed   uint64 `json:"seed,omitempty"`   // Seed of the random placement
+}
+
+// MoveData is a move, as asked for by a client or as recorded in the history
+type MoveData struct {
+	Player int    `json:"player,omitempty"` // 1-based number of the player moving
+	Kind   string `json:"kind"`             // "drop" (the default) or "pop"
+	Column int    `json:"column"`
+	Row    int    `json:"row"` // Row played without gravity, or landed on
+}
+
+// CellData is a cell of the board
+type CellData struct {
+	Column int `json:"column"`
+	Row    int `json:"row"`
+}
+
+// GameData is a game as returned by every endpoint
+type GameData struct {
+	ID            string       `json:"id"`
+	Settings      SettingsData `json:"settings"`
+	Board         [][]int      `json:"board"`         // 0=empty, the 1-based player number, then blockers
+	State         string       `json:"state"`         // "Ongoing", "Won" or "Draw"
+	CurrentPlayer int          `json:"currentPlayer"` // 1-based number of the player to move
+	Winner        int          `json:"winner"`        // 1-based number of the winner, 0 if none
+	WinningCells  []CellData   `json:"winningCells"`  // Discs of the winning line(s)
+	Gravity       string       `json:"gravity"`       // Direction the next piece falls in
+	Phase         string       `json:"phase"`         // Stage of the game, for variants that have several
+	Turns         int          `json:"turns"`         // Moves played so far
+	LegalMoves    []MoveData   `json:"legalMoves"`    // Moves the current player can make
+	History       []MoveData   `json:"history"`       // Moves played, oldest first
+	Scores        []int        `json:"scores"`        // Games won by each player
+	CanUndo       bool         `json:"canUndo"`
+	Events        string       `json:"events"` // URL of the Server-Sent Events stream
+}
+
+// ErrorData is the body of every error response
+type ErrorData struct {
+	Error struct {
+		Code    string `json:"code"`    // Stable identifier, e.g. "column_full"
+		Message string `json:"message"` // Human readable explanation
+	} `json:"error"`
+}
+
+// Game is a game played through the API. mu serializes requests so scores
+// and game state change together.
+type Game struct {
+	mu     sync.Mutex
+	id     string // Short ID, part of every URL of the game
+	events string // Game ID of the event stream
+	game   *shared.Power
+	scores []int
+}
+
+// games holds the games of the API. They share the rooms' short IDs and
+// idle expiry, but never show in the lobby.
+var games = newGameStore()
+
+// newGameStore creates the manager holding the games of the API
+func newGameStore() *shared.RoomManager {
+	m := shared.NewRoomManager(shared.DefaultRoomIdleTTL)
+	m.SetMaxRooms(maxGames)
+	return m
+}
+
+// Info describes the game as a room that is never open
+func (g *Game) Info() shared.RoomInfo {
+	players := g.game.GetSettings().Players
+	return shared.RoomInfo{Mode: "API", URL: "/api/v1/games/" + g.id, Seats: players, Taken: players}
+}
+
+// errorCodes names the engine errors and gives the status they answer with
+var errorCodes = []struct {
+	err    error
+	code   string
+	status int
+}{
+	{shared.ErrInvalidSettings, "invalid_settings", http.StatusBadRequest},
+	{shared.ErrGameOver, "game_over", http.StatusConflict},
+	{shared.ErrColumnOutOfRange, "column_out_of_range", http.StatusBadRequest},
+	{shared.ErrRowOutOfRange, "row_out_of_range", http.StatusBadRequest},
+	{shared.ErrColumnFull, "column_full", http.StatusConflict},
+	{shared.ErrRowFull, "row_full", http.StatusConflict},
+	{shared.ErrCellOccupied, "cell_occupied", http.StatusConflict},
+	{shared.ErrColumnLocked, "column_locked", http.StatusConflict},
+	{shared.ErrIllegalPop, "illegal_pop", http.StatusConflict},
+	{shared.ErrMoveNotAllowed, "move_not_allowed", http.StatusBadRequest},
+	{shared.ErrNotYourTurn, "not_your_turn", http.StatusConflict},
+	{shared.ErrNothingToUndo, "nothing_to_undo", http.StatusConflict},
+}
+
+// writeJSON sends a value as the JSON body of a response
+func writeJSON(w http.ResponseWriter, status int, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(value); err != nil {
+		log.Printf("api: cannot encode response: %v", err)
+	}
+}
+
+// writeError sends an error response with a code and a message
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	var body ErrorData
+	body.Error.Code = code
+	body.Error.Message = message
+	writeJSON(w, status, body)
+}
+
+// writeEngineError sends the error response matching an engine error
+func writeEngineError(w http.ResponseWriter, err error) {
+	for _, known := range errorCodes {
+		if errors.Is(err, known.err) {
+			writeError(w, known.status, known.code, err.Error())
+			return
+		}
+	}
+	writeError(w, http.StatusBadRequest, "move_rejected", err.Error())
+}
+
+// methodNotAllowed answers a request with a method the endpoint lacks
+func methodNotAllowed(w http.ResponseWriter, allowed ...string) {
+	w.Header().Set("Allow", strings.Join(allowed, ", "))
+	writeError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Method not allowed")
+}
+
+// readJSON decodes a request body into value, reporting malformed bodies.
+// An empty body leaves value as it is.
+func readJSON(w http.ResponseWriter, r *http.Request, value any) bool {
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodyBytes))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(value); err != nil && !errors.Is(err, io.EOF) {
+		writeError(w, http.StatusBadRequest, "invalid_json", "Malformed request body: "+err.Error())
+		return false
+	}
+	return true
+}
+
+// parseName returns the value among values whose String matches name,
+// ignoring case; an empty name picks the first value
+func parseName[T fmt.Stringer](name string, values ...T) (T, bool) {
+	if name == "" {
+		return values[0], true
+	}
+	for _, value := range values {
+		if strings.EqualFold(value.String(), name) {
+			return value, true
+		}
+	}
+	var zero T
+	return zero, false
+}
+
+// settings converts the settings of a request for the engine
+func (data SettingsData) settings() (shared.GameSettings, error) {
+	gravity, ok := parseName(data.Gravity, shared.DOWN, shared.UP, shared.LEFT, shared.RIGHT, shared.NONE)
+	if !ok {
+		return shared.GameSettings{}, fmt.Errorf("%w: unknown gravity %q", shared.ErrInvalidSettings, data.Gravity)
+	}
+	topology, ok := parseName(data.Topology, shared.FLAT, shared.CYLINDER)
+	if !ok {
+		return shared.GameSettings{}, fmt.Errorf("%w: unknown topology %q", shared.ErrInvalidSettings, data.Topology)
+	}
+
+	settings := shared.GameSettings{
+		Rows:      data.Rows,
+		Columns:   data.Columns,
+		WinLength: data.WinLength,
+		Players:   data.Players,
+		Variant:   data.Variant,
+		Gravity:   gravity,
+		Topology:  topology,
+		Obstacles: shared.Obstacles(data.Obstacles),
+	}
+	if settings.Rows == 0 && settings.Columns == 0 {
+		settings.Rows, settings.Columns = 6, 7
+	}
+	if settings.Rows > maxBoardSize || settings.Columns > maxBoardSize {
+		return shared.GameSettings{}, fmt.Errorf("%w: a %dx%d board, want at most %dx%d", shared.ErrInvalidSettings, settings.Rows, settings.Columns, maxBoardSize, maxBoardSize)
+	}
+	if settings.WinLength == 0 && gravity == shared.NONE {
+		settings.WinLength = shared.GomokuWinLength
+	}
+	return settings, settings.Validate()
+}
+
+// newMoveData describes a move; player is 0 for a legal move
+func newMoveData(player int, kind shared.MoveKind, cell shared.Coordinate) MoveData {
+	return MoveData{Player: player, Kind: strings.ToLower(kind.String()), Column: cell.Column, Row: cell.Row}
+}
+
+// newCells converts the cells of the engine
+func newCells(coords []shared.Coordinate) []CellData {
+	cells := make([]CellData, len(coords))
+	for i, coord := range coords {
+		cells[i] = CellData{Column: coord.Column, Row: coord.Row}
+	}
+	return cells
+}
+
+// data describes the game. Callers hold g.mu.
+func (g *Game) data() GameData {
+	update := shared.NewGameUpdate(g.game, g.scores)
+	settings := g.game.GetSettings()
+
+	data := GameData{
+		ID: g.id,
+		Settings: SettingsData{
+			Rows:      settings.Rows,
+			Columns:   settings.Columns,
+			WinLength: settings.WinLength,
+			Players:   settings.Players,
+			Variant:   settings.Variant,
+			Gravity:   strings.ToLower(settings.Gravity.String()),
+			Topology:  strings.ToLower(settings.Topology.String()),
+			Obstacles: ObstaclesData(settings.Obstacles),
+		},
+		Board:         update.Board,
+		State:         update.State,
+		CurrentPlayer: update.CurrentPlayer,
+		Winner:        update.Winner,
+		WinningCells:  newCells(update.WinningCells),
+		Gravity:       strings.ToLower(update.Gravity),
+		Phase:         g.game.GetPhase().String(),
+		Turns:         g.game.Turns(),
+		LegalMoves:    []MoveData{},
+		History:       []MoveData{},
+		Scores:        g.scores,
+		CanUndo:       g.game.CanUndo(),
+		Events:        "/games/" + g.events + "/events",
+	}
+	for _, action := range g.game.LegalMoves() {
+		data.LegalMoves = append(data.LegalMoves, newMoveData(0, action.Kind, action.Coordinate))
+	}
+	for _, move := range g.game.History() {
+		data.History = append(data.History, newMoveData(int(move.Player)+1, move.Kind, move.Coordinate))
+	}
+	return data
+}
+
+// publish streams an event about the game to its Server-Sent Events
+// followers; move is the cell just played, if any. Callers hold g.mu.
+func (g *Game) publish(eventType shared.EventType, move *shared.Coordinate) {
+	shared.Events.PublishGame(g.events, eventType, g.game, g.scores, move)
+}
+
+// lookupGame returns the game named in the URL with its lock held, or
+// answers 404
+func lookupGame(w http.ResponseWriter, r *http.Request) (*Game, bool) {
+	g, ok := shared.LookupRoom[*Game](games, r.PathValue("id"))
+	if !ok {
+		writeError(w, http.StatusNotFound, "game_not_found", "Game not found")
+		return nil, false
+	}
+	g.mu.Lock()
+	return g, true
+}
+
+// GamesHandler creates a game from the settings in the request body
+func GamesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, http.MethodPost)
+		return
+	}
+
+	var data SettingsData
+	if !readJSON(w, r, &data) {
+		return
+	}
+	settings, err := data.settings()
+	if err != nil {
+		writeEngineError(w, err)
+		return
+	}
+
+	room := games.Create(func(id string) shared.Room {
+		game := shared.NewGameInstance(settings)
+		return &Game{
+			id:     id,
+			events: shared.NewGameID(),
+			game:   game,
+			scores: make([]int, game.GetSettings().Players),
+		}
+	})
+	g := room.(*Game)
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	w.Header().Set("Location", "/api/v1/games/"+g.id)
+	writeJSON(w, http.StatusCreated, g.data())
+}
+
+// GameHandler returns a game, or deletes it
+func GameHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodDelete {
+		methodNotAllowed(w, http.MethodGet, http.MethodDelete)
+		return
+	}
+
+	g, ok := lookupGame(w, r)
+	if !ok {
+		return
+	}
+	defer g.mu.Unlock()
+
+	if r.Method == http.MethodDelete {
+		games.Remove(g.id)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	writeJSON(w, http.StatusOK, g.data())
+}
+
+// MovesHandler lists the moves of a game, or plays the move in the request
+// body. A move naming its player is refused when it is not their turn.
+func MovesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		methodNotAllowed(w, http.MethodGet, http.MethodPost)
+		return
+	}
+
+	g, ok := lookupGame(w, r)
+	if !ok {
+		return
+	}
+	defer g.mu.Unlock()
+
+	if r.Method == http.MethodGet {
+		writeJSON(w, http.StatusOK, g.data().History)
+		return
+	}
+
+	var move MoveData
+	if !readJSON(w, r, &move) {
+		return
+	}
+	kind, ok := parseName(move.Kind, shared.DROP, shared.POP)
+	if !ok {
+		writeError(w, http.StatusBadRequest, "invalid_move", fmt.Sprintf("Unknown move kind %q", move.Kind))
+		return
+	}
+	if move.Player != 0 && move.Player != int(g.game.GetCurrentPlayer())+1 {
+		writeEngineError(w, shared.ErrNotYourTurn)
+		return
+	}
+
+	placed, err := g.game.Play(shared.Action{Kind: kind, Coordinate: shared.Coordinate{Column: move.Column, Row: move.Row}})
+	if err != nil {
+		writeEngineError(w, err)
+		return
+	}
+	g.publish(shared.EVENT_MOVE, &placed)
+	if g.game.IsGameOver() {
+		if winner := g.game.GetWinner(); winner != nil {
+			g.scores[*winner]++
+			g.publish(shared.EVENT_SCORES, nil)
+		}
+		g.publish(shared.EVENT_GAME_OVER, nil)
+	}
+	writeJSON(w, http.StatusCreated, g.data())
+}
+
+// LastMoveHandler takes back the last move of a game
+func LastMoveHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		methodNotAllowed(w, http.MethodDelete)
+		return
+	}
+
+	g, ok := lookupGame(w, r)
+	if !ok {
+		return
+	}
+	defer g.mu.Unlock()
+
+	// Taking back a winning move takes back its point
+	winner := g.game.GetWinner()
+	if _, err := g.game.Undo(); err != nil {
+		writeEngineError(w, err)
+		return
+	}
+	g.publish(shared.EVENT_BOARD, nil)
+	if winner != nil {
+		g.scores[*winner]--
+		g.publish(shared.EVENT_SCORES, nil)
+	}
+	writeJSON(w, http.StatusOK, g.data())
+}
+
+// NotFoundHandler answers requests to unknown API endpoints
+func NotFoundHandler(w http.ResponseWriter, r *http.Request) {
+	writeError(w, http.StatusNotFound, "not_found", "No such endpoint")
+}
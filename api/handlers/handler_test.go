@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"power4/shared"
+)
+
+// newServer serves the API routes the way main.go mounts them
+func newServer(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	mux := http.NewServeMux()
+	shared.RegisterRoute(mux, []shared.Route{
+		{Path: "/api/v1/games", Handler: GamesHandler},
+		{Path: "/api/v1/games/{id}", Handler: GameHandler},
+		{Path: "/api/v1/games/{id}/moves", Handler: MovesHandler},
+		{Path: "/api/v1/games/{id}/moves/last", Handler: LastMoveHandler},
+		{Path: "/api/v1/", Handler: NotFoundHandler},
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+// call sends a JSON request and decodes the JSON response into value,
+// returning the status
+func call(t *testing.T, method, url, body string, value any) int {
+	t.Helper()
+
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNoContent {
+		return resp.StatusCode
+	}
+	if got := resp.Header.Get("Content-Type"); got != "application/json" {
+		t.Fatalf("%s %s answered with content type %q", method, url, got)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(value); err != nil {
+		t.Fatalf("%s %s: %v", method, url, err)
+	}
+	return resp.StatusCode
+}
+
+// createGame creates a game and returns its URL
+func createGame(t *testing.T, server *httptest.Server, settings string) (string, GameData) {
+	t.Helper()
+
+	var game GameData
+	if status := call(t, http.MethodPost, server.URL+"/api/v1/games", settings, &game); status != http.StatusCreated {
+		t.Fatalf("creating a game returned %d", status)
+	}
+	return server.URL + "/api/v1/games/" + game.ID, game
+}
+
+func TestGameLifecycle(t *testing.T) {
+	server := newServer(t)
+	gameURL, game := createGame(t, server, "")
+	if game.Settings.Rows != 6 || game.Settings.Columns != 7 || game.Settings.Variant != "classic" || len(game.LegalMoves) != 7 {
+		t.Fatalf("got new game %+v", game)
+	}
+
+	// Player 1 stacks column 0 while player 2 answers in column 1
+	for i, column := range []int{0, 1, 0, 1, 0, 1, 0} {
+		body := fmt.Sprintf(`{"player":%d,"column":%d}`, i%2+1, column)
+		if status := call(t, http.MethodPost, gameURL+"/moves", body, &game); status != http.StatusCreated {
+			t.Fatalf("move %d returned %d", i, status)
+		}
+	}
+	if game.State != "Won" || game.Winner != 1 || len(game.WinningCells) != 4 || game.Scores[0] != 1 || len(game.LegalMoves) != 0 {
+		t.Fatalf("got finished game %+v", game)
+	}
+	if last := game.History[len(game.History)-1]; last != (MoveData{Player: 1, Kind: "drop", Column: 0, Row: 2}) {
+		t.Fatalf("got last move %+v", last)
+	}
+
+	// Taking back the winning move takes back its point
+	if status := call(t, http.MethodDelete, gameURL+"/moves/last", "", &game); status != http.StatusOK {
+		t.Fatalf("undo returned %d", status)
+	}
+	if game.State != "Ongoing" || game.Scores[0] != 0 || len(game.History) != 6 {
+		t.Fatalf("got game after undo %+v", game)
+	}
+
+	var history []MoveData
+	if status := call(t, http.MethodGet, gameURL+"/moves", "", &history); status != http.StatusOK || len(history) != 6 {
+		t.Fatalf("listing moves returned %d with %d moves", status, len(history))
+	}
+
+	if status := call(t, http.MethodDelete, gameURL, "", nil); status != http.StatusNoContent {
+		t.Fatalf("delete returned %d", status)
+	}
+	var body ErrorData
+	if status := call(t, http.MethodGet, gameURL, "", &body); status != http.StatusNotFound || body.Error.Code != "game_not_found" {
+		t.Fatalf("deleted game returned %d %+v", status, body)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	server := newServer(t)
+	gameURL, _ := createGame(t, server, `{"rows":4,"columns":4}`)
+	for range 4 {
+		call(t, http.MethodPost, gameURL+"/moves", `{"column":2}`, &GameData{})
+	}
+	gamePath := strings.TrimPrefix(gameURL, server.URL)
+
+	tests := []struct {
+		method, path, body string
+		status             int
+		code               string
+	}{
+		{http.MethodPost, "/api/v1/games", `{"rows":2,"columns":2}`, http.StatusBadRequest, "invalid_settings"},
+		{http.MethodPost, "/api/v1/games", `{"rows":3000,"columns":3000}`, http.StatusBadRequest, "invalid_settings"},
+		{http.MethodPost, "/api/v1/games", `{"rows":6,"columns":16}`, http.StatusBadRequest, "invalid_settings"},
+		{http.MethodPost, "/api/v1/games", `{"gravity":"sideways"}`, http.StatusBadRequest, "invalid_settings"},
+		{http.MethodPost, "/api/v1/games", `{"rows":`, http.StatusBadRequest, "invalid_json"},
+		{http.MethodPost, "/api/v1/games", `{"colums":7}`, http.StatusBadRequest, "invalid_json"},
+		{http.MethodPut, "/api/v1/games", "", http.StatusMethodNotAllowed, "method_not_allowed"},
+		{http.MethodGet, "/api/v1/games/nope", "", http.StatusNotFound, "game_not_found"},
+		{http.MethodGet, "/api/v1/nothing", "", http.StatusNotFound, "not_found"},
+		{http.MethodPost, gamePath + "/moves", `{"column":2}`, http.StatusConflict, "column_full"},
+		{http.MethodPost, gamePath + "/moves", `{"column":9}`, http.StatusBadRequest, "column_out_of_range"},
+		{http.MethodPost, gamePath + "/moves", `{"column":0,"player":2}`, http.StatusConflict, "not_your_turn"},
+		{http.MethodPost, gamePath + "/moves", `{"column":0,"kind":"pop"}`, http.StatusBadRequest, "move_not_allowed"},
+		{http.MethodPost, gamePath + "/moves", `{"column":0,"kind":"jump"}`, http.StatusBadRequest, "invalid_move"},
+		{http.MethodPost, gamePath + "/moves/last", "", http.StatusMethodNotAllowed, "method_not_allowed"},
+	}
+	for _, tt := range tests {
+		var body ErrorData
+		status := call(t, tt.method, server.URL+tt.path, tt.body, &body)
+		if status != tt.status || body.Error.Code != tt.code || body.Error.Message == "" {
+			t.Errorf("%s %s %s returned %d %+v, want %d %s", tt.method, tt.path, tt.body, status, body, tt.status, tt.code)
+		}
+	}
+}
+
+func TestGamesCap(t *testing.T) {
+	server := newServer(t)
+	games.SetMaxRooms(2)
+	t.Cleanup(func() { games.SetMaxRooms(maxGames) })
+
+	// Creating a game beyond the cap drops the least recently used one
+	first, _ := createGame(t, server, "")
+	second, _ := createGame(t, server, "")
+	call(t, http.MethodGet, first, "", &GameData{})
+	createGame(t, server, "")
+
+	var body ErrorData
+	if status := call(t, http.MethodGet, second, "", &body); status != http.StatusNotFound {
+		t.Fatalf("least recently used game returned %d, want 404", status)
+	}
+	if status := call(t, http.MethodGet, first, "", &GameData{}); status != http.StatusOK {
+		t.Fatalf("recently used game returned %d", status)
+	}
+}
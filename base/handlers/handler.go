@@ -1,43 +1,137 @@
 package handlers
 
 import (
+	"errors"
+	"fmt"
 	"html/template"
 	"net/http"
 	"strconv"
+	"strings"
+	"sync"
 
+	"power4/ai"
 	"power4/shared"
 )
 
 // GameData represents the data structure passed to the template
 type GameData struct {
-	Board         [][]int // 6x7 board (0=empty, 1=player1, 2=player2)
-	CurrentPlayer int     // 1 or 2
-	Player1Score  int     // Player 1's score
-	Player2Score  int     // Player 2's score
-	GameOver      bool    // Whether game is finished
-	GameWon       bool    // Whether someone won
-	GameDraw      bool    // Whether it's a draw
-	Winner        int     // Winning player (1 or 2)
-	ShowModal     bool    // Whether to show win/draw modal
-	Message       string  // Status message to display
-	ColumnIndices []int   // [0,1,2,3,4,5,6] for iteration
-	RowIndices    []int   // [0,1,2,3,4,5] for iteration
-}
-
-// Global game state (in production, you'd use sessions or database)
-var (
+	Board         [][]int  // 6x7 board (0=empty, 1=player1, 2=player2)
+	CurrentPlayer int      // 1 or 2
+	Player1Score  int      // Player 1's score
+	Player2Score  int      // Player 2's score
+	GameOver      bool     // Whether game is finished
+	GameWon       bool     // Whether someone won
+	GameDraw      bool     // Whether it's a draw
+	Winner        int      // Winning player (1 or 2)
+	ShowModal     bool     // Whether to show win/draw modal
+	Message       string   // Status message to display
+	ColumnIndices []int    // [0,1,2,3,4,5,6] for iteration
+	RowIndices    []int    // [0,1,2,3,4,5] for iteration
+	WinningCells  [][]bool // true for the discs of the winning line(s)
+	VsComputer    bool     // Whether Player 2 is played by the computer
+	Opponent      string   // "human", or the computer difficulty ("easy", ...)
+	CanUndo       bool     // Whether a move can be taken back
+	CanRedo       bool     // Whether an undone move can be replayed
+	Events        string   // URL of the game's event stream
+	Room          string   // Room ID, empty for the caller's own game
+	Page          string   // URL of the game's page
+	Actions       string   // Prefix of the form actions
+	ShareURL      string   // Link inviting the opponent to the room
+	You           int      // 1-based seat of the viewer in a room, 0 for a spectator
+	Spectators    int      // Browsers watching the room without a seat
+	CanMove       bool     // Whether the viewer may play now
+	CanJoin       bool     // Whether the viewer may take a free seat of the room
+}
+
+// session holds the game and scores of a single browser, or of a room
+// played from two browsers. mu serializes the handlers of that game so
+// scores and game state change together.
+type session struct {
+	mu           sync.Mutex
+	id           string // Game ID of the event stream
 	game         *shared.Power
 	player1Score int
 	player2Score int
-)
+	computer     bool          // Whether RED is played by the computer
+	difficulty   ai.Difficulty // Strength of the computer opponent
+	room         string        // Room ID when the game is hosted in a room
+	seats        []string      // Session holding each player of a room
+	spectators   int           // Open event streams of browsers without a seat in the room
+}
+
+// sessions maps each browser's session cookie to its own game
+var sessions = shared.NewSessionStore(shared.DefaultSessionTTL, newSession)
 
-func init() {
-	// Initialize game with standard Connect 4 dimensions
+// newSession creates a game with standard Connect 4 dimensions
+func newSession() *session {
 	settings := shared.GameSettings{
 		Rows:    6,
 		Columns: 7,
 	}
-	game = shared.NewGameInstance(settings)
+	return &session{id: shared.NewGameID(), game: shared.NewGameInstance(settings)}
+}
+
+// addScore adjusts the score of the player behind a shared.Player
+func (s *session) addScore(player shared.Player, delta int) {
+	if player == shared.BLUE {
+		s.player1Score += delta
+	} else {
+		s.player2Score += delta
+	}
+}
+
+// publish streams an event about the game; move is the cell just played,
+// if any
+func (s *session) publish(eventType shared.EventType, move *shared.Coordinate) {
+	shared.Events.PublishGame(s.id, eventType, s.game, []int{s.player1Score, s.player2Score}, move)
+}
+
+// publishOutcome streams the end of the game and, after a win, the point it
+// earned
+func (s *session) publishOutcome() {
+	s.publish(shared.EVENT_GAME_OVER, nil)
+	if s.game.GetGameState() == shared.WON {
+		s.publish(shared.EVENT_SCORES, nil)
+	}
+}
+
+// opponent returns the form value describing who plays Player 2
+func (s *session) opponent() string {
+	if !s.computer {
+		return "human"
+	}
+	return strings.ToLower(s.difficulty.String())
+}
+
+// setOpponent applies an opponent form value; an empty value keeps the
+// current opponent
+func (s *session) setOpponent(value string) {
+	if value == "" {
+		return
+	}
+	difficulty, ok := ai.ParseDifficulty(value)
+	s.computer = ok
+	s.difficulty = difficulty
+}
+
+// computerToMove reports whether the computer should play now
+func (s *session) computerToMove() bool {
+	return s.computer && !s.game.IsGameOver() && s.game.GetCurrentPlayer() == shared.RED
+}
+
+// playComputerTurn lets the computer answer as RED, returning the cell it
+// played and whether it moved
+func playComputerTurn(s *session) (shared.Coordinate, bool) {
+	if !s.computerToMove() {
+		return shared.Coordinate{}, false
+	}
+
+	move, err := ai.BestMove(s.game, s.difficulty)
+	if err != nil {
+		return shared.Coordinate{}, false
+	}
+	placed, err := s.game.MakeMove(move)
+	return placed, err == nil
 }
 
 // convertBoardToTemplate converts the game board to template-friendly format
@@ -62,12 +156,13 @@ func convertBoardToTemplate(gameBoard [][]rune) [][]int {
 }
 
 // createGameData creates the GameData struct for template rendering
-func createGameData(message string, showModal bool) GameData {
+func createGameData(s *session, message string, showModal bool) GameData {
+	game := s.game
 	data := GameData{
-		Board:         convertBoardToTemplate(game.Board),
+		Board:         convertBoardToTemplate(game.GetBoard()),
 		CurrentPlayer: int(game.GetCurrentPlayer()) + 1, // Convert to 1-based
-		Player1Score:  player1Score,
-		Player2Score:  player2Score,
+		Player1Score:  s.player1Score,
+		Player2Score:  s.player2Score,
 		GameOver:      game.IsGameOver(),
 		GameWon:       false,
 		GameDraw:      false,
@@ -76,22 +171,27 @@ func createGameData(message string, showModal bool) GameData {
 		Message:       message,
 		ColumnIndices: []int{0, 1, 2, 3, 4, 5, 6},
 		RowIndices:    []int{0, 1, 2, 3, 4, 5},
+		WinningCells:  shared.WinningGrid(game.WinningCells(), game.Settings.Rows, game.Settings.Columns),
+		VsComputer:    s.computer,
+		Opponent:      s.opponent(),
+		CanUndo:       game.CanUndo(),
+		CanRedo:       game.CanRedo(),
+		Events:        s.events(),
+		Room:          s.room,
+		Page:          s.page(),
+		Actions:       strings.TrimSuffix(s.page(), "/"),
+		CanMove:       !game.IsGameOver(),
 	}
 
 	// Set game state specific fields
 	if game.IsGameOver() {
 		switch game.GetGameState() {
-		case shared.BLUE_WINS:
-			data.GameWon = true
-			data.Winner = 1
-			if showModal {
-				player1Score++
-			}
-		case shared.RED_WINS:
+		case shared.WON:
+			winner := *game.GetWinner()
 			data.GameWon = true
-			data.Winner = 2
+			data.Winner = int(winner) + 1 // Convert to 1-based
 			if showModal {
-				player2Score++
+				s.addScore(winner, 1)
 			}
 		case shared.DRAW:
 			data.GameDraw = true
@@ -102,15 +202,69 @@ func createGameData(message string, showModal bool) GameData {
 	return data
 }
 
-// HomeHandler renders the main game page
+// describeMoveError maps an engine error to a user message and HTTP status
+func describeMoveError(err error) (string, int) {
+	switch {
+	case errors.Is(err, shared.ErrGameOver):
+		return "Game is already over!", http.StatusConflict
+	case errors.Is(err, shared.ErrColumnFull):
+		return "Column is full! Try another column.", http.StatusConflict
+	case errors.Is(err, shared.ErrColumnOutOfRange):
+		return "That column does not exist.", http.StatusBadRequest
+	case errors.Is(err, shared.ErrNotYourTurn):
+		return "Wait for your opponent to play.", http.StatusConflict
+	case errors.Is(err, shared.ErrRoomNotReady):
+		return "Share the link: your opponent has not joined yet.", http.StatusConflict
+	case errors.Is(err, shared.ErrNotSeated):
+		return "Only the players of the room can move.", http.StatusForbidden
+	default:
+		return "Move rejected: " + err.Error(), http.StatusBadRequest
+	}
+}
+
+// loadGame returns the game a request is about with its lock held: the
+// room named in the URL, or else the caller's own game. seat is the
+// caller's seat in a room, -1 when they hold none. A missing room is
+// answered with 404.
+func loadGame(w http.ResponseWriter, r *http.Request) (*session, int, bool) {
+	id := r.PathValue("id")
+	if id == "" {
+		s := sessions.Get(w, r)
+		s.mu.Lock()
+		return s, -1, true
+	}
+
+	s, ok := shared.LookupRoom[*session](shared.Rooms, id)
+	if !ok {
+		http.Error(w, "Room not found", http.StatusNotFound)
+		return nil, -1, false
+	}
+	s.mu.Lock()
+	seat, seated := shared.SeatOf(s.seats, r)
+	if !seated {
+		seat = -1
+	}
+	return s, seat, true
+}
+
+// HomeHandler renders the main game page, or the page of a room. Opening
+// the link of a room only watches the game: a seat is taken with
+// JoinRoomHandler.
 func HomeHandler(w http.ResponseWriter, r *http.Request) {
+	s, seat, ok := loadGame(w, r)
+	if !ok {
+		return
+	}
+	defer s.mu.Unlock()
+
 	tmpl, err := template.ParseFiles("base/templates/index.html")
 	if err != nil {
 		http.Error(w, "Error parsing template: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	data := createGameData("", false)
+	data := createGameData(s, "", false)
+	s.showSeat(r, seat, &data)
 
 	err = tmpl.Execute(w, data)
 	if err != nil {
@@ -119,7 +273,8 @@ func HomeHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// MoveHandler handles column click moves
+// MoveHandler handles column click moves; in a room, only from the player
+// whose turn it is
 func MoveHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -138,24 +293,30 @@ func MoveHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Check if move is valid
-	coord := shared.Coordinate{Column: column, Row: 0} // Row doesn't matter for this check
-	if !game.IsValidMove(coord) {
-		// Redirect back with error message
+	s, seat, ok := loadGame(w, r)
+	if !ok {
+		return
+	}
+	defer s.mu.Unlock()
+	game := s.game
+
+	// Make the move, reporting rejected moves back on the board
+	coord := shared.Coordinate{Column: column, Row: 0} // Row is ignored, pieces fall
+	placed, moveErr := shared.Coordinate{}, s.checkTurn(seat)
+	if moveErr == nil {
+		placed, moveErr = game.MakeMove(coord)
+	}
+	if moveErr != nil {
 		tmpl, err := template.ParseFiles("base/templates/index.html")
 		if err != nil {
 			http.Error(w, "Error parsing template: "+err.Error(), http.StatusInternalServerError)
 			return
 		}
 
-		var message string
-		if game.IsGameOver() {
-			message = "Game is already over!"
-		} else {
-			message = "Column is full! Try another column."
-		}
-
-		data := createGameData(message, false)
+		message, status := describeMoveError(moveErr)
+		data := createGameData(s, message, false)
+		s.showSeat(r, seat, &data)
+		w.WriteHeader(status)
 		err = tmpl.Execute(w, data)
 		if err != nil {
 			http.Error(w, "Error executing template: "+err.Error(), http.StatusInternalServerError)
@@ -163,8 +324,13 @@ func MoveHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Make the move
-	game.MakeMove(coord)
+	s.publish(shared.EVENT_MOVE, &placed)
+
+	// Let the computer answer right away
+	computerMove, computerPlayed := playComputerTurn(s)
+	if computerPlayed {
+		s.publish(shared.EVENT_MOVE, &computerMove)
+	}
 
 	// Check if this move ended the game
 	showModal := game.IsGameOver()
@@ -179,16 +345,24 @@ func MoveHandler(w http.ResponseWriter, r *http.Request) {
 	var message string
 	if game.IsGameOver() {
 		switch game.GetGameState() {
-		case shared.BLUE_WINS:
-			message = "Player 1 (Blue) wins!"
-		case shared.RED_WINS:
-			message = "Player 2 (Red) wins!"
+		case shared.WON:
+			if *game.GetWinner() == shared.BLUE {
+				message = "Player 1 (Blue) wins!"
+			} else {
+				message = "Player 2 (Red) wins!"
+			}
 		case shared.DRAW:
 			message = "It's a draw!"
 		}
+	} else if computerPlayed {
+		message = fmt.Sprintf("Computer played column %d.", computerMove.Column+1)
 	}
 
-	data := createGameData(message, showModal)
+	data := createGameData(s, message, showModal)
+	s.showSeat(r, seat, &data)
+	if showModal {
+		s.publishOutcome()
+	}
 	err = tmpl.Execute(w, data)
 	if err != nil {
 		http.Error(w, "Error executing template: "+err.Error(), http.StatusInternalServerError)
@@ -202,11 +376,25 @@ func NewGameHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Reset the game
-	game.ResetGame()
+	s, seat, ok := loadGame(w, r)
+	if !ok {
+		return
+	}
+	defer s.mu.Unlock()
+	if s.room != "" && seat < 0 {
+		http.Error(w, "Only the players of the room can do this", http.StatusForbidden)
+		return
+	}
 
-	// Redirect to home page
-	http.Redirect(w, r, "/", http.StatusSeeOther)
+	// Reset the game, switching opponent if one was picked outside a room
+	if s.room == "" {
+		s.setOpponent(r.FormValue("opponent"))
+	}
+	s.game.ResetGame()
+	s.publish(shared.EVENT_BOARD, nil)
+
+	// Redirect to the game page
+	http.Redirect(w, r, s.page(), http.StatusSeeOther)
 }
 
 // ResetScoresHandler resets player scores
@@ -216,9 +404,72 @@ func ResetScoresHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Reset scores
-	player1Score = 0
-	player2Score = 0
+	s, seat, ok := loadGame(w, r)
+	if !ok {
+		return
+	}
+	defer s.mu.Unlock()
+	if s.room != "" && seat < 0 {
+		http.Error(w, "Only the players of the room can do this", http.StatusForbidden)
+		return
+	}
+
+	s.player1Score = 0
+	s.player2Score = 0
+	s.publish(shared.EVENT_SCORES, nil)
+
+	// Redirect to the game page
+	http.Redirect(w, r, s.page(), http.StatusSeeOther)
+}
+
+// UndoHandler takes back the last move of the caller's game
+func UndoHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	s := sessions.Get(w, r)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Taking back a winning move also takes back the point it earned
+	if undone, scored := shared.UndoScored(s.game, s.addScore); undone {
+		// Against the computer, also take back the human move it answered
+		if s.computerToMove() {
+			s.game.Undo()
+		}
+		s.publish(shared.EVENT_BOARD, nil)
+		if scored {
+			s.publish(shared.EVENT_SCORES, nil)
+		}
+	}
+
+	// Redirect to home page
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// RedoHandler replays the last undone move of the caller's game
+func RedoHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	s := sessions.Get(w, r)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if redone, scored := shared.RedoScored(s.game, s.addScore); redone {
+		// Against the computer, also replay its answer
+		if s.computerToMove() && s.game.CanRedo() {
+			_, scored = shared.RedoScored(s.game, s.addScore)
+		}
+		s.publish(shared.EVENT_BOARD, nil)
+		if scored {
+			s.publish(shared.EVENT_SCORES, nil)
+		}
+	}
 
 	// Redirect to home page
 	http.Redirect(w, r, "/", http.StatusSeeOther)
@@ -0,0 +1,322 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"power4/shared"
+)
+
+// TestMain runs the tests from the repository root so templates resolve
+func TestMain(m *testing.M) {
+	if err := os.Chdir("../.."); err != nil {
+		panic(err)
+	}
+	os.Exit(m.Run())
+}
+
+// newSessionCookie issues a session by visiting the home page
+func newSessionCookie(t *testing.T) *http.Cookie {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	HomeHandler(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	for _, cookie := range rec.Result().Cookies() {
+		if cookie.Name == shared.SessionCookieName {
+			return cookie
+		}
+	}
+	t.Fatal("home page did not issue a session cookie")
+	return nil
+}
+
+func postMove(cookie *http.Cookie, column int) *httptest.ResponseRecorder {
+	form := url.Values{"column": {strconv.Itoa(column)}}
+	req := httptest.NewRequest(http.MethodPost, "/move", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.AddCookie(cookie)
+
+	rec := httptest.NewRecorder()
+	MoveHandler(rec, req)
+	return rec
+}
+
+func TestMoveHandlerConcurrent(t *testing.T) {
+	cookie := newSessionCookie(t)
+
+	var wg sync.WaitGroup
+	for worker := 0; worker < 8; worker++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			for i := 0; i < 25; i++ {
+				if rec := postMove(cookie, (worker+i)%7); rec.Code != http.StatusOK && rec.Code != http.StatusConflict {
+					t.Errorf("move returned status %d", rec.Code)
+				}
+			}
+		}(worker)
+	}
+	wg.Wait()
+
+	s := sessions.Lookup(cookie.Value)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	board := s.game.GetBoard()
+	for col := 0; col < 7; col++ {
+		for row := 1; row < 6; row++ {
+			if board[row-1][col] != 0 && board[row][col] == 0 {
+				t.Fatalf("floating piece above row %d column %d", row, col)
+			}
+		}
+	}
+}
+
+func TestMoveHandlerErrors(t *testing.T) {
+	cookie := newSessionCookie(t)
+
+	if rec := postMove(cookie, 7); rec.Code != http.StatusBadRequest {
+		t.Fatalf("out of range column returned status %d", rec.Code)
+	}
+	for i := 0; i < 6; i++ {
+		if rec := postMove(cookie, 0); rec.Code != http.StatusOK {
+			t.Fatalf("move %d returned status %d", i, rec.Code)
+		}
+	}
+	if rec := postMove(cookie, 0); rec.Code != http.StatusConflict {
+		t.Fatalf("full column returned status %d", rec.Code)
+	}
+}
+
+func TestSessionsAreIsolated(t *testing.T) {
+	first := newSessionCookie(t)
+	second := newSessionCookie(t)
+
+	postMove(first, 0)
+
+	if board := sessions.Lookup(second.Value).game.GetBoard(); board[5][0] != 0 {
+		t.Fatal("a move in one session changed another session's board")
+	}
+	if board := sessions.Lookup(first.Value).game.GetBoard(); board[5][0] != 'B' {
+		t.Fatal("move was not applied to the caller's session")
+	}
+}
+
+func TestMoveHandlerPublishesEvents(t *testing.T) {
+	cookie := newSessionCookie(t)
+	s := sessions.Lookup(cookie.Value)
+
+	_, events, cancel := shared.Events.Subscribe(s.id, 0)
+	defer cancel()
+
+	// Four in a row in column 0, answered in column 1
+	for i := 0; i < 7; i++ {
+		if rec := postMove(cookie, i%2); rec.Code != http.StatusOK {
+			t.Fatalf("move %d returned status %d", i, rec.Code)
+		}
+	}
+
+	var types []shared.EventType
+	for len(events) > 0 {
+		types = append(types, (<-events).Type)
+	}
+	want := []shared.EventType{
+		shared.EVENT_MOVE, shared.EVENT_MOVE, shared.EVENT_MOVE, shared.EVENT_MOVE,
+		shared.EVENT_MOVE, shared.EVENT_MOVE, shared.EVENT_MOVE,
+		shared.EVENT_GAME_OVER, shared.EVENT_SCORES,
+	}
+	if !slices.Equal(types, want) {
+		t.Fatalf("got events %v, want %v", types, want)
+	}
+}
+
+func TestComputerOpponent(t *testing.T) {
+	cookie := newSessionCookie(t)
+	post := func(handler http.HandlerFunc, path string, form url.Values) {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.AddCookie(cookie)
+		handler(httptest.NewRecorder(), req)
+	}
+	post(NewGameHandler, "/new", url.Values{"opponent": {"medium"}})
+	s := sessions.Lookup(cookie.Value)
+
+	// Each human move is answered by exactly one computer move
+	for i := 1; i <= 3; i++ {
+		if rec := postMove(cookie, 3); rec.Code != http.StatusOK {
+			t.Fatalf("move %d returned status %d", i, rec.Code)
+		}
+		history := s.game.History()
+		if len(history) != 2*i || history[len(history)-1].Player != shared.RED {
+			t.Fatalf("after move %d expected %d moves ending with the computer, got %v", i, 2*i, history)
+		}
+	}
+
+	// Undo takes back the computer's answer and the move it answered
+	post(UndoHandler, "/undo", nil)
+	if history := s.game.History(); len(history) != 4 || s.game.GetCurrentPlayer() != shared.BLUE {
+		t.Fatalf("expected undo to take back two moves, got %v", history)
+	}
+}
+
+// roomRequest sends a request from the browser holding cookie to a handler
+// mounted under /g/{id}
+func roomRequest(handler http.HandlerFunc, method, id, path string, form url.Values, cookie *http.Cookie) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, "/g/"+id+path, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetPathValue("id", id)
+	if cookie != nil {
+		req.AddCookie(cookie)
+	}
+
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+	return rec
+}
+
+func TestRoom(t *testing.T) {
+	host := newSessionCookie(t)
+	req := httptest.NewRequest(http.MethodPost, "/g/new", nil)
+	req.AddCookie(host)
+	rec := httptest.NewRecorder()
+	CreateRoomHandler(rec, req)
+	id, ok := strings.CutPrefix(rec.Header().Get("Location"), "/g/")
+	if rec.Code != http.StatusSeeOther || !ok {
+		t.Fatalf("creating a room returned %d to %q", rec.Code, rec.Header().Get("Location"))
+	}
+
+	column := func(c int) url.Values { return url.Values{"column": {strconv.Itoa(c)}} }
+	if rec := roomRequest(MoveHandler, http.MethodPost, id, "/move", column(0), host); rec.Code != http.StatusConflict {
+		t.Fatalf("move before the guest joined returned %d, want %d", rec.Code, http.StatusConflict)
+	}
+
+	// Opening the link only offers the free seat, which is taken on request
+	rec = roomRequest(HomeHandler, http.MethodGet, id, "", nil, nil)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "Take the free seat") {
+		t.Fatalf("opening the room returned %d without the free seat", rec.Code)
+	}
+	rec = roomRequest(JoinRoomHandler, http.MethodPost, id, "/join", nil, nil)
+	if rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "/g/"+id {
+		t.Fatalf("joining the room returned %d to %q", rec.Code, rec.Header().Get("Location"))
+	}
+	guest := rec.Result().Cookies()[0]
+
+	// Once the room is full, visitors watch
+	spectator := newSessionCookie(t)
+	rec = roomRequest(HomeHandler, http.MethodGet, id, "", nil, spectator)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "You are watching") || strings.Contains(rec.Body.String(), "Take the free seat") {
+		t.Fatalf("watching a full room returned %d", rec.Code)
+	}
+	roomRequest(JoinRoomHandler, http.MethodPost, id, "/join", nil, spectator)
+	if s, _ := shared.LookupRoom[*session](shared.Rooms, id); s.Info().Taken != 2 {
+		t.Fatal("a spectator took a seat of a full room")
+	}
+
+	tests := []struct {
+		name   string
+		cookie *http.Cookie
+		want   int
+	}{
+		{"guest moving first", guest, http.StatusConflict},
+		{"host", host, http.StatusOK},
+		{"host moving twice", host, http.StatusConflict},
+		{"guest", guest, http.StatusOK},
+	}
+	for _, tt := range tests {
+		if rec := roomRequest(MoveHandler, http.MethodPost, id, "/move", column(3), tt.cookie); rec.Code != tt.want {
+			t.Errorf("%s: move returned %d, want %d", tt.name, rec.Code, tt.want)
+		}
+	}
+
+	// Spectators can neither play nor restart the game, even once it is over
+	s, _ := shared.LookupRoom[*session](shared.Rooms, id)
+	s.mu.Lock()
+	for _, column := range []int{0, 1, 0, 1, 0, 1, 0} {
+		s.game.MakeMove(shared.Coordinate{Column: column})
+	}
+	over := s.game.IsGameOver()
+	s.mu.Unlock()
+	if !over {
+		t.Fatal("expected Player 1 to have won")
+	}
+	spectatorTests := []struct {
+		handler http.HandlerFunc
+		path    string
+	}{
+		{MoveHandler, "/move"},
+		{NewGameHandler, "/new-game"},
+		{ResetScoresHandler, "/reset-scores"},
+	}
+	for _, tt := range spectatorTests {
+		if rec := roomRequest(tt.handler, http.MethodPost, id, tt.path, column(2), spectator); rec.Code != http.StatusForbidden {
+			t.Errorf("%s from a spectator returned %d, want %d", tt.path, rec.Code, http.StatusForbidden)
+		}
+	}
+	if rec := roomRequest(HomeHandler, http.MethodGet, "zzzzzz", "", nil, host); rec.Code != http.StatusNotFound {
+		t.Errorf("unknown room returned %d, want %d", rec.Code, http.StatusNotFound)
+	}
+}
+
+func TestRoomSpectators(t *testing.T) {
+	host := newSessionCookie(t)
+	req := httptest.NewRequest(http.MethodPost, "/g/new", nil)
+	req.AddCookie(host)
+	rec := httptest.NewRecorder()
+	CreateRoomHandler(rec, req)
+	id := strings.TrimPrefix(rec.Header().Get("Location"), "/g/")
+	s, _ := shared.LookupRoom[*session](shared.Rooms, id)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /g/{id}/events", EventsHandler)
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	// follow opens the room's event stream, as the page does
+	follow := func(cookie *http.Cookie) context.CancelFunc {
+		ctx, cancel := context.WithCancel(context.Background())
+		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/g/"+id+"/events", nil)
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { resp.Body.Close() })
+		return cancel
+	}
+	spectators := func(want int) {
+		t.Helper()
+		deadline := time.Now().Add(2 * time.Second)
+		for s.Info().Spectators != want && time.Now().Before(deadline) {
+			time.Sleep(10 * time.Millisecond)
+		}
+		if got := s.Info().Spectators; got != want {
+			t.Fatalf("expected %d spectators, got %d", want, got)
+		}
+	}
+
+	// Only the open streams of browsers without a seat count
+	stopHost := follow(host)
+	stopFirst := follow(nil)
+	stopSecond := follow(newSessionCookie(t))
+	spectators(2)
+	if rec := roomRequest(HomeHandler, http.MethodGet, id, "", nil, host); !strings.Contains(rec.Body.String(), "2 watching") {
+		t.Error("the room page does not count its spectators")
+	}
+
+	stopFirst()
+	spectators(1)
+	stopSecond()
+	stopHost()
+	spectators(0)
+}
@@ -0,0 +1,157 @@
+package handlers
+
+import (
+	"net/http"
+	"slices"
+
+	"power4/shared"
+)
+
+// newRoom hosts a classic game for two browsers, its creator in the first
+// seat
+func newRoom(creator string) *session {
+	room := shared.Rooms.Create(func(id string) shared.Room {
+		s := newSession()
+		s.room = id
+		s.seats = []string{creator, ""}
+		return s
+	})
+	return room.(*session)
+}
+
+// page returns the URL of the game's page
+func (s *session) page() string {
+	if s.room == "" {
+		return "/"
+	}
+	return "/g/" + s.room
+}
+
+// events returns the URL of the game's event stream. A room serves its own,
+// which counts the spectators.
+func (s *session) events() string {
+	if s.room == "" {
+		return "/games/" + s.id + "/events"
+	}
+	return s.page() + "/events"
+}
+
+// Info describes the room for the lobby
+func (s *session) Info() shared.RoomInfo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return shared.RoomInfo{
+		Mode:       "Classic",
+		URL:        s.page(),
+		Seats:      len(s.seats),
+		Taken:      shared.SeatsTaken(s.seats),
+		Spectators: s.spectators,
+	}
+}
+
+// checkTurn returns why the player in seat may not move now, if anything
+// stops them. Only rooms restrict who moves, and spectators never do; the
+// engine still refuses moves once the game is over.
+func (s *session) checkTurn(seat int) error {
+	switch {
+	case s.room == "":
+		return nil
+	case seat < 0:
+		return shared.ErrNotSeated
+	case s.game.IsGameOver():
+		return nil
+	case slices.Contains(s.seats, ""):
+		return shared.ErrRoomNotReady
+	case int(s.game.GetCurrentPlayer()) != seat:
+		return shared.ErrNotYourTurn
+	}
+	return nil
+}
+
+// showSeat tailors the page of a room to the viewer in seat
+func (s *session) showSeat(r *http.Request, seat int, data *GameData) {
+	if s.room == "" {
+		return
+	}
+	data.You = seat + 1
+	data.Spectators = s.spectators
+	data.ShareURL = shared.AbsoluteURL(r, s.page())
+	data.CanMove = data.CanMove && s.checkTurn(seat) == nil
+	data.CanJoin = seat < 0 && slices.Contains(s.seats, "")
+}
+
+// CreateRoomHandler hosts a classic game in a new room and sends its
+// creator there as Player 1
+func CreateRoomHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	s := newRoom(shared.SessionID(w, r))
+	http.Redirect(w, r, s.page(), http.StatusSeeOther)
+}
+
+// JoinRoomHandler gives the caller the free seat of a room, if one is left,
+// and sends them back to its page. Only this explicit action takes a seat,
+// so link previews and prefetches of the page stay spectators.
+func JoinRoomHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	s, seat, ok := loadGame(w, r)
+	if !ok {
+		return
+	}
+	defer s.mu.Unlock()
+
+	if session := shared.SessionID(w, r); seat < 0 {
+		if _, seated := shared.TakeSeat(s.seats, session); seated {
+			s.publish(shared.EVENT_SEATS, nil)
+		}
+	}
+	http.Redirect(w, r, s.page(), http.StatusSeeOther)
+}
+
+// EventsHandler streams the events of a room. A browser without a seat
+// counts as a spectator for as long as its stream stays open.
+func EventsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	s, ok := shared.LookupRoom[*session](shared.Rooms, r.PathValue("id"))
+	if !ok {
+		http.Error(w, "Room not found", http.StatusNotFound)
+		return
+	}
+
+	s.mu.Lock()
+	_, seated := shared.SeatOf(s.seats, r)
+	s.mu.Unlock()
+	if seated {
+		shared.Events.Stream(w, r, s.id, nil)
+		return
+	}
+
+	watching := false
+	watch := func(delta int) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.spectators += delta
+		s.publish(shared.EVENT_SPECTATORS, nil)
+	}
+	defer func() {
+		if watching {
+			watch(-1)
+		}
+	}()
+	shared.Events.Stream(w, r, s.id, func() {
+		watching = true
+		watch(1)
+	})
+}
@@ -1,81 +1,234 @@
 package handlers
 
 import (
+	"errors"
+	"fmt"
 	"html/template"
+	"math/rand/v2"
 	"net/http"
+	"slices"
 	"strconv"
+	"sync"
 
+	"power4/ai"
 	"power4/shared"
 )
 
 // GameData represents the data structure passed to the template
 type GameData struct {
-	Board         [][]int // Board (0=empty, 1=player1, 2=player2)
-	CurrentPlayer int     // 1 or 2
-	Player1Name   string  // Player 1 nickname
-	Player2Name   string  // Player 2 nickname
-	Player1Score  int     // Player 1's score
-	Player2Score  int     // Player 2's score
-	GameOver      bool    // Whether game is finished
-	GameWon       bool    // Whether someone won
-	GameDraw      bool    // Whether it's a draw
-	Winner        int     // Winning player (1 or 2)
-	ShowModal     bool    // Whether to show win/draw modal
-	Message       string  // Status message to display
-	ColumnIndices []int   // Column indices for iteration
-	RowIndices    []int   // Row indices for iteration
-	Rows          int     // Number of rows
-	Columns       int     // Number of columns
-	InverseGravity bool   // Whether gravity is currently inverted
-	TurnCount     int     // Current turn count
+	Board          [][]int      // Board (0=empty, the 1-based player number, then blockers)
+	Players        []PlayerData // Players in turn order
+	PieceClasses   []string     // CSS class of each board value: empty, players, blocker
+	CurrentPlayer  int          // 1-based number of the player to move
+	GameOver       bool         // Whether game is finished
+	GameWon        bool         // Whether someone won
+	GameDraw       bool         // Whether it's a draw
+	Winner         int          // 1-based number of the winning player
+	WinnerName     string       // Nickname of the winning player
+	ShowModal      bool         // Whether to show win/draw modal
+	Message        string       // Status message to display
+	ColumnIndices  []int        // Column indices for iteration
+	RowIndices     []int        // Row indices for iteration
+	Rows           int          // Number of rows
+	Columns        int          // Number of columns
+	WinLength      int          // Pieces in a row needed to win
+	InverseGravity bool         // Whether gravity is currently inverted
+	LockedColumn   int          // Column closed by a twist, -1 when none is
+	FreePlacement  bool         // Whether pieces stay in the clicked cell (gomoku)
+	Cylinder       bool         // Whether lines wrap across the side edges
+	TurnCount      int          // Current turn count
+	WinningCells   [][]bool     // true for the discs of the winning line(s)
+	VsComputer     bool         // Whether Player 2 is played by the computer
+	CanUndo        bool         // Whether a move can be taken back
+	CanRedo        bool         // Whether an undone move can be replayed
+	Events         string       // URL of the game's event stream
+	Room           string       // Room ID, empty for the caller's own game
+	Page           string       // URL of the game's page
+	Actions        string       // Prefix of the form actions
+	ShareURL       string       // Link inviting the other players to the room
+	You            int          // 1-based seat of the viewer in a room, 0 for a spectator
+	Spectators     int          // Browsers watching the room without a seat
+	CanMove        bool         // Whether the viewer may play now
+	CanJoin        bool         // Whether the viewer may take a free seat of the room
+}
+
+// PlayerData describes a player for the game page
+type PlayerData struct {
+	Number int    // 1-based position in turn order
+	Name   string // Nickname
+	Class  string // CSS class of the player's pieces
+	Score  int    // Games won
+}
+
+// PieceColor is a color players can pick for their pieces
+type PieceColor struct {
+	Key   string // Form value
+	Label string // Name shown on the setup page
+	Class string // CSS class painting a piece
+}
+
+// pieceColors lists the colors offered on the setup page; the first ones are
+// the default colors of the players, in turn order
+var pieceColors = []PieceColor{
+	{Key: "red", Label: "Red", Class: "bg-red-500"},
+	{Key: "yellow", Label: "Yellow", Class: "bg-yellow-400"},
+	{Key: "green", Label: "Green", Class: "bg-green-500"},
+	{Key: "purple", Label: "Purple", Class: "bg-purple-500"},
+	{Key: "orange", Label: "Orange", Class: "bg-orange-500"},
+	{Key: "pink", Label: "Pink", Class: "bg-pink-400"},
+	{Key: "cyan", Label: "Cyan", Class: "bg-cyan-400"},
+}
+
+// lookupColor returns the color behind a form value
+func lookupColor(key string) (PieceColor, bool) {
+	for _, color := range pieceColors {
+		if color.Key == key {
+			return color, true
+		}
+	}
+	return PieceColor{}, false
+}
+
+// TwistChoice is a twist offered on the setup page
+type TwistChoice struct {
+	Key   string       // Form value
+	Label string       // Name and effect shown on the setup page
+	Twist shared.Twist // Twist added to the schedule
+}
+
+// twistChoices lists the twists offered on the setup page
+var twistChoices = []TwistChoice{
+	{Key: "flip", Label: "Gravity flip – new pieces fall the other way", Twist: shared.FLIP_GRAVITY},
+	{Key: "rotate", Label: "Board rotation – the board turns upside down and the pieces fall back", Twist: shared.ROTATE_BOARD},
+	{Key: "quarter", Label: "Quarter turn – the board turns on its side, rows become columns", Twist: shared.ROTATE_QUARTER},
+	{Key: "lock", Label: "Column lock – a random column closes for a round", Twist: shared.LOCK_COLUMN},
+	{Key: "swap", Label: "Color swap – every piece goes to the next player", Twist: shared.SWAP_COLORS},
+}
+
+// lookupTwist returns the twist behind a form value
+func lookupTwist(key string) (TwistChoice, bool) {
+	for _, choice := range twistChoices {
+		if choice.Key == key {
+			return choice, true
+		}
+	}
+	return TwistChoice{}, false
+}
+
+// Twist schedule pre-filled on the setup page
+const (
+	defaultTwistInterval = 5  // Turns between two twists
+	defaultTwistChance   = 20 // Percent chance of a twist after each turn
+)
+
+// SetupPlayer describes a player row of the setup form
+type SetupPlayer struct {
+	Number int    // 1-based position in turn order
+	Color  string // Key of the color selected by default
 }
 
 // SetupData represents data for the setup page
 type SetupData struct {
-	Error string // Error message if any
+	Error            string           // Error message if any
+	Players          []SetupPlayer    // One row per possible player
+	MinPlayers       int              // Fewest players in a game
+	Colors           []PieceColor     // Colors to pick from
+	DefaultWinLength int              // Win length used when the form leaves it empty
+	GomokuWinLength  int              // Same, with free placement
+	MinWinLength     int              // Shortest allowed win length
+	Variants         []shared.Variant // Rule sets to pick from
+	DefaultVariant   string           // Rule set selected by default
+	ObstaclePresets  []string         // Preset blocker layouts to pick from
+	ObstacleCount    int              // Blockers pre-filled for a random layout
+	Twists           []TwistChoice    // Twists to pick from
+	TwistInterval    int              // Turns between twists pre-filled in the form
+	TwistChance      int              // Percent chance of a twist pre-filled in the form
 }
 
 // Extended game state with nicknames and custom features
+//
+// ExtendedGameState is safe for concurrent use as long as mu is held while
+// reading or writing any field, so that a move and the scores it earns are
+// applied together.
 type ExtendedGameState struct {
-	game         *shared.Power
-	player1Name  string
-	player2Name  string
-	player1Score int
-	player2Score int
-	turnCount    int // Track turns for gravity inversion
-	inverseGravity bool // Current gravity state
+	mu         sync.Mutex
+	id         string // Game ID of the event stream
+	game       *shared.Power
+	players    []playerInfo  // Players in turn order
+	computer   bool          // Whether Player 2 is played by the computer
+	difficulty ai.Difficulty // Strength of the computer opponent
+	room       string        // Room ID when the game is hosted in a room
+	seats      []string      // Session holding each player of a room
+	spectators int           // Open event streams of browsers without a seat in the room
+}
+
+// playerInfo is the nickname, color and score of a player
+type playerInfo struct {
+	name  string
+	color PieceColor
+	score int
 }
 
-// Global game state (in production, you'd use sessions or database)
-var gameState *ExtendedGameState
+// sessions maps each browser's session cookie to its own game
+var sessions = shared.NewSessionStore(shared.DefaultSessionTTL, newGameState)
 
-func init() {
-	// Initialize with default values (will be set from setup page)
-	gameState = &ExtendedGameState{
-		player1Name:  "Player 1",
-		player2Name:  "Player 2",
-		player1Score: 0,
-		player2Score: 0,
-		turnCount:    0,
-		inverseGravity: false,
+// newGameState creates a session with default values (set from setup page)
+func newGameState() *ExtendedGameState {
+	return &ExtendedGameState{
+		id: shared.NewGameID(),
+		players: []playerInfo{
+			{name: "Player 1", color: pieceColors[0]},
+			{name: "Player 2", color: pieceColors[1]},
+		},
 	}
 }
 
-// convertBoardToTemplate converts the game board to template-friendly format
-func convertBoardToTemplate(gameBoard [][]rune) [][]int {
+// addScore adjusts the score of the player behind a shared.Player
+func (gameState *ExtendedGameState) addScore(player shared.Player, delta int) {
+	gameState.players[player].score += delta
+}
+
+// publish streams an event about the game; move is the cell just played,
+// if any
+func (gameState *ExtendedGameState) publish(eventType shared.EventType, move *shared.Coordinate) {
+	scores := make([]int, len(gameState.players))
+	for i, player := range gameState.players {
+		scores[i] = player.score
+	}
+	shared.Events.PublishGame(gameState.id, eventType, gameState.game, scores, move)
+}
+
+// publishMove streams a move, then the gravity flip it caused, if any
+func (gameState *ExtendedGameState) publishMove(move shared.Coordinate, gravity shared.Gravity) {
+	gameState.publish(shared.EVENT_MOVE, &move)
+	if gameState.game.GetGravity() != gravity {
+		gameState.publish(shared.EVENT_GRAVITY, nil)
+	}
+}
+
+// blockerClass paints the neutral blocker cells
+const blockerClass = "bg-slate-700"
+
+// defaultObstacleCount is the number of blockers of a random layout unless
+// the setup form says otherwise
+const defaultObstacleCount = 4
+
+// convertBoardToTemplate converts the game board to template-friendly format.
+// Blockers come right after the last of the players.
+func convertBoardToTemplate(gameBoard [][]rune, players int) [][]int {
 	board := make([][]int, len(gameBoard))
 	for i := range gameBoard {
 		board[i] = make([]int, len(gameBoard[i]))
 		for j := range gameBoard[i] {
-			switch gameBoard[i][j] {
-			case 0: // Empty
-				board[i][j] = 0
-			case 'B': // Blue player (Player 1)
-				board[i][j] = 1
-			case 'R': // Red player (Player 2)
-				board[i][j] = 2
-			default:
-				board[i][j] = 0
+			// Empty cells stay 0, pieces become the 1-based player number
+			if gameBoard[i][j] == shared.Blocker {
+				board[i][j] = players + 1
+				continue
+			}
+			for player := shared.Player(0); player < shared.MaxPlayers; player++ {
+				if gameBoard[i][j] == player.Piece() {
+					board[i][j] = int(player) + 1
+				}
 			}
 		}
 	}
@@ -83,10 +236,10 @@ func convertBoardToTemplate(gameBoard [][]rune) [][]int {
 }
 
 // createGameData creates the GameData struct for template rendering
-func createGameData(message string, showModal bool) GameData {
+func createGameData(gameState *ExtendedGameState, message string, showModal bool) GameData {
 	rows := gameState.game.Settings.Rows
 	cols := gameState.game.Settings.Columns
-	
+
 	// Generate indices dynamically
 	colIndices := make([]int, cols)
 	rowIndices := make([]int, rows)
@@ -97,13 +250,24 @@ func createGameData(message string, showModal bool) GameData {
 		rowIndices[i] = i
 	}
 
+	players := make([]PlayerData, len(gameState.players))
+	pieceClasses := []string{"bg-white"}
+	for i, player := range gameState.players {
+		players[i] = PlayerData{Number: i + 1, Name: player.name, Class: player.color.Class, Score: player.score}
+		pieceClasses = append(pieceClasses, player.color.Class)
+	}
+	pieceClasses = append(pieceClasses, blockerClass)
+
+	lockedColumn := -1
+	if col, ok := gameState.game.LockedColumn(); ok {
+		lockedColumn = col
+	}
+
 	data := GameData{
-		Board:          convertBoardToTemplate(gameState.game.Board),
+		Board:          convertBoardToTemplate(gameState.game.GetBoard(), len(players)),
+		Players:        players,
+		PieceClasses:   pieceClasses,
 		CurrentPlayer:  int(gameState.game.GetCurrentPlayer()) + 1, // Convert to 1-based
-		Player1Name:    gameState.player1Name,
-		Player2Name:    gameState.player2Name,
-		Player1Score:   gameState.player1Score,
-		Player2Score:   gameState.player2Score,
 		GameOver:       gameState.game.IsGameOver(),
 		GameWon:        false,
 		GameDraw:       false,
@@ -114,24 +278,33 @@ func createGameData(message string, showModal bool) GameData {
 		RowIndices:     rowIndices,
 		Rows:           rows,
 		Columns:        cols,
-		InverseGravity: gameState.inverseGravity,
-		TurnCount:      gameState.turnCount,
+		WinLength:      gameState.game.Settings.WinLength,
+		InverseGravity: gameState.game.GetGravity() == shared.UP,
+		LockedColumn:   lockedColumn,
+		FreePlacement:  gameState.game.GetGravity() == shared.NONE,
+		Cylinder:       gameState.game.Settings.Topology == shared.CYLINDER,
+		TurnCount:      gameState.game.Turns(),
+		WinningCells:   shared.WinningGrid(gameState.game.WinningCells(), rows, cols),
+		VsComputer:     gameState.computer,
+		CanUndo:        gameState.game.CanUndo(),
+		CanRedo:        gameState.game.CanRedo(),
+		Events:         gameState.events(),
+		Room:           gameState.room,
+		Page:           gameState.page(),
+		Actions:        gameState.actions(),
+		CanMove:        !gameState.game.IsGameOver(),
 	}
 
 	// Set game state specific fields
 	if gameState.game.IsGameOver() {
 		switch gameState.game.GetGameState() {
-		case shared.BLUE_WINS:
+		case shared.WON:
+			winner := *gameState.game.GetWinner()
 			data.GameWon = true
-			data.Winner = 1
+			data.Winner = int(winner) + 1 // Convert to 1-based
+			data.WinnerName = gameState.players[winner].name
 			if showModal {
-				gameState.player1Score++
-			}
-		case shared.RED_WINS:
-			data.GameWon = true
-			data.Winner = 2
-			if showModal {
-				gameState.player2Score++
+				gameState.addScore(winner, 1)
 			}
 		case shared.DRAW:
 			data.GameDraw = true
@@ -142,15 +315,125 @@ func createGameData(message string, showModal bool) GameData {
 	return data
 }
 
+// describeMoveError maps an engine error to a user message and HTTP status
+func describeMoveError(err error) (string, int) {
+	switch {
+	case errors.Is(err, shared.ErrGameOver):
+		return "Game is already over!", http.StatusConflict
+	case errors.Is(err, shared.ErrColumnFull):
+		return "Column is full! Try another column.", http.StatusConflict
+	case errors.Is(err, shared.ErrNotYourTurn):
+		return "Wait for your turn.", http.StatusConflict
+	case errors.Is(err, shared.ErrRoomNotReady):
+		return "Share the link: the room is waiting for players.", http.StatusConflict
+	case errors.Is(err, shared.ErrNotSeated):
+		return "Only the players of the room can move.", http.StatusForbidden
+	case errors.Is(err, shared.ErrColumnLocked):
+		return "That column is locked for this round! Try another column.", http.StatusConflict
+	case errors.Is(err, shared.ErrCellOccupied):
+		return "That cell is already taken! Try another one.", http.StatusConflict
+	case errors.Is(err, shared.ErrColumnOutOfRange):
+		return "That column does not exist.", http.StatusBadRequest
+	case errors.Is(err, shared.ErrRowOutOfRange):
+		return "That row does not exist.", http.StatusBadRequest
+	default:
+		return "Move rejected: " + err.Error(), http.StatusBadRequest
+	}
+}
+
+// describeSettingsError maps an error of GameSettings.Validate to a user
+// message
+func describeSettingsError(err error, settings shared.GameSettings) string {
+	switch {
+	case errors.Is(err, shared.ErrEmptyBoard),
+		errors.Is(err, shared.ErrWinLengthTooShort),
+		errors.Is(err, shared.ErrLineTooLong):
+		return fmt.Sprintf("Cannot play Connect-%d on a %d×%d board.", settings.WinLength, settings.Rows, settings.Columns)
+	case errors.Is(err, shared.ErrTooManyObstacles):
+		return fmt.Sprintf("Cannot place %d blockers on a %d×%d board.", settings.Obstacles.Count, settings.Rows, settings.Columns)
+	case errors.Is(err, shared.ErrUnknownObstacles):
+		return fmt.Sprintf("Unknown obstacle layout %q.", settings.Obstacles.Preset)
+	case errors.Is(err, shared.ErrCylinderQuarterTurn):
+		return "A cylinder board cannot turn on its side."
+	case errors.Is(err, shared.ErrInvalidTwists):
+		return "Pick known twists and how often they happen."
+	case errors.Is(err, shared.ErrUnknownVariant):
+		return fmt.Sprintf("Unknown rule set %q.", settings.Variant)
+	case errors.Is(err, shared.ErrPlayerCount):
+		return fmt.Sprintf("A game is played by %d to %d players.", shared.MinPlayers, shared.MaxPlayers)
+	default:
+		return "Invalid settings: " + err.Error()
+	}
+}
+
+// bonusVariants are the rule sets the bonus board can play: pieces are only
+// ever dropped (Pop Out has its own pages). Gravity flips come from the
+// twist schedule.
+var bonusVariants = []string{shared.DefaultVariant, "gravity-settle"}
+
+// describeTwist tells players what a twist did to the board
+func describeTwist(twist shared.TwistEvent) string {
+	switch twist.Twist {
+	case shared.FLIP_GRAVITY:
+		return "🔃 Twist! Gravity flipped, new pieces fall the other way."
+	case shared.ROTATE_BOARD:
+		return "🔄 Twist! The board turned upside down."
+	case shared.LOCK_COLUMN:
+		return fmt.Sprintf("🔒 Twist! Column %d is locked for a round.", twist.Column+1)
+	case shared.SWAP_COLORS:
+		return "🎨 Twist! Every piece changed hands."
+	case shared.ROTATE_QUARTER:
+		return "↪️ Twist! The board turned on its side."
+	}
+	return ""
+}
+
+// variantChoices returns the rule sets offered on the setup page
+func variantChoices() []shared.Variant {
+	var choices []shared.Variant
+	for _, name := range bonusVariants {
+		if v, ok := shared.LookupVariant(name); ok {
+			choices = append(choices, v)
+		}
+	}
+	return choices
+}
+
 // SetupHandler renders the setup page for nicknames and board size
 func SetupHandler(w http.ResponseWriter, r *http.Request) {
+	renderSetup(w, http.StatusOK, "")
+}
+
+// renderSetup renders the setup page, optionally reporting a form error
+func renderSetup(w http.ResponseWriter, status int, message string) {
 	tmpl, err := template.ParseFiles("bonus/templates/setup.html")
 	if err != nil {
 		http.Error(w, "Error parsing template: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	data := SetupData{}
+	players := make([]SetupPlayer, shared.MaxPlayers)
+	for i := range players {
+		players[i] = SetupPlayer{Number: i + 1, Color: pieceColors[i].Key}
+	}
+
+	data := SetupData{
+		Error:            message,
+		Players:          players,
+		MinPlayers:       shared.MinPlayers,
+		Colors:           pieceColors,
+		DefaultWinLength: shared.DefaultWinLength,
+		GomokuWinLength:  shared.GomokuWinLength,
+		MinWinLength:     shared.MinWinLength,
+		Variants:         variantChoices(),
+		DefaultVariant:   shared.DefaultVariant,
+		ObstaclePresets:  shared.ObstaclePresets(),
+		ObstacleCount:    defaultObstacleCount,
+		Twists:           twistChoices,
+		TwistInterval:    defaultTwistInterval,
+		TwistChance:      defaultTwistChance,
+	}
+	w.WriteHeader(status)
 	err = tmpl.Execute(w, data)
 	if err != nil {
 		http.Error(w, "Error executing template: "+err.Error(), http.StatusInternalServerError)
@@ -165,17 +448,63 @@ func StartGameHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	player1Name := r.FormValue("player1")
-	player2Name := r.FormValue("player2")
+	playersStr := r.FormValue("players")
 	rowsStr := r.FormValue("rows")
 	colsStr := r.FormValue("columns")
+	winLengthStr := r.FormValue("winLength")
+	variant := r.FormValue("variant")
+	placement := r.FormValue("placement")
+	topologyStr := r.FormValue("topology")
+	obstaclesStr := r.FormValue("obstacles")
+	twistMode := r.FormValue("twistMode")
+	difficulty, computer := ai.ParseDifficulty(r.FormValue("opponent"))
+	inRoom := r.FormValue("room") == "on"
 
 	// Validate inputs
-	if player1Name == "" {
-		player1Name = "Player 1"
+	playerCount := shared.MinPlayers
+	if playersStr != "" {
+		n, err := strconv.Atoi(playersStr)
+		if err != nil || n < shared.MinPlayers || n > shared.MaxPlayers {
+			renderSetup(w, http.StatusBadRequest, fmt.Sprintf("A game is played by %d to %d players.", shared.MinPlayers, shared.MaxPlayers))
+			return
+		}
+		playerCount = n
+	}
+	if computer && playerCount > shared.MinPlayers {
+		renderSetup(w, http.StatusBadRequest, "The computer only plays two-player games.")
+		return
 	}
-	if player2Name == "" {
-		player2Name = "Player 2"
+	if computer && inRoom {
+		renderSetup(w, http.StatusBadRequest, "A room is played by humans, one browser each.")
+		return
+	}
+
+	players := make([]playerInfo, playerCount)
+	taken := make(map[string]bool)
+	for i := range players {
+		name := r.FormValue(fmt.Sprintf("player%d", i+1))
+		if name == "" {
+			name = fmt.Sprintf("Player %d", i+1)
+			if computer && i == 1 {
+				name = "Computer"
+			}
+		}
+
+		key := r.FormValue(fmt.Sprintf("color%d", i+1))
+		if key == "" {
+			key = pieceColors[i].Key
+		}
+		color, ok := lookupColor(key)
+		if !ok {
+			renderSetup(w, http.StatusBadRequest, fmt.Sprintf("Unknown color %q.", key))
+			return
+		}
+		if taken[key] {
+			renderSetup(w, http.StatusBadRequest, "Each player needs a color of their own.")
+			return
+		}
+		taken[key] = true
+		players[i] = playerInfo{name: name, color: color}
 	}
 
 	rows, err := strconv.Atoi(rowsStr)
@@ -188,27 +517,196 @@ func StartGameHandler(w http.ResponseWriter, r *http.Request) {
 		cols = 7 // Default
 	}
 
-	// Set up game state
-	gameState.player1Name = player1Name
-	gameState.player2Name = player2Name
-	gameState.player1Score = 0
-	gameState.player2Score = 0
-	gameState.turnCount = 0
-	gameState.inverseGravity = false
+	// Without gravity pieces go anywhere, which calls for longer lines
+	gravity := shared.DOWN
+	switch placement {
+	case "", "gravity":
+	case "free":
+		gravity = shared.NONE
+	default:
+		renderSetup(w, http.StatusBadRequest, fmt.Sprintf("Unknown placement %q.", placement))
+		return
+	}
+
+	topology := shared.FLAT
+	switch topologyStr {
+	case "", "flat":
+	case "cylinder":
+		topology = shared.CYLINDER
+	default:
+		renderSetup(w, http.StatusBadRequest, fmt.Sprintf("Unknown board shape %q.", topologyStr))
+		return
+	}
+
+	// A random layout without a seed gets one now, so rematches keep it
+	var obstacles shared.Obstacles
+	switch obstaclesStr {
+	case "", "none":
+	case "random":
+		obstacles.Count = defaultObstacleCount
+		if countStr := r.FormValue("obstacleCount"); countStr != "" {
+			obstacles.Count, err = strconv.Atoi(countStr)
+			if err != nil {
+				renderSetup(w, http.StatusBadRequest, "Number of blockers must be a number.")
+				return
+			}
+		}
+		obstacles.Seed = rand.Uint64()
+		if seedStr := r.FormValue("seed"); seedStr != "" {
+			obstacles.Seed, err = strconv.ParseUint(seedStr, 10, 64)
+			if err != nil {
+				renderSetup(w, http.StatusBadRequest, "Seed must be a positive number.")
+				return
+			}
+		}
+	default:
+		obstacles.Preset = obstaclesStr
+	}
+
+	// Twists come every few turns or by chance; a blank seed is drawn now so
+	// rematches replay the same twists
+	var twists shared.TwistSchedule
+	switch twistMode {
+	case "", "none":
+	case "interval", "random":
+		for _, key := range r.Form["twist"] {
+			choice, ok := lookupTwist(key)
+			if !ok {
+				renderSetup(w, http.StatusBadRequest, fmt.Sprintf("Unknown twist %q.", key))
+				return
+			}
+			twists.Twists = append(twists.Twists, choice.Twist)
+		}
+		if len(twists.Twists) == 0 {
+			renderSetup(w, http.StatusBadRequest, "Pick at least one twist.")
+			return
+		}
+
+		if twistMode == "interval" {
+			twists.Interval = defaultTwistInterval
+			if intervalStr := r.FormValue("twistInterval"); intervalStr != "" {
+				twists.Interval, err = strconv.Atoi(intervalStr)
+				if err != nil || twists.Interval < 1 {
+					renderSetup(w, http.StatusBadRequest, "Turns between twists must be a positive number.")
+					return
+				}
+			}
+		} else {
+			chance := defaultTwistChance
+			if chanceStr := r.FormValue("twistChance"); chanceStr != "" {
+				chance, err = strconv.Atoi(chanceStr)
+				if err != nil || chance < 1 || chance > 100 {
+					renderSetup(w, http.StatusBadRequest, "Twist chance must be between 1 and 100 percent.")
+					return
+				}
+			}
+			twists.Probability = float64(chance) / 100
+		}
+
+		twists.Seed = rand.Uint64()
+		if seedStr := r.FormValue("twistSeed"); seedStr != "" {
+			twists.Seed, err = strconv.ParseUint(seedStr, 10, 64)
+			if err != nil {
+				renderSetup(w, http.StatusBadRequest, "Seed must be a positive number.")
+				return
+			}
+		}
+	default:
+		renderSetup(w, http.StatusBadRequest, fmt.Sprintf("Unknown twist mode %q.", twistMode))
+		return
+	}
+
+	winLength := shared.DefaultWinLength
+	if gravity == shared.NONE {
+		winLength = shared.GomokuWinLength
+	}
+	if winLengthStr != "" {
+		winLength, err = strconv.Atoi(winLengthStr)
+		if err != nil {
+			renderSetup(w, http.StatusBadRequest, "Win length must be a number.")
+			return
+		}
+	}
+
+	if variant == "" {
+		variant = shared.DefaultVariant
+	}
+	if !slices.Contains(bonusVariants, variant) {
+		renderSetup(w, http.StatusBadRequest, fmt.Sprintf("Unknown rule set %q.", variant))
+		return
+	}
 
 	// Create new game with custom settings
 	settings := shared.GameSettings{
-		Rows:    rows,
-		Columns: cols,
+		Rows:      rows,
+		Columns:   cols,
+		WinLength: winLength,
+		Gravity:   gravity,
+		Variant:   variant,
+		Players:   playerCount,
+		Topology:  topology,
+		Obstacles: obstacles,
+		Twists:    twists,
+	}
+	if err := settings.Validate(); err != nil {
+		renderSetup(w, http.StatusBadRequest, describeSettingsError(err, settings))
+		return
+	}
+
+	if inRoom {
+		gameState := newRoom(shared.SessionID(w, r), players, settings)
+		http.Redirect(w, r, gameState.page(), http.StatusSeeOther)
+		return
 	}
+
+	// Set up the caller's game state
+	gameState := sessions.Get(w, r)
+	gameState.mu.Lock()
+	defer gameState.mu.Unlock()
+	gameState.players = players
+	gameState.computer = computer
+	gameState.difficulty = difficulty
 	gameState.game = shared.NewGameInstance(settings)
+	gameState.publish(shared.EVENT_BOARD, nil)
 
 	// Redirect to game page
 	http.Redirect(w, r, "/bonus/game", http.StatusSeeOther)
 }
 
-// GameHandler renders the main game page
+// loadGame returns the game a request is about with its lock held: the
+// room named in the URL, or else the caller's own game. seat is the
+// caller's seat in a room, -1 when they hold none. A missing room is
+// answered with 404.
+func loadGame(w http.ResponseWriter, r *http.Request) (*ExtendedGameState, int, bool) {
+	id := r.PathValue("id")
+	if id == "" {
+		gameState := sessions.Get(w, r)
+		gameState.mu.Lock()
+		return gameState, -1, true
+	}
+
+	gameState, ok := shared.LookupRoom[*ExtendedGameState](shared.Rooms, id)
+	if !ok {
+		http.Error(w, "Room not found", http.StatusNotFound)
+		return nil, -1, false
+	}
+	gameState.mu.Lock()
+	seat, seated := shared.SeatOf(gameState.seats, r)
+	if !seated {
+		seat = -1
+	}
+	return gameState, seat, true
+}
+
+// GameHandler renders the main game page, or the page of a room. Opening
+// the link of a room only watches the game: a seat is taken with
+// JoinRoomHandler.
 func GameHandler(w http.ResponseWriter, r *http.Request) {
+	gameState, seat, ok := loadGame(w, r)
+	if !ok {
+		return
+	}
+	defer gameState.mu.Unlock()
 	if gameState.game == nil {
 		// No game initialized, redirect to setup
 		http.Redirect(w, r, "/bonus/setup", http.StatusSeeOther)
@@ -221,7 +719,8 @@ func GameHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	data := createGameData("", false)
+	data := createGameData(gameState, "", false)
+	gameState.showSeat(r, seat, &data)
 
 	err = tmpl.Execute(w, data)
 	if err != nil {
@@ -230,13 +729,19 @@ func GameHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// MakeMove handles column click moves with inverse gravity support
+// MakeMove handles column clicks, or cell clicks with free placement; in a
+// room, only from the player whose turn it is
 func MakeMove(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
+	gameState, seat, ok := loadGame(w, r)
+	if !ok {
+		return
+	}
+	defer gameState.mu.Unlock()
 	if gameState.game == nil {
 		http.Redirect(w, r, "/bonus/setup", http.StatusSeeOther)
 		return
@@ -254,40 +759,34 @@ func MakeMove(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Check if move is valid (account for inverse gravity)
-	var isValid bool
-	if gameState.game.GetGameState() != shared.ONGOING {
-		isValid = false
-	} else if column < 0 || column >= gameState.game.Settings.Columns {
-		isValid = false
-	} else {
-		// Check if ANY slot in the column is empty
-		// A column is full only when ALL slots are filled
-		hasEmptySlot := false
-		for row := 0; row < gameState.game.Settings.Rows; row++ {
-			if gameState.game.Board[row][column] == 0 {
-				hasEmptySlot = true
-				break
-			}
+	// The row only matters with free placement
+	row := 0
+	if rowStr := r.FormValue("row"); rowStr != "" {
+		row, err = strconv.Atoi(rowStr)
+		if err != nil {
+			http.Error(w, "Invalid row number", http.StatusBadRequest)
+			return
 		}
-		isValid = hasEmptySlot
 	}
 
-	if !isValid {
+	// Make the move, the engine applies the current gravity
+	coord := shared.Coordinate{Column: column, Row: row}
+	gravity := gameState.game.GetGravity()
+	placed, moveErr := shared.Coordinate{}, gameState.checkTurn(seat)
+	if moveErr == nil {
+		placed, moveErr = gameState.game.MakeMove(coord)
+	}
+	if moveErr != nil {
 		tmpl, err := template.ParseFiles("bonus/templates/game.html")
 		if err != nil {
 			http.Error(w, "Error parsing template: "+err.Error(), http.StatusInternalServerError)
 			return
 		}
 
-		var message string
-		if gameState.game.IsGameOver() {
-			message = "Game is already over!"
-		} else {
-			message = "Column is full! Try another column."
-		}
-
-		data := createGameData(message, false)
+		message, status := describeMoveError(moveErr)
+		data := createGameData(gameState, message, false)
+		gameState.showSeat(r, seat, &data)
+		w.WriteHeader(status)
 		err = tmpl.Execute(w, data)
 		if err != nil {
 			http.Error(w, "Error executing template: "+err.Error(), http.StatusInternalServerError)
@@ -295,14 +794,13 @@ func MakeMove(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Make the move with inverse gravity support
-	coord := shared.Coordinate{Column: column, Row: 0}
-	makeMoveWithGravity(coord)
+	gameState.publishMove(placed, gravity)
 
-	// Increment turn count and check for gravity inversion (every 5 turns)
-	gameState.turnCount++
-	if gameState.turnCount%5 == 0 && !gameState.game.IsGameOver() {
-		gameState.inverseGravity = !gameState.inverseGravity
+	// Let the computer answer right away
+	gravity = gameState.game.GetGravity()
+	computerMove, computerPlayed := playComputerTurn(gameState)
+	if computerPlayed {
+		gameState.publishMove(computerMove, gravity)
 	}
 
 	// Check if this move ended the game
@@ -318,172 +816,168 @@ func MakeMove(w http.ResponseWriter, r *http.Request) {
 	var message string
 	if gameState.game.IsGameOver() {
 		switch gameState.game.GetGameState() {
-		case shared.BLUE_WINS:
-			message = gameState.player1Name + " wins!"
-		case shared.RED_WINS:
-			message = gameState.player2Name + " wins!"
+		case shared.WON:
+			message = gameState.players[*gameState.game.GetWinner()].name + " wins!"
 		case shared.DRAW:
 			message = "It's a draw!"
 		}
-	} else if gameState.inverseGravity {
+	} else if twist, ok := gameState.game.LastTwist(); ok {
+		message = describeTwist(twist)
+	} else if gameState.game.GetGravity() == shared.UP {
 		message = "⚠️ Inverse Gravity Active! Pieces fall from bottom to top!"
+	} else if computerPlayed && gameState.game.GetGravity() == shared.NONE {
+		message = fmt.Sprintf("%s played row %d, column %d.", gameState.players[shared.RED].name, computerMove.Row+1, computerMove.Column+1)
+	} else if computerPlayed {
+		message = fmt.Sprintf("%s played column %d.", gameState.players[shared.RED].name, computerMove.Column+1)
+	}
+
+	data := createGameData(gameState, message, showModal)
+	gameState.showSeat(r, seat, &data)
+	if showModal {
+		gameState.publish(shared.EVENT_GAME_OVER, nil)
+		if gameState.game.GetGameState() == shared.WON {
+			gameState.publish(shared.EVENT_SCORES, nil)
+		}
 	}
-
-	data := createGameData(message, showModal)
 	err = tmpl.Execute(w, data)
 	if err != nil {
 		http.Error(w, "Error executing template: "+err.Error(), http.StatusInternalServerError)
 	}
 }
 
-// makeMoveWithGravity makes a move considering inverse gravity
-func makeMoveWithGravity(coord shared.Coordinate) {
-	if gameState.inverseGravity {
-		// Inverse gravity: pieces fall from bottom to top
-		// This means pieces stack from top row downward (inverse of normal)
-		// Find the lowest empty slot from top (first piece goes to top row)
-		for row := 0; row < gameState.game.Settings.Rows; row++ {
-			if gameState.game.Board[row][coord.Column] == 0 {
-				// Place piece at the top-most empty position
-				if gameState.game.IsPlaying == shared.BLUE {
-					gameState.game.Board[row][coord.Column] = 'B'
-				} else {
-					gameState.game.Board[row][coord.Column] = 'R'
-				}
+// computerToMove reports whether the computer should play now
+func computerToMove(gameState *ExtendedGameState) bool {
+	return gameState.computer && !gameState.game.IsGameOver() && gameState.game.GetCurrentPlayer() == shared.RED
+}
 
-				// Check for victory or draw after the move
-				checkGameStateWithInverse(row, coord.Column)
+// playComputerTurn lets the computer answer as Player 2, returning the cell
+// it played and whether it moved
+func playComputerTurn(gameState *ExtendedGameState) (shared.Coordinate, bool) {
+	if !computerToMove(gameState) {
+		return shared.Coordinate{}, false
+	}
 
-				// Switch player only if game is still ongoing
-				if gameState.game.GetGameState() == shared.ONGOING {
-					if gameState.game.IsPlaying == shared.BLUE {
-						gameState.game.IsPlaying = shared.RED
-					} else {
-						gameState.game.IsPlaying = shared.BLUE
-					}
-				}
-				break
-			}
-		}
-	} else {
-		// Normal gravity (top to bottom) - pieces fall and stack from bottom
-		gameState.game.MakeMove(coord)
+	move, err := ai.BestMove(gameState.game, gameState.difficulty)
+	if err != nil {
+		return shared.Coordinate{}, false
 	}
+	placed, err := gameState.game.MakeMove(move)
+	return placed, err == nil
 }
 
-// checkGameStateWithInverse manually checks victory and draw for inverse gravity
-func checkGameStateWithInverse(lastRow, lastCol int) {
-	piece := gameState.game.Board[lastRow][lastCol]
-	
-	// Check for victory (4 in a row)
-	if checkVictoryWithInverse(lastRow, lastCol, piece) {
-		if gameState.game.IsPlaying == shared.BLUE {
-			gameState.game.State = shared.BLUE_WINS
-		} else {
-			gameState.game.State = shared.RED_WINS
-		}
+// NewGameHandler starts a new game with same settings
+func NewGameHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	// Check for draw (board full)
-	// In inverse gravity, pieces fill from top to bottom, so check bottom row
-	// In normal gravity, pieces fill from bottom to top, so check top row
-	checkRow := 0  // Default: normal gravity checks top row
-	if gameState.inverseGravity {
-		checkRow = gameState.game.Settings.Rows - 1  // Inverse gravity checks bottom row
+	gameState, seat, ok := loadGame(w, r)
+	if !ok {
+		return
 	}
-	
-	isFull := true
-	for col := 0; col < gameState.game.Settings.Columns; col++ {
-		if gameState.game.Board[checkRow][col] == 0 {
-			isFull = false
-			break
-		}
+	defer gameState.mu.Unlock()
+	if gameState.game == nil {
+		http.Redirect(w, r, "/bonus/setup", http.StatusSeeOther)
+		return
 	}
-	if isFull {
-		gameState.game.State = shared.DRAW
+	if gameState.room != "" && seat < 0 {
+		http.Error(w, "Only the players of the room can do this", http.StatusForbidden)
+		return
 	}
-}
 
-// checkVictoryWithInverse checks if there are 4 in a row
-func checkVictoryWithInverse(row, col int, piece rune) bool {
-	// Check horizontal
-	if checkDirectionWithInverse(row, col, 0, 1, piece) >= 4 {
-		return true
-	}
+	// Reset the game but keep nicknames and scores
+	gameState.game.ResetGame()
+	gameState.publish(shared.EVENT_BOARD, nil)
 
-	// Check vertical
-	if checkDirectionWithInverse(row, col, 1, 0, piece) >= 4 {
-		return true
-	}
+	// Redirect to game page
+	http.Redirect(w, r, gameState.page(), http.StatusSeeOther)
+}
 
-	// Check diagonal (top-left to bottom-right)
-	if checkDirectionWithInverse(row, col, 1, 1, piece) >= 4 {
-		return true
+// ResetScoresHandler resets player scores
+func ResetScoresHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
 	}
 
-	// Check diagonal (top-right to bottom-left)
-	if checkDirectionWithInverse(row, col, 1, -1, piece) >= 4 {
-		return true
+	gameState, seat, ok := loadGame(w, r)
+	if !ok {
+		return
 	}
-
-	return false
-}
-
-// checkDirectionWithInverse counts consecutive pieces in a given direction
-func checkDirectionWithInverse(row, col, deltaRow, deltaCol int, piece rune) int {
-	count := 1
-
-	// Check in positive direction
-	r, c := row+deltaRow, col+deltaCol
-	for r >= 0 && r < gameState.game.Settings.Rows && c >= 0 && c < gameState.game.Settings.Columns && gameState.game.Board[r][c] == piece {
-		count++
-		r += deltaRow
-		c += deltaCol
+	defer gameState.mu.Unlock()
+	if gameState.room != "" && seat < 0 {
+		http.Error(w, "Only the players of the room can do this", http.StatusForbidden)
+		return
 	}
 
-	// Check in negative direction
-	r, c = row-deltaRow, col-deltaCol
-	for r >= 0 && r < gameState.game.Settings.Rows && c >= 0 && c < gameState.game.Settings.Columns && gameState.game.Board[r][c] == piece {
-		count++
-		r -= deltaRow
-		c -= deltaCol
+	for i := range gameState.players {
+		gameState.players[i].score = 0
 	}
+	gameState.publish(shared.EVENT_SCORES, nil)
 
-	return count
+	http.Redirect(w, r, gameState.page(), http.StatusSeeOther)
 }
 
-// NewGameHandler starts a new game with same settings
-func NewGameHandler(w http.ResponseWriter, r *http.Request) {
+// UndoHandler takes back the last move; the engine restores the turn count
+// and gravity
+func UndoHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
+	gameState := sessions.Get(w, r)
+	gameState.mu.Lock()
+	defer gameState.mu.Unlock()
+
 	if gameState.game == nil {
 		http.Redirect(w, r, "/bonus/setup", http.StatusSeeOther)
 		return
 	}
 
-	// Reset the game but keep nicknames and scores
-	gameState.game.ResetGame()
-	gameState.turnCount = 0
-	gameState.inverseGravity = false
+	// Taking back a winning move also takes back the point it earned
+	if undone, scored := shared.UndoScored(gameState.game, gameState.addScore); undone {
+		// Against the computer, also take back the human move it answered
+		if computerToMove(gameState) {
+			gameState.game.Undo()
+		}
+		gameState.publish(shared.EVENT_BOARD, nil)
+		if scored {
+			gameState.publish(shared.EVENT_SCORES, nil)
+		}
+	}
 
-	// Redirect to game page
 	http.Redirect(w, r, "/bonus/game", http.StatusSeeOther)
 }
 
-// ResetScoresHandler resets player scores
-func ResetScoresHandler(w http.ResponseWriter, r *http.Request) {
+// RedoHandler replays the last undone move; the engine restores the turn
+// count and gravity
+func RedoHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	gameState.player1Score = 0
-	gameState.player2Score = 0
+	gameState := sessions.Get(w, r)
+	gameState.mu.Lock()
+	defer gameState.mu.Unlock()
+
+	if gameState.game == nil {
+		http.Redirect(w, r, "/bonus/setup", http.StatusSeeOther)
+		return
+	}
+
+	if redone, scored := shared.RedoScored(gameState.game, gameState.addScore); redone {
+		// Against the computer, also replay its answer
+		if computerToMove(gameState) && gameState.game.CanRedo() {
+			_, scored = shared.RedoScored(gameState.game, gameState.addScore)
+		}
+		gameState.publish(shared.EVENT_BOARD, nil)
+		if scored {
+			gameState.publish(shared.EVENT_SCORES, nil)
+		}
+	}
 
 	http.Redirect(w, r, "/bonus/game", http.StatusSeeOther)
 }
-
@@ -0,0 +1,380 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"power4/shared"
+)
+
+// TestMain runs the tests from the repository root so templates resolve
+func TestMain(m *testing.M) {
+	if err := os.Chdir("../.."); err != nil {
+		panic(err)
+	}
+	os.Exit(m.Run())
+}
+
+func postForm(handler http.HandlerFunc, path string, cookie *http.Cookie, form url.Values) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if cookie != nil {
+		req.AddCookie(cookie)
+	}
+
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+	return rec
+}
+
+// startGame runs the setup form and returns the issued session cookie
+func startGame(t *testing.T, form url.Values) *http.Cookie {
+	t.Helper()
+
+	rec := postForm(StartGameHandler, "/bonus/start-game", nil, form)
+	for _, cookie := range rec.Result().Cookies() {
+		if cookie.Name == shared.SessionCookieName {
+			return cookie
+		}
+	}
+	t.Fatal("start-game did not issue a session cookie")
+	return nil
+}
+
+func TestMakeMoveConcurrent(t *testing.T) {
+	cookie := startGame(t, url.Values{"player1": {"Ann"}, "player2": {"Bob"}, "rows": {"8"}, "columns": {"9"}})
+
+	var wg sync.WaitGroup
+	for worker := 0; worker < 8; worker++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			for i := 0; i < 25; i++ {
+				form := url.Values{"column": {strconv.Itoa((worker + i) % 9)}}
+				if rec := postForm(MakeMove, "/bonus/move", cookie, form); rec.Code != http.StatusOK && rec.Code != http.StatusConflict {
+					t.Errorf("move returned status %d", rec.Code)
+				}
+			}
+		}(worker)
+	}
+	wg.Wait()
+
+	gameState := sessions.Lookup(cookie.Value)
+	gameState.mu.Lock()
+	defer gameState.mu.Unlock()
+
+	pieces := 0
+	for _, row := range gameState.game.GetBoard() {
+		for _, cell := range row {
+			if cell != 0 {
+				pieces++
+			}
+		}
+	}
+	if turns := gameState.game.Turns(); pieces != turns {
+		t.Fatalf("board holds %d pieces after %d turns", pieces, turns)
+	}
+}
+
+func TestMakeMoveFreePlacement(t *testing.T) {
+	cookie := startGame(t, url.Values{"placement": {"free"}, "rows": {"9"}, "columns": {"9"}, "opponent": {"medium"}})
+
+	gameState := sessions.Lookup(cookie.Value)
+	if winLength := gameState.game.GetSettings().WinLength; winLength != shared.GomokuWinLength {
+		t.Fatalf("expected a default win length of %d, got %d", shared.GomokuWinLength, winLength)
+	}
+
+	form := url.Values{"column": {"4"}, "row": {"2"}}
+	if rec := postForm(MakeMove, "/bonus/move", cookie, form); rec.Code != http.StatusOK {
+		t.Fatalf("move returned status %d", rec.Code)
+	}
+	if board := gameState.game.GetBoard(); board[2][4] != shared.BLUE.Piece() {
+		t.Fatal("expected the piece to stay in the clicked cell")
+	}
+	if turns := gameState.game.Turns(); turns != 2 {
+		t.Fatalf("expected the computer to answer, got %d turns", turns)
+	}
+	if rec := postForm(MakeMove, "/bonus/move", cookie, form); rec.Code != http.StatusConflict {
+		t.Fatalf("playing a taken cell returned status %d", rec.Code)
+	}
+
+	rec := postForm(StartGameHandler, "/bonus/start-game", nil, url.Values{"placement": {"sideways"}})
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("unknown placement returned status %d", rec.Code)
+	}
+}
+
+func TestStartGameThreePlayers(t *testing.T) {
+	cookie := startGame(t, url.Values{
+		"players": {"3"},
+		"player1": {"Ann"}, "player2": {"Bob"}, "player3": {"Cy"},
+		"color1": {"green"}, "color2": {"red"}, "color3": {"purple"},
+		"variant": {shared.DefaultVariant},
+	})
+
+	for col := 0; col < 3; col++ {
+		if rec := postForm(MakeMove, "/bonus/move", cookie, url.Values{"column": {strconv.Itoa(col)}}); rec.Code != http.StatusOK {
+			t.Fatalf("move returned status %d", rec.Code)
+		}
+	}
+	gameState := sessions.Lookup(cookie.Value)
+	if board := gameState.game.GetBoard(); board[5][2] != shared.GREEN.Piece() {
+		t.Fatalf("expected the third player's piece in column 2, got %q", board[5][2])
+	}
+	if player := gameState.game.GetCurrentPlayer(); player != shared.BLUE {
+		t.Fatalf("expected the turn to come back to the first player, got %v", player)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/bonus/game", nil)
+	req.AddCookie(cookie)
+	rec := httptest.NewRecorder()
+	GameHandler(rec, req)
+	if body := rec.Body.String(); !strings.Contains(body, "Cy") || !strings.Contains(body, "bg-purple-500") {
+		t.Fatal("game page does not show the third player")
+	}
+
+	for _, form := range []url.Values{
+		{"players": {"5"}},
+		{"players": {"3"}, "opponent": {"easy"}},
+		{"color1": {"red"}, "color2": {"red"}},
+		{"color1": {"plaid"}},
+	} {
+		if rec := postForm(StartGameHandler, "/bonus/start-game", nil, form); rec.Code != http.StatusBadRequest {
+			t.Errorf("%v: expected status 400, got %d", form, rec.Code)
+		}
+	}
+}
+
+func TestStartGameCylinder(t *testing.T) {
+	cookie := startGame(t, url.Values{"topology": {"cylinder"}, "variant": {shared.DefaultVariant}})
+
+	// Player 1 lines up columns 5, 6, 0 and 1 across the joined edges
+	for i, col := range []int{5, 6, 0, 1} {
+		postForm(MakeMove, "/bonus/move", cookie, url.Values{"column": {strconv.Itoa(col)}})
+		if i < 3 {
+			postForm(MakeMove, "/bonus/move", cookie, url.Values{"column": {strconv.Itoa(3 + i%2)}})
+		}
+	}
+	if winner := sessions.Lookup(cookie.Value).game.GetWinner(); winner == nil || *winner != shared.BLUE {
+		t.Fatal("expected player 1 to win across the edges")
+	}
+
+	rec := postForm(StartGameHandler, "/bonus/start-game", nil, url.Values{"topology": {"torus"}})
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("unknown topology returned status %d", rec.Code)
+	}
+}
+
+func TestStartGameObstacles(t *testing.T) {
+	cookie := startGame(t, url.Values{"obstacles": {"pillars"}})
+
+	// The pillar in column 1 fills the two bottom rows, the piece lands on it
+	rec := postForm(MakeMove, "/bonus/move", cookie, url.Values{"column": {"1"}})
+	board := sessions.Lookup(cookie.Value).game.GetBoard()
+	if board[5][1] != shared.Blocker || board[3][1] != shared.BLUE.Piece() {
+		t.Fatalf("expected the piece to stack on the pillar, got column %q", []rune{board[3][1], board[4][1], board[5][1]})
+	}
+	if !strings.Contains(rec.Body.String(), blockerClass) {
+		t.Fatal("expected the blockers to be drawn on the board")
+	}
+
+	// The same seed gives the same random layout
+	form := url.Values{"obstacles": {"random"}, "obstacleCount": {"6"}, "seed": {"42"}}
+	first := sessions.Lookup(startGame(t, form).Value).game.GetBoard()
+	second := sessions.Lookup(startGame(t, form).Value).game.GetBoard()
+	if fmt.Sprint(first) != fmt.Sprint(second) {
+		t.Fatal("expected the same seed to give the same layout")
+	}
+
+	for _, form := range []url.Values{
+		{"obstacles": {"maze"}},
+		{"obstacles": {"random"}, "obstacleCount": {"100"}},
+		{"obstacles": {"random"}, "seed": {"-1"}},
+	} {
+		if rec := postForm(StartGameHandler, "/bonus/start-game", nil, form); rec.Code != http.StatusBadRequest {
+			t.Fatalf("%v returned status %d", form, rec.Code)
+		}
+	}
+}
+
+func TestComputerOpponent(t *testing.T) {
+	cookie := startGame(t, url.Values{"opponent": {"medium"}})
+	game := sessions.Lookup(cookie.Value).game
+
+	// Each human move is answered by exactly one computer move
+	for i := 1; i <= 3; i++ {
+		if rec := postForm(MakeMove, "/bonus/move", cookie, url.Values{"column": {"3"}}); rec.Code != http.StatusOK {
+			t.Fatalf("move %d returned status %d", i, rec.Code)
+		}
+		history := game.History()
+		if len(history) != 2*i || history[len(history)-1].Player != shared.RED {
+			t.Fatalf("after move %d expected %d moves ending with the computer, got %v", i, 2*i, history)
+		}
+	}
+
+	// Undo takes back the computer's answer and the move it answered
+	postForm(UndoHandler, "/bonus/undo", cookie, nil)
+	if history := game.History(); len(history) != 4 || game.GetCurrentPlayer() != shared.BLUE {
+		t.Fatalf("expected undo to take back two moves, got %v", history)
+	}
+}
+
+func TestStartGameSettingsErrors(t *testing.T) {
+	tests := []struct {
+		form    url.Values
+		message string
+	}{
+		{url.Values{"winLength": {"9"}}, "Cannot play Connect-9 on a 6×7 board."},
+		{url.Values{"obstacles": {"random"}, "obstacleCount": {"30"}}, "Cannot place 30 blockers on a 6×7 board."},
+		{url.Values{"obstacles": {"maze"}}, "Unknown obstacle layout"},
+		{url.Values{"topology": {"cylinder"}, "twistMode": {"interval"}, "twist": {"quarter"}}, "A cylinder board cannot turn on its side."},
+	}
+	for _, tt := range tests {
+		rec := postForm(StartGameHandler, "/bonus/start-game", nil, tt.form)
+		if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), tt.message) {
+			t.Errorf("%v: expected status 400 with %q, got %d", tt.form, tt.message, rec.Code)
+		}
+	}
+}
+
+func TestMakeMoveGravitySettle(t *testing.T) {
+	cookie := startGame(t, url.Values{"variant": {"gravity-settle"}})
+
+	for _, col := range []string{"0", "1", "0", "1", "0"} {
+		postForm(MakeMove, "/bonus/move", cookie, url.Values{"column": {col}})
+	}
+	board := sessions.Lookup(cookie.Value).game.GetBoard()
+	if board[0][0] != shared.BLUE.Piece() || board[5][0] != 0 {
+		t.Fatalf("expected column 0 to fall to the top, got %q", board)
+	}
+}
+
+func TestMakeMoveGravitySettleTwists(t *testing.T) {
+	// The setup form as it comes, with the flip twist every 5 turns
+	cookie := startGame(t, url.Values{
+		"players":       {"2"},
+		"opponent":      {"human"},
+		"variant":       {"gravity-settle"},
+		"twistMode":     {"interval"},
+		"twist":         {"flip"},
+		"twistInterval": {"5"},
+		"twistChance":   {"20"},
+		"placement":     {"gravity"},
+		"topology":      {"flat"},
+		"obstacles":     {"none"},
+		"obstacleCount": {"4"},
+		"rows":          {"6"},
+		"columns":       {"7"},
+	})
+
+	for _, col := range []string{"0", "1", "0", "1", "0", "2"} {
+		postForm(MakeMove, "/bonus/move", cookie, url.Values{"column": {col}})
+	}
+	game := sessions.Lookup(cookie.Value).game
+	board := game.GetBoard()
+	if game.GetGravity() != shared.UP || board[0][0] != shared.BLUE.Piece() || board[5][0] != 0 || board[0][2] != shared.RED.Piece() {
+		t.Fatalf("expected gravity UP with every piece at the top, got %v and %q", game.GetGravity(), board)
+	}
+}
+
+func TestStartGameTwists(t *testing.T) {
+	cookie := startGame(t, url.Values{"twistMode": {"interval"}, "twist": {"lock"}, "twistInterval": {"2"}, "twistSeed": {"3"}})
+
+	postForm(MakeMove, "/bonus/move", cookie, url.Values{"column": {"0"}})
+	rec := postForm(MakeMove, "/bonus/move", cookie, url.Values{"column": {"0"}})
+	col, ok := sessions.Lookup(cookie.Value).game.LockedColumn()
+	if !ok {
+		t.Fatal("expected a column to be locked after two turns")
+	}
+	if !strings.Contains(rec.Body.String(), fmt.Sprintf("Column %d is locked", col+1)) {
+		t.Fatal("expected the page to announce the twist")
+	}
+	if rec := postForm(MakeMove, "/bonus/move", cookie, url.Values{"column": {strconv.Itoa(col)}}); rec.Code != http.StatusConflict {
+		t.Fatalf("move into the locked column returned status %d", rec.Code)
+	}
+
+	for _, form := range []url.Values{
+		{"twistMode": {"interval"}},
+		{"twistMode": {"interval"}, "twist": {"earthquake"}},
+		{"twistMode": {"interval"}, "twist": {"flip"}, "twistInterval": {"0"}},
+		{"twistMode": {"random"}, "twist": {"flip"}, "twistChance": {"150"}},
+		{"twistMode": {"sometimes"}},
+	} {
+		if rec := postForm(StartGameHandler, "/bonus/start-game", nil, form); rec.Code != http.StatusBadRequest {
+			t.Fatalf("%v returned status %d", form, rec.Code)
+		}
+	}
+}
+
+func TestMakeMoveQuarterTurn(t *testing.T) {
+	cookie := startGame(t, url.Values{"twistMode": {"interval"}, "twist": {"quarter"}, "twistInterval": {"3"}, "rows": {"5"}, "columns": {"8"}})
+
+	var rec *httptest.ResponseRecorder
+	for _, col := range []string{"0", "1", "2"} {
+		rec = postForm(MakeMove, "/bonus/move", cookie, url.Values{"column": {col}})
+	}
+	if settings := sessions.Lookup(cookie.Value).game.GetSettings(); settings.Rows != 8 || settings.Columns != 5 {
+		t.Fatalf("expected an 8x5 board after a quarter turn, got %dx%d", settings.Rows, settings.Columns)
+	}
+	if !strings.Contains(rec.Body.String(), "repeat(5, minmax(0, 1fr))") {
+		t.Fatal("expected the page to draw 5 columns")
+	}
+
+	form := url.Values{"topology": {"cylinder"}, "twistMode": {"interval"}, "twist": {"quarter"}}
+	if rec := postForm(StartGameHandler, "/bonus/start-game", nil, form); rec.Code != http.StatusBadRequest {
+		t.Fatalf("turning cylinder returned status %d", rec.Code)
+	}
+}
+
+// roomRequest sends a request from the browser holding cookie to a handler
+// mounted under /bonus/g/{id}
+func roomRequest(handler http.HandlerFunc, method, id string, cookie *http.Cookie) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, "/bonus/g/"+id, nil)
+	req.SetPathValue("id", id)
+	if cookie != nil {
+		req.AddCookie(cookie)
+	}
+
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+	return rec
+}
+
+func TestRoomJoin(t *testing.T) {
+	rec := postForm(StartGameHandler, "/bonus/start-game", nil, url.Values{"room": {"on"}})
+	id, ok := strings.CutPrefix(rec.Header().Get("Location"), "/bonus/g/")
+	if rec.Code != http.StatusSeeOther || !ok {
+		t.Fatalf("creating a room returned %d to %q", rec.Code, rec.Header().Get("Location"))
+	}
+
+	// Opening the link only offers the free seat, which is taken on request
+	rec = roomRequest(GameHandler, http.MethodGet, id, nil)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "Take the free seat") {
+		t.Fatalf("opening the room returned %d without the free seat", rec.Code)
+	}
+	rec = roomRequest(JoinRoomHandler, http.MethodPost, id, nil)
+	if rec.Code != http.StatusSeeOther {
+		t.Fatalf("joining the room returned %d", rec.Code)
+	}
+	guest := rec.Result().Cookies()[0]
+	rec = roomRequest(GameHandler, http.MethodGet, id, guest)
+	if !strings.Contains(rec.Body.String(), "You are Player 2") {
+		t.Fatal("expected the guest to hold the second seat")
+	}
+
+	// Once the room is full, visitors only watch
+	rec = roomRequest(GameHandler, http.MethodGet, id, nil)
+	if !strings.Contains(rec.Body.String(), "You are watching") || strings.Contains(rec.Body.String(), "Take the free seat") {
+		t.Fatal("expected a visitor of a full room to watch")
+	}
+	if rec := roomRequest(JoinRoomHandler, http.MethodGet, id, guest); rec.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("joining with GET returned %d", rec.Code)
+	}
+}
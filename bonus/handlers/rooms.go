@@ -0,0 +1,156 @@
+package handlers
+
+import (
+	"net/http"
+	"slices"
+
+	"power4/shared"
+)
+
+// newRoom hosts a bonus game played from one browser per player, its
+// creator in the first seat
+func newRoom(creator string, players []playerInfo, settings shared.GameSettings) *ExtendedGameState {
+	room := shared.Rooms.Create(func(id string) shared.Room {
+		gameState := newGameState()
+		gameState.room = id
+		gameState.players = players
+		gameState.game = shared.NewGameInstance(settings)
+		gameState.seats = make([]string, len(players))
+		gameState.seats[0] = creator
+		return gameState
+	})
+	return room.(*ExtendedGameState)
+}
+
+// page returns the URL of the game's page
+func (gameState *ExtendedGameState) page() string {
+	if gameState.room == "" {
+		return "/bonus/game"
+	}
+	return "/bonus/g/" + gameState.room
+}
+
+// actions returns the prefix of the game's form actions
+func (gameState *ExtendedGameState) actions() string {
+	if gameState.room == "" {
+		return "/bonus"
+	}
+	return "/bonus/g/" + gameState.room
+}
+
+// events returns the URL of the game's event stream. A room serves its own,
+// which counts the spectators.
+func (gameState *ExtendedGameState) events() string {
+	if gameState.room == "" {
+		return "/games/" + gameState.id + "/events"
+	}
+	return gameState.page() + "/events"
+}
+
+// Info describes the room for the lobby
+func (gameState *ExtendedGameState) Info() shared.RoomInfo {
+	gameState.mu.Lock()
+	defer gameState.mu.Unlock()
+
+	return shared.RoomInfo{
+		Mode:       "Bonus",
+		URL:        gameState.page(),
+		Seats:      len(gameState.seats),
+		Taken:      shared.SeatsTaken(gameState.seats),
+		Spectators: gameState.spectators,
+	}
+}
+
+// checkTurn returns why the player in seat may not move now, if anything
+// stops them. Only rooms restrict who moves, and spectators never do; the
+// engine still refuses moves once the game is over.
+func (gameState *ExtendedGameState) checkTurn(seat int) error {
+	switch {
+	case gameState.room == "":
+		return nil
+	case seat < 0:
+		return shared.ErrNotSeated
+	case gameState.game.IsGameOver():
+		return nil
+	case slices.Contains(gameState.seats, ""):
+		return shared.ErrRoomNotReady
+	case int(gameState.game.GetCurrentPlayer()) != seat:
+		return shared.ErrNotYourTurn
+	}
+	return nil
+}
+
+// showSeat tailors the page of a room to the viewer in seat
+func (gameState *ExtendedGameState) showSeat(r *http.Request, seat int, data *GameData) {
+	if gameState.room == "" {
+		return
+	}
+	data.You = seat + 1
+	data.Spectators = gameState.spectators
+	data.ShareURL = shared.AbsoluteURL(r, gameState.page())
+	data.CanMove = data.CanMove && gameState.checkTurn(seat) == nil
+	data.CanJoin = seat < 0 && slices.Contains(gameState.seats, "")
+}
+
+// JoinRoomHandler gives the caller the next free seat of a room, if one is
+// left, and sends them back to its page. Only this explicit action takes a
+// seat, so link previews and prefetches of the page stay spectators.
+func JoinRoomHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	gameState, seat, ok := loadGame(w, r)
+	if !ok {
+		return
+	}
+	defer gameState.mu.Unlock()
+
+	if session := shared.SessionID(w, r); seat < 0 {
+		if _, seated := shared.TakeSeat(gameState.seats, session); seated {
+			gameState.publish(shared.EVENT_SEATS, nil)
+		}
+	}
+	http.Redirect(w, r, gameState.page(), http.StatusSeeOther)
+}
+
+// EventsHandler streams the events of a room. A browser without a seat
+// counts as a spectator for as long as its stream stays open.
+func EventsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	gameState, ok := shared.LookupRoom[*ExtendedGameState](shared.Rooms, r.PathValue("id"))
+	if !ok {
+		http.Error(w, "Room not found", http.StatusNotFound)
+		return
+	}
+
+	gameState.mu.Lock()
+	_, seated := shared.SeatOf(gameState.seats, r)
+	gameState.mu.Unlock()
+	if seated {
+		shared.Events.Stream(w, r, gameState.id, nil)
+		return
+	}
+
+	watching := false
+	watch := func(delta int) {
+		gameState.mu.Lock()
+		defer gameState.mu.Unlock()
+		gameState.spectators += delta
+		gameState.publish(shared.EVENT_SPECTATORS, nil)
+	}
+	defer func() {
+		if watching {
+			watch(-1)
+		}
+	}()
+	shared.Events.Stream(w, r, gameState.id, func() {
+		watching = true
+		watch(1)
+	})
+}
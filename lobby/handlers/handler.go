@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"html/template"
+	"net/http"
+	"time"
+
+	"power4/shared"
+)
+
+// PageData represents the data structure passed to the lobby template
+type PageData struct {
+	Rooms   []RoomData // Rooms waiting for players, oldest first
+	Playing []RoomData // Full rooms, open to spectators, oldest first
+}
+
+// RoomData describes a room for the lobby template
+type RoomData struct {
+	ID         string        // Room ID
+	Mode       string        // Game mode
+	URL        string        // Page of the room: a seat while one is free, else a view
+	Seats      int           // Players the game needs
+	Taken      int           // Seats already held
+	Spectators int           // Browsers watching the room
+	Waiting    time.Duration // Time since the room was created
+}
+
+// LobbyHandler lists the rooms waiting for players and the games to watch,
+// and offers to host a room
+func LobbyHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	tmpl, err := template.ParseFiles("lobby/templates/index.html")
+	if err != nil {
+		http.Error(w, "Error parsing template: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var data PageData
+	for _, room := range shared.Rooms.List() {
+		listing := RoomData{
+			ID:         room.ID,
+			Mode:       room.Mode,
+			URL:        room.URL,
+			Seats:      room.Seats,
+			Taken:      room.Taken,
+			Spectators: room.Spectators,
+			Waiting:    time.Since(room.Created).Round(time.Second),
+		}
+		if room.Open() {
+			data.Rooms = append(data.Rooms, listing)
+		} else {
+			data.Playing = append(data.Playing, listing)
+		}
+	}
+	err = tmpl.Execute(w, data)
+	if err != nil {
+		http.Error(w, "Error executing template: "+err.Error(), http.StatusInternalServerError)
+	}
+}
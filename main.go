@@ -1,9 +1,15 @@
 package main
 
 import (
+	"flag"
 	"net/http"
+	apiHandlers "power4/api/handlers"
 	"power4/base/handlers"
 	bonusHandlers "power4/bonus/handlers"
+	lobbyHandlers "power4/lobby/handlers"
+	onlineHandlers "power4/online/handlers"
+	pop10Handlers "power4/pop10/handlers"
+	popoutHandlers "power4/popout/handlers"
 	"power4/shared"
 )
 
@@ -13,9 +19,10 @@ var routes = []shared.Route{
 		Path:    "/health",
 		Handler: func(w http.ResponseWriter, r *http.Request) { http.Error(w, "OK", http.StatusOK) },
 	},
+	// {$} keeps the home page from catching every other GET path
 	{
 		Method:  "GET",
-		Path:    "/",
+		Path:    "/{$}",
 		Handler: handlers.HomeHandler,
 	},
 	{
@@ -33,6 +40,51 @@ var routes = []shared.Route{
 		Path:    "/reset-scores",
 		Handler: handlers.ResetScoresHandler,
 	},
+	{
+		Method:  "POST",
+		Path:    "/undo",
+		Handler: handlers.UndoHandler,
+	},
+	{
+		Method:  "POST",
+		Path:    "/redo",
+		Handler: handlers.RedoHandler,
+	},
+	{
+		Method:  "POST",
+		Path:    "/g/new",
+		Handler: handlers.CreateRoomHandler,
+	},
+	{
+		Method:  "GET",
+		Path:    "/g/{id}",
+		Handler: handlers.HomeHandler,
+	},
+	{
+		Method:  "POST",
+		Path:    "/g/{id}/join",
+		Handler: handlers.JoinRoomHandler,
+	},
+	{
+		Method:  "GET",
+		Path:    "/g/{id}/events",
+		Handler: handlers.EventsHandler,
+	},
+	{
+		Method:  "POST",
+		Path:    "/g/{id}/move",
+		Handler: handlers.MoveHandler,
+	},
+	{
+		Method:  "POST",
+		Path:    "/g/{id}/new-game",
+		Handler: handlers.NewGameHandler,
+	},
+	{
+		Method:  "POST",
+		Path:    "/g/{id}/reset-scores",
+		Handler: handlers.ResetScoresHandler,
+	},
 	{
 		Method:  "GET",
 		Path:    "/bonus/setup",
@@ -63,6 +115,162 @@ var routes = []shared.Route{
 		Path:    "/bonus/reset-scores",
 		Handler: bonusHandlers.ResetScoresHandler,
 	},
+	{
+		Method:  "POST",
+		Path:    "/bonus/undo",
+		Handler: bonusHandlers.UndoHandler,
+	},
+	{
+		Method:  "POST",
+		Path:    "/bonus/redo",
+		Handler: bonusHandlers.RedoHandler,
+	},
+	{
+		Method:  "GET",
+		Path:    "/bonus/g/{id}",
+		Handler: bonusHandlers.GameHandler,
+	},
+	{
+		Method:  "POST",
+		Path:    "/bonus/g/{id}/join",
+		Handler: bonusHandlers.JoinRoomHandler,
+	},
+	{
+		Method:  "GET",
+		Path:    "/bonus/g/{id}/events",
+		Handler: bonusHandlers.EventsHandler,
+	},
+	{
+		Method:  "POST",
+		Path:    "/bonus/g/{id}/move",
+		Handler: bonusHandlers.MakeMove,
+	},
+	{
+		Method:  "POST",
+		Path:    "/bonus/g/{id}/new-game",
+		Handler: bonusHandlers.NewGameHandler,
+	},
+	{
+		Method:  "POST",
+		Path:    "/bonus/g/{id}/reset-scores",
+		Handler: bonusHandlers.ResetScoresHandler,
+	},
+	{
+		Method:  "GET",
+		Path:    "/popout",
+		Handler: popoutHandlers.HomeHandler,
+	},
+	{
+		Method:  "POST",
+		Path:    "/popout/move",
+		Handler: popoutHandlers.MoveHandler,
+	},
+	{
+		Method:  "POST",
+		Path:    "/popout/new-game",
+		Handler: popoutHandlers.NewGameHandler,
+	},
+	{
+		Method:  "POST",
+		Path:    "/popout/reset-scores",
+		Handler: popoutHandlers.ResetScoresHandler,
+	},
+	{
+		Method:  "POST",
+		Path:    "/popout/undo",
+		Handler: popoutHandlers.UndoHandler,
+	},
+	{
+		Method:  "POST",
+		Path:    "/popout/redo",
+		Handler: popoutHandlers.RedoHandler,
+	},
+	{
+		Method:  "GET",
+		Path:    "/pop10",
+		Handler: pop10Handlers.HomeHandler,
+	},
+	{
+		Method:  "POST",
+		Path:    "/pop10/move",
+		Handler: pop10Handlers.MoveHandler,
+	},
+	{
+		Method:  "POST",
+		Path:    "/pop10/new-game",
+		Handler: pop10Handlers.NewGameHandler,
+	},
+	{
+		Method:  "POST",
+		Path:    "/pop10/reset-scores",
+		Handler: pop10Handlers.ResetScoresHandler,
+	},
+	{
+		Method:  "POST",
+		Path:    "/pop10/undo",
+		Handler: pop10Handlers.UndoHandler,
+	},
+	{
+		Method:  "POST",
+		Path:    "/pop10/redo",
+		Handler: pop10Handlers.RedoHandler,
+	},
+	{
+		Method:  "GET",
+		Path:    "/online",
+		Handler: onlineHandlers.LobbyHandler,
+	},
+	{
+		Method:  "POST",
+		Path:    "/online/new",
+		Handler: onlineHandlers.CreateGameHandler,
+	},
+	{
+		Method:  "GET",
+		Path:    "/online/{id}",
+		Handler: onlineHandlers.GameHandler,
+	},
+	{
+		Method:  "POST",
+		Path:    "/online/{id}/join",
+		Handler: onlineHandlers.JoinHandler,
+	},
+	{
+		Method:  "GET",
+		Path:    "/online/{id}/ws",
+		Handler: onlineHandlers.SocketHandler,
+	},
+	{
+		Method:  "GET",
+		Path:    "/lobby",
+		Handler: lobbyHandlers.LobbyHandler,
+	},
+	{
+		Method:  "GET",
+		Path:    "/games/{id}/events",
+		Handler: shared.Events.ServeHTTP,
+	},
+	// API endpoints check the method themselves to answer in JSON
+	{
+		Path:    "/api/v1/games",
+		Handler: apiHandlers.GamesHandler,
+	},
+	{
+		Path:    "/api/v1/games/{id}",
+		Handler: apiHandlers.GameHandler,
+	},
+	{
+		Path:    "/api/v1/games/{id}/moves",
+		Handler: apiHandlers.MovesHandler,
+	},
+	{
+		Path:    "/api/v1/games/{id}/moves/last",
+		Handler: apiHandlers.LastMoveHandler,
+	},
+	{
+		Path:    "/api/v1/",
+		Handler: apiHandlers.NotFoundHandler,
+	},
 	// Redirect root to setup
 	{
 		Method: "GET",
@@ -74,6 +282,9 @@ var routes = []shared.Route{
 }
 
 func main() {
+	roomIdle := flag.Duration("room-idle", shared.DefaultRoomIdleTTL, "how long a room nobody visits is kept")
+	flag.Parse()
+	shared.Rooms.SetIdleTTL(*roomIdle)
 
 	shared.StartServer(routes, "0.0.0.0:8080")
 }
@@ -0,0 +1,435 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"html/template"
+	"log"
+	"net/http"
+	"sync"
+
+	"power4/shared"
+)
+
+// PageData represents the data structure passed to the game template
+type PageData struct {
+	ID       string // Game ID, part of every URL of the game
+	ShareURL string // Link to send to the opponent
+	You      int    // 1-based number of the player viewing the page, 0 for a spectator
+	CanJoin  bool   // Whether the viewer may take the free seat
+}
+
+// StateMessage is the game as pushed to a player over the WebSocket
+type StateMessage struct {
+	Type          string              `json:"type"`          // Always "state"
+	Board         [][]int             `json:"board"`         // 0=empty, 1=player 1, 2=player 2
+	Rows          int                 `json:"rows"`          // Number of rows
+	Columns       int                 `json:"columns"`       // Number of columns
+	You           int                 `json:"you"`           // 1-based number of the receiving player, 0 for a spectator
+	CurrentPlayer int                 `json:"currentPlayer"` // 1-based number of the player to move
+	OpponentReady bool                `json:"opponentReady"` // Whether both seats are taken
+	State         string              `json:"state"`         // "Ongoing", "Won" or "Draw"
+	Winner        int                 `json:"winner"`        // 1-based number of the winner, 0 if none
+	WinningCells  []shared.Coordinate `json:"winningCells"`  // Discs of the winning line(s)
+	Spectators    int                 `json:"spectators"`    // Browsers watching without a seat
+}
+
+// ErrorMessage reports a rejected request to the player who sent it
+type ErrorMessage struct {
+	Type    string `json:"type"` // Always "error"
+	Message string `json:"message"`
+}
+
+// clientMessage is a request sent by a player over the WebSocket
+type clientMessage struct {
+	Type   string `json:"type"` // "move" or "rematch"
+	Column int    `json:"column"`
+}
+
+// Game is a classic game played from two browsers, hosted as a room. Each
+// seat belongs to the session that took it, other sessions that opened the
+// page may watch; mu serializes moves and the pushes they cause.
+type Game struct {
+	mu       sync.Mutex
+	id       string // Room ID, part of every URL of the game
+	events   string // Game ID of the event stream
+	game     *shared.Power
+	seats    [2]string        // Session ID of each player, empty while the seat is free
+	audience shared.Audience  // Sessions allowed to watch the game
+	clients  map[*client]bool // Open WebSockets
+}
+
+// client is an open WebSocket of a player or a spectator. Messages wait in
+// send until its writer goroutine writes them, so a slow browser never
+// holds up the game.
+type client struct {
+	ws   *shared.WebSocket
+	seat int         // -1 for a spectator
+	send chan []byte // Encoded messages not written yet, closed once dropped
+}
+
+// clientBuffer is how many messages a WebSocket may fall behind before it
+// is dropped
+const clientBuffer = 16
+
+// newClient opens the send queue of a WebSocket and starts its writer
+func newClient(ws *shared.WebSocket, seat int) *client {
+	c := &client{ws: ws, seat: seat, send: make(chan []byte, clientBuffer)}
+	go c.write()
+	return c
+}
+
+// write sends the queued messages until the queue is closed or a write
+// fails, then closes the WebSocket, which ends its reader
+func (c *client) write() {
+	defer c.ws.Close()
+	for data := range c.send {
+		if err := c.ws.WriteMessage(data); err != nil {
+			return
+		}
+	}
+}
+
+// newGame creates a classic game with its creator in the first seat
+func newGame(creator string) *Game {
+	room := shared.Rooms.Create(func(id string) shared.Room {
+		g := &Game{
+			id:       id,
+			events:   shared.NewGameID(),
+			game:     shared.NewGameInstance(shared.GameSettings{Rows: 6, Columns: 7}),
+			audience: make(shared.Audience),
+			clients:  make(map[*client]bool),
+		}
+		g.seats[shared.BLUE] = creator
+		return g
+	})
+	return room.(*Game)
+}
+
+// Info describes the game for the lobby
+func (g *Game) Info() shared.RoomInfo {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	return shared.RoomInfo{
+		Mode:       "Online",
+		URL:        "/online/" + g.id,
+		Seats:      len(g.seats),
+		Taken:      shared.SeatsTaken(g.seats[:]),
+		Spectators: g.spectators(),
+	}
+}
+
+// spectators counts the open WebSockets without a seat. Callers hold g.mu.
+func (g *Game) spectators() int {
+	count := 0
+	for c := range g.clients {
+		if c.seat < 0 {
+			count++
+		}
+	}
+	return count
+}
+
+// state builds the message pushed to the viewer in seat. Callers hold g.mu.
+func (g *Game) state(seat int) StateMessage {
+	board := g.game.GetBoard()
+	cells := make([][]int, len(board))
+	for i := range board {
+		cells[i] = make([]int, len(board[i]))
+		for j, piece := range board[i] {
+			switch piece {
+			case shared.BLUE.Piece():
+				cells[i][j] = 1
+			case shared.RED.Piece():
+				cells[i][j] = 2
+			}
+		}
+	}
+
+	msg := StateMessage{
+		Type:          "state",
+		Board:         cells,
+		Rows:          len(board),
+		Columns:       len(board[0]),
+		You:           seat + 1,
+		CurrentPlayer: int(g.game.GetCurrentPlayer()) + 1,
+		OpponentReady: g.seats[shared.RED] != "",
+		State:         g.game.GetGameState().String(),
+		WinningCells:  g.game.WinningCells(),
+		Spectators:    g.spectators(),
+	}
+	if winner := g.game.GetWinner(); winner != nil {
+		msg.Winner = int(*winner) + 1
+	}
+	return msg
+}
+
+// broadcast pushes the game to every open WebSocket. Callers hold g.mu.
+func (g *Game) broadcast() {
+	for c := range g.clients {
+		g.send(c, g.state(c.seat))
+	}
+}
+
+// send queues a message as JSON for a WebSocket without waiting for it to
+// be written. A WebSocket too slow to keep up is dropped; its browser
+// reconnects and gets the whole game again. Callers hold g.mu.
+func (g *Game) send(c *client, msg any) {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		log.Printf("online: cannot encode message: %v", err)
+		return
+	}
+	if !g.clients[c] {
+		return
+	}
+	select {
+	case c.send <- data:
+	default:
+		g.drop(c)
+	}
+}
+
+// drop forgets a WebSocket and closes its queue, which ends its writer.
+// Callers hold g.mu.
+func (g *Game) drop(c *client) {
+	if g.clients[c] {
+		delete(g.clients, c)
+		close(c.send)
+	}
+}
+
+// spectatorsChanged tells everyone that a spectator's WebSocket opened or
+// closed. Callers hold g.mu.
+func (g *Game) spectatorsChanged() {
+	g.publish(shared.EVENT_SPECTATORS, nil)
+	g.broadcast()
+}
+
+// publish streams an event about the game to its Server-Sent Events
+// followers; move is the cell just played, if any. Callers hold g.mu.
+func (g *Game) publish(eventType shared.EventType, move *shared.Coordinate) {
+	shared.Events.PublishGame(g.events, eventType, g.game, nil, move)
+}
+
+// play applies a request from the viewer in seat. Callers hold g.mu.
+func (g *Game) play(seat int, msg clientMessage) error {
+	if seat < 0 {
+		return shared.ErrNotSeated
+	}
+	switch msg.Type {
+	case "move":
+		if g.game.IsGameOver() {
+			return shared.ErrGameOver
+		}
+		if g.seats[shared.RED] == "" {
+			return shared.ErrRoomNotReady
+		}
+		if int(g.game.GetCurrentPlayer()) != seat {
+			return shared.ErrNotYourTurn
+		}
+		placed, err := g.game.MakeMove(shared.Coordinate{Column: msg.Column})
+		if err != nil {
+			return err
+		}
+		g.publish(shared.EVENT_MOVE, &placed)
+		if g.game.IsGameOver() {
+			g.publish(shared.EVENT_GAME_OVER, nil)
+		}
+		return nil
+	case "rematch":
+		if !g.game.IsGameOver() {
+			return errors.New("the game is not over yet")
+		}
+		g.game.ResetGame()
+		g.publish(shared.EVENT_BOARD, nil)
+		return nil
+	default:
+		return errors.New("unknown request " + msg.Type)
+	}
+}
+
+// describeMoveError maps an engine error to a user message
+func describeMoveError(err error) string {
+	switch {
+	case errors.Is(err, shared.ErrNotYourTurn):
+		return "Wait for your opponent to play."
+	case errors.Is(err, shared.ErrRoomNotReady):
+		return "Share the link: nobody has joined yet."
+	case errors.Is(err, shared.ErrNotSeated):
+		return "Spectators cannot play."
+	case errors.Is(err, shared.ErrGameOver):
+		return "Game is already over!"
+	case errors.Is(err, shared.ErrColumnFull):
+		return "Column is full! Try another column."
+	case errors.Is(err, shared.ErrColumnOutOfRange):
+		return "That column does not exist."
+	default:
+		return "Request rejected: " + err.Error()
+	}
+}
+
+// LobbyHandler renders the page to start an online game
+func LobbyHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	tmpl, err := template.ParseFiles("online/templates/lobby.html")
+	if err != nil {
+		http.Error(w, "Error parsing template: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	err = tmpl.Execute(w, nil)
+	if err != nil {
+		http.Error(w, "Error executing template: "+err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// CreateGameHandler creates a game, seats the caller as Player 1 and sends
+// them to its page
+func CreateGameHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	g := newGame(shared.SessionID(w, r))
+	http.Redirect(w, r, "/online/"+g.id, http.StatusSeeOther)
+}
+
+// GameHandler renders a game page. Opening the link only watches the game:
+// the second seat is taken with JoinHandler.
+func GameHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	g, ok := shared.LookupRoom[*Game](shared.Rooms, r.PathValue("id"))
+	if !ok {
+		http.Error(w, "Game not found", http.StatusNotFound)
+		return
+	}
+
+	session := shared.SessionID(w, r)
+	g.mu.Lock()
+	seat, seated := shared.SeatOf(g.seats[:], r)
+	if !seated {
+		seat = -1
+		g.audience.Join(session)
+	}
+	canJoin := !seated && g.seats[shared.RED] == ""
+	g.mu.Unlock()
+
+	tmpl, err := template.ParseFiles("online/templates/game.html")
+	if err != nil {
+		http.Error(w, "Error parsing template: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	data := PageData{
+		ID:       g.id,
+		ShareURL: shared.AbsoluteURL(r, "/online/"+g.id),
+		You:      seat + 1,
+		CanJoin:  canJoin,
+	}
+	err = tmpl.Execute(w, data)
+	if err != nil {
+		http.Error(w, "Error executing template: "+err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// JoinHandler gives the caller the free seat of a game, if it is still
+// free, and sends them back to its page. Only this explicit action takes a
+// seat, so link previews and prefetches of the page stay spectators.
+func JoinHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	g, ok := shared.LookupRoom[*Game](shared.Rooms, r.PathValue("id"))
+	if !ok {
+		http.Error(w, "Game not found", http.StatusNotFound)
+		return
+	}
+
+	session := shared.SessionID(w, r)
+	g.mu.Lock()
+	if _, seated := shared.SeatOf(g.seats[:], r); !seated {
+		if _, seated := shared.TakeSeat(g.seats[:], session); seated {
+			g.publish(shared.EVENT_SEATS, nil)
+			g.broadcast()
+		}
+	}
+	g.mu.Unlock()
+
+	http.Redirect(w, r, "/online/"+g.id, http.StatusSeeOther)
+}
+
+// SocketHandler upgrades the connection of a player or a spectator to a
+// WebSocket, pushes the game on every change and applies the player's moves
+func SocketHandler(w http.ResponseWriter, r *http.Request) {
+	g, ok := shared.LookupRoom[*Game](shared.Rooms, r.PathValue("id"))
+	if !ok {
+		http.Error(w, "Game not found", http.StatusNotFound)
+		return
+	}
+
+	// Only an existing session can hold a seat or watch
+	g.mu.Lock()
+	seat, seated := shared.SeatOf(g.seats[:], r)
+	watching := g.audience.Watches(r)
+	g.mu.Unlock()
+	if !seated {
+		seat = -1
+	}
+	if !seated && !watching {
+		http.Error(w, "Join the game first", http.StatusForbidden)
+		return
+	}
+
+	ws, err := shared.UpgradeWebSocket(w, r)
+	if err != nil {
+		return
+	}
+	c := newClient(ws, seat)
+	defer func() {
+		g.mu.Lock()
+		g.drop(c)
+		if seat < 0 {
+			g.spectatorsChanged()
+		}
+		g.mu.Unlock()
+	}()
+
+	g.mu.Lock()
+	g.clients[c] = true
+	if seat < 0 {
+		g.spectatorsChanged()
+	} else {
+		g.send(c, g.state(seat))
+	}
+	g.mu.Unlock()
+
+	for {
+		data, err := ws.ReadMessage()
+		if err != nil {
+			return
+		}
+
+		g.mu.Lock()
+		var msg clientMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			g.send(c, ErrorMessage{Type: "error", Message: "Malformed request."})
+		} else if err := g.play(seat, msg); err != nil {
+			g.send(c, ErrorMessage{Type: "error", Message: describeMoveError(err)})
+		} else {
+			g.broadcast()
+		}
+		g.mu.Unlock()
+	}
+}
@@ -0,0 +1,265 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"power4/shared"
+)
+
+// TestMain runs the tests from the repository root so templates resolve
+func TestMain(m *testing.M) {
+	if err := os.Chdir("../.."); err != nil {
+		panic(err)
+	}
+	os.Exit(m.Run())
+}
+
+// newServer serves the online routes the way main.go mounts them
+func newServer(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	mux := http.NewServeMux()
+	shared.RegisterRoute(mux, []shared.Route{
+		{Method: "GET", Path: "/online", Handler: LobbyHandler},
+		{Method: "POST", Path: "/online/new", Handler: CreateGameHandler},
+		{Method: "GET", Path: "/online/{id}", Handler: GameHandler},
+		{Method: "POST", Path: "/online/{id}/join", Handler: JoinHandler},
+		{Method: "GET", Path: "/online/{id}/ws", Handler: SocketHandler},
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+// newBrowser returns a client keeping its own cookies, like a browser
+func newBrowser(t *testing.T) *http.Client {
+	t.Helper()
+
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &http.Client{Jar: jar}
+}
+
+// connect opens the game's WebSocket with the browser's cookies
+func connect(t *testing.T, browser *http.Client, gameURL string) *shared.WebSocket {
+	t.Helper()
+
+	u, _ := url.Parse(gameURL)
+	header := http.Header{}
+	for _, cookie := range browser.Jar.Cookies(u) {
+		header.Add("Cookie", cookie.String())
+	}
+	ws, err := shared.DialWebSocket("ws"+strings.TrimPrefix(gameURL, "http")+"/ws", header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ws.Close() })
+	return ws
+}
+
+// receive reads the next message pushed over a WebSocket
+func receive(t *testing.T, ws *shared.WebSocket) map[string]any {
+	t.Helper()
+
+	data, err := ws.ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var msg map[string]any
+	if err := json.Unmarshal(data, &msg); err != nil {
+		t.Fatal(err)
+	}
+	return msg
+}
+
+// startGame creates a game from one browser and joins it from another
+func startGame(t *testing.T, server *httptest.Server) (string, *http.Client, *http.Client) {
+	t.Helper()
+
+	host, guest := newBrowser(t), newBrowser(t)
+	resp, err := host.Post(server.URL+"/online/new", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	gameURL := resp.Request.URL.String()
+
+	// Opening the link only offers the seat
+	resp, err = guest.Get(gameURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !strings.Contains(string(body), "Take the free seat") {
+		t.Fatalf("opening the link returned status %d without the free seat", resp.StatusCode)
+	}
+
+	resp, err = guest.Post(gameURL+"/join", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Request.URL.String() != gameURL {
+		t.Fatalf("joining returned status %d at %s", resp.StatusCode, resp.Request.URL)
+	}
+	return gameURL, host, guest
+}
+
+func TestOnlineGame(t *testing.T) {
+	server := newServer(t)
+	gameURL, host, guest := startGame(t, server)
+
+	hostWS, guestWS := connect(t, host, gameURL), connect(t, guest, gameURL)
+	if msg := receive(t, hostWS); msg["you"] != 1.0 || msg["opponentReady"] != true {
+		t.Fatalf("expected the host to be player 1 with an opponent, got %v", msg)
+	}
+	if msg := receive(t, guestWS); msg["you"] != 2.0 {
+		t.Fatalf("expected the guest to be player 2, got %v", msg)
+	}
+
+	// Only the player whose turn it is can move
+	guestWS.WriteMessage([]byte(`{"type":"move","column":3}`))
+	if msg := receive(t, guestWS); msg["type"] != "error" {
+		t.Fatalf("expected an out of turn move to be refused, got %v", msg)
+	}
+
+	hostWS.WriteMessage([]byte(`{"type":"move","column":3}`))
+	for _, ws := range []*shared.WebSocket{hostWS, guestWS} {
+		msg := receive(t, ws)
+		board := msg["board"].([]any)
+		if bottom := board[5].([]any); bottom[3] != 1.0 || msg["currentPlayer"] != 2.0 {
+			t.Fatalf("expected both players to see the move, got %v", msg)
+		}
+	}
+
+	// A third browser watches while its WebSocket is open: the players see
+	// it counted, it cannot move
+	spectator := newBrowser(t)
+	resp, err := spectator.Get(gameURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("third browser returned status %d", resp.StatusCode)
+	}
+
+	spectatorWS := connect(t, spectator, gameURL)
+	for _, ws := range []*shared.WebSocket{hostWS, guestWS} {
+		if msg := receive(t, ws); msg["spectators"] != 1.0 {
+			t.Fatalf("expected the players to see a spectator, got %v", msg)
+		}
+	}
+	if msg := receive(t, spectatorWS); msg["you"] != 0.0 || msg["currentPlayer"] != 2.0 || msg["spectators"] != 1.0 {
+		t.Fatalf("expected the spectator to see the game without a seat, got %v", msg)
+	}
+	spectatorWS.WriteMessage([]byte(`{"type":"move","column":0}`))
+	if msg := receive(t, spectatorWS); msg["type"] != "error" {
+		t.Fatalf("expected a spectator's move to be refused, got %v", msg)
+	}
+
+	spectatorWS.Close()
+	for _, ws := range []*shared.WebSocket{hostWS, guestWS} {
+		if msg := receive(t, ws); msg["spectators"] != 0.0 {
+			t.Fatalf("expected the spectator to leave the count, got %v", msg)
+		}
+	}
+
+	if _, err := shared.DialWebSocket("ws"+strings.TrimPrefix(gameURL, "http")+"/ws", nil); err == nil {
+		t.Fatal("expected a WebSocket without a session to be refused")
+	}
+}
+
+func TestOnlineGameConcurrentMoves(t *testing.T) {
+	server := newServer(t)
+	gameURL, host, guest := startGame(t, server)
+	hostWS, guestWS := connect(t, host, gameURL), connect(t, guest, gameURL)
+	receive(t, hostWS)
+	receive(t, guestWS)
+
+	// Both players spam moves at once; turns still alternate
+	var wg sync.WaitGroup
+	for _, ws := range []*shared.WebSocket{hostWS, guestWS} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 10; i++ {
+				ws.WriteMessage([]byte(`{"type":"move","column":` + string(rune('0'+i%7)) + `}`))
+			}
+		}()
+	}
+	wg.Wait()
+
+	// A malformed request answered means every earlier one was handled
+	for _, ws := range []*shared.WebSocket{hostWS, guestWS} {
+		ws.WriteMessage([]byte("?"))
+		for receive(t, ws)["message"] != "Malformed request." {
+		}
+	}
+
+	g, _ := shared.LookupRoom[*Game](shared.Rooms, strings.TrimPrefix(gameURL, server.URL+"/online/"))
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	history := g.game.History()
+	if len(history) == 0 {
+		t.Fatal("expected some moves to get in")
+	}
+	for i, move := range history {
+		if move.Player != shared.Player(i%2) {
+			t.Fatalf("move %d was played by %v out of turn", i+1, move.Player)
+		}
+	}
+}
+
+func TestSlowClientDropped(t *testing.T) {
+	// A WebSocket whose writer never catches up must not hold up the game
+	g := newGame("host")
+	slow := &client{seat: -1, send: make(chan []byte, clientBuffer)}
+	g.mu.Lock()
+	g.clients[slow] = true
+	for i := 0; i <= clientBuffer; i++ {
+		g.broadcast()
+	}
+	dropped := !g.clients[slow]
+	g.mu.Unlock()
+
+	if !dropped {
+		t.Fatal("expected the slow WebSocket to be dropped")
+	}
+	// Its queue is closed, which ends its writer
+	for range slow.send {
+	}
+}
+
+func TestMethodNotAllowed(t *testing.T) {
+	server := newServer(t)
+	resp, err := http.Post(server.URL+"/online/abc", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Fatalf("POST /online/abc returned status %d", resp.StatusCode)
+	}
+
+	resp, err = http.Get(server.URL + "/online/unknown")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("unknown game returned status %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	popout "power4/popout/handlers"
+	"power4/shared"
+)
+
+// GameData adds the stage of the game and the captures to the data of the
+// Pop Out page
+type GameData struct {
+	popout.GameData
+	CanDrop     bool   // Whether the current phase takes drops
+	Phase       string // Stage of the game (setting up, popping, returning)
+	Player1Pops int    // Discs captured by player 1 in this game
+	Player2Pops int    // Discs captured by player 2 in this game
+	Goal        int    // Discs to capture to win
+}
+
+// pop10 serves the Pop 10 page with the Pop Out handlers
+var pop10 = popout.NewMode(popout.Mode{
+	Variant:   "pop10",
+	Page:      "/pop10",
+	Template:  "pop10/templates/index.html",
+	PageData:  createGameData,
+	MoveError: describeMoveError,
+})
+
+// Handlers of the Pop 10 page
+var (
+	HomeHandler        = pop10.HomeHandler
+	MoveHandler        = pop10.MoveHandler
+	NewGameHandler     = pop10.NewGameHandler
+	ResetScoresHandler = pop10.ResetScoresHandler
+	UndoHandler        = pop10.UndoHandler
+	RedoHandler        = pop10.RedoHandler
+)
+
+// goal returns the number of captures the registered Pop 10 rules play to
+func goal() int {
+	if v, ok := shared.LookupVariant("pop10"); ok {
+		if pop10, ok := v.(shared.Pop10); ok {
+			return pop10.Goal
+		}
+	}
+	return 0
+}
+
+// createGameData adds the Pop 10 fields to the data of the page
+func createGameData(game *shared.Power, data popout.GameData) any {
+	return GameData{
+		GameData:    data,
+		CanDrop:     game.GetPhase() != shared.POPPING,
+		Phase:       game.GetPhase().String(),
+		Player1Pops: game.Captured(shared.BLUE),
+		Player2Pops: game.Captured(shared.RED),
+		Goal:        goal(),
+	}
+}
+
+// describeMoveError maps the errors that read differently in Pop 10 to a
+// user message and HTTP status
+func describeMoveError(err error) (string, int, bool) {
+	switch {
+	case errors.Is(err, shared.ErrColumnFull):
+		return "Column is full! Try another column.", http.StatusConflict, true
+	case errors.Is(err, shared.ErrMoveNotAllowed):
+		return "That move is not allowed in this phase.", http.StatusConflict, true
+	default:
+		return "", 0, false
+	}
+}
@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"power4/shared"
+)
+
+// TestMain runs the tests from the repository root so templates resolve
+func TestMain(m *testing.M) {
+	if err := os.Chdir("../.."); err != nil {
+		panic(err)
+	}
+	os.Exit(m.Run())
+}
+
+// newSessionCookie issues a session by visiting the home page
+func newSessionCookie(t *testing.T) *http.Cookie {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	HomeHandler(rec, httptest.NewRequest(http.MethodGet, "/pop10", nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "Captured 0/") {
+		t.Fatalf("home page returned status %d without the captures", rec.Code)
+	}
+	for _, cookie := range rec.Result().Cookies() {
+		if cookie.Name == shared.SessionCookieName {
+			return cookie
+		}
+	}
+	t.Fatal("home page did not issue a session cookie")
+	return nil
+}
+
+func postMove(cookie *http.Cookie, kind string, column int) *httptest.ResponseRecorder {
+	form := url.Values{"column": {strconv.Itoa(column)}, "kind": {kind}}
+	req := httptest.NewRequest(http.MethodPost, "/pop10/move", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.AddCookie(cookie)
+
+	rec := httptest.NewRecorder()
+	MoveHandler(rec, req)
+	return rec
+}
+
+func TestMoveHandlerPhases(t *testing.T) {
+	cookie := newSessionCookie(t)
+
+	if rec := postMove(cookie, "pop", 0); rec.Code != http.StatusConflict {
+		t.Fatalf("popping during the setup returned status %d", rec.Code)
+	}
+
+	// Fill the board; lines do not end the game during the setup
+	for col := 0; col < 7; col++ {
+		for row := 0; row < 6; row++ {
+			if rec := postMove(cookie, "drop", col); rec.Code != http.StatusOK {
+				t.Fatalf("setup drop in column %d returned status %d", col, rec.Code)
+			}
+		}
+	}
+
+	game := pop10.Game(cookie.Value)
+	if game.GetPhase() != shared.POPPING || game.IsGameOver() {
+		t.Fatalf("expected the popping phase after the setup, got %v", game.GetPhase())
+	}
+	if rec := postMove(cookie, "drop", 0); rec.Code != http.StatusConflict {
+		t.Fatalf("dropping while popping returned status %d", rec.Code)
+	}
+	if rec := postMove(cookie, "shove", 0); rec.Code != http.StatusBadRequest {
+		t.Fatalf("unknown move kind returned status %d", rec.Code)
+	}
+}
+
+func TestMoveHandlerConcurrent(t *testing.T) {
+	cookie := newSessionCookie(t)
+
+	var wg sync.WaitGroup
+	for worker := 0; worker < 8; worker++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			for i := 0; i < 25; i++ {
+				kind := "drop"
+				if i%3 == 0 {
+					kind = "pop"
+				}
+				if rec := postMove(cookie, kind, (worker+i)%7); rec.Code != http.StatusOK && rec.Code != http.StatusConflict {
+					t.Errorf("move returned status %d", rec.Code)
+				}
+			}
+		}(worker)
+	}
+	wg.Wait()
+
+	board := pop10.Game(cookie.Value).GetBoard()
+	for col := 0; col < 7; col++ {
+		for row := 1; row < 6; row++ {
+			if board[row-1][col] != 0 && board[row][col] == 0 {
+				t.Fatalf("floating disc above row %d column %d", row, col)
+			}
+		}
+	}
+}
@@ -0,0 +1,375 @@
+package handlers
+
+import (
+	"errors"
+	"html/template"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"power4/shared"
+)
+
+// GameData represents the data structure passed to the template
+type GameData struct {
+	Board         [][]int  // 6x7 board (0=empty, 1=player1, 2=player2)
+	CurrentPlayer int      // 1 or 2
+	Player1Score  int      // Player 1's score
+	Player2Score  int      // Player 2's score
+	GameOver      bool     // Whether game is finished
+	GameWon       bool     // Whether someone won
+	GameDraw      bool     // Whether it's a draw
+	Winner        int      // Winning player (1 or 2)
+	ShowModal     bool     // Whether to show win/draw modal
+	Message       string   // Status message to display
+	ColumnIndices []int    // [0,1,2,3,4,5,6] for iteration
+	RowIndices    []int    // [0,1,2,3,4,5] for iteration
+	WinningCells  [][]bool // true for the discs of the winning line(s)
+	CanPop        []bool   // true for the columns the current player can pop
+	CanUndo       bool     // Whether a move can be taken back
+	CanRedo       bool     // Whether an undone move can be replayed
+	GameID        string   // Names the event stream of the game
+}
+
+// Mode is a game of drops and pops played from a single browser: Pop Out
+// itself, or another variant played with the same moves, such as Pop 10.
+// Its handlers serve the page at Page and the forms posted under it.
+type Mode struct {
+	Variant  string // Name of the registered variant
+	Page     string // URL of the game's page, prefix of its form actions
+	Template string // Template of the page
+
+	// PageData extends the page data with the fields of the variant, nil
+	// to render GameData as it is
+	PageData func(game *shared.Power, data GameData) any
+
+	// MoveError maps the errors of the variant to a user message and HTTP
+	// status, reporting false to leave an error to the Pop Out messages
+	MoveError func(err error) (message string, status int, ok bool)
+
+	sessions *shared.SessionStore[*session]
+}
+
+// NewMode creates the handlers of a mode, with a game per browser session
+func NewMode(m Mode) *Mode {
+	m.sessions = shared.NewSessionStore(shared.DefaultSessionTTL, func() *session {
+		return newSession(m.Variant)
+	})
+	return &m
+}
+
+// popOut serves the Pop Out page
+var popOut = NewMode(Mode{
+	Variant:  "popout",
+	Page:     "/popout",
+	Template: "popout/templates/index.html",
+})
+
+// Handlers of the Pop Out page
+var (
+	HomeHandler        = popOut.HomeHandler
+	MoveHandler        = popOut.MoveHandler
+	NewGameHandler     = popOut.NewGameHandler
+	ResetScoresHandler = popOut.ResetScoresHandler
+	UndoHandler        = popOut.UndoHandler
+	RedoHandler        = popOut.RedoHandler
+)
+
+// session holds the game and scores of a single browser. mu serializes the
+// handlers of that browser so scores and game state change together.
+type session struct {
+	mu           sync.Mutex
+	id           string // Game ID of the event stream
+	game         *shared.Power
+	player1Score int
+	player2Score int
+}
+
+// newSession creates a game of the variant with standard Connect 4
+// dimensions
+func newSession(variant string) *session {
+	settings := shared.GameSettings{
+		Rows:    6,
+		Columns: 7,
+		Variant: variant,
+	}
+	return &session{id: shared.NewGameID(), game: shared.NewGameInstance(settings)}
+}
+
+// Game returns the game played in a browser session, creating it if needed
+func (m *Mode) Game(sessionID string) *shared.Power {
+	return m.sessions.Lookup(sessionID).game
+}
+
+// addScore adjusts the score of the player behind a shared.Player
+func (s *session) addScore(player shared.Player, delta int) {
+	if player == shared.BLUE {
+		s.player1Score += delta
+	} else {
+		s.player2Score += delta
+	}
+}
+
+// publish streams an event about the game; move is the cell just played,
+// if any
+func (s *session) publish(eventType shared.EventType, move *shared.Coordinate) {
+	shared.Events.PublishGame(s.id, eventType, s.game, []int{s.player1Score, s.player2Score}, move)
+}
+
+// convertBoardToTemplate converts the game board to template-friendly format
+func convertBoardToTemplate(gameBoard [][]rune) [][]int {
+	board := make([][]int, len(gameBoard))
+	for i := range gameBoard {
+		board[i] = make([]int, len(gameBoard[i]))
+		for j := range gameBoard[i] {
+			switch gameBoard[i][j] {
+			case 'B': // Blue player (Player 1)
+				board[i][j] = 1
+			case 'R': // Red player (Player 2)
+				board[i][j] = 2
+			default:
+				board[i][j] = 0
+			}
+		}
+	}
+	return board
+}
+
+// convertPops marks the columns where one of the legal moves is a pop
+func convertPops(moves []shared.Action, cols int) []bool {
+	pops := make([]bool, cols)
+	for _, move := range moves {
+		if move.Kind == shared.POP {
+			pops[move.Column] = true
+		}
+	}
+	return pops
+}
+
+// createGameData creates the GameData struct for template rendering
+func createGameData(s *session, message string, showModal bool) GameData {
+	game := s.game
+	data := GameData{
+		Board:         convertBoardToTemplate(game.GetBoard()),
+		CurrentPlayer: int(game.GetCurrentPlayer()) + 1, // Convert to 1-based
+		Player1Score:  s.player1Score,
+		Player2Score:  s.player2Score,
+		GameOver:      game.IsGameOver(),
+		ShowModal:     showModal,
+		Message:       message,
+		ColumnIndices: []int{0, 1, 2, 3, 4, 5, 6},
+		RowIndices:    []int{0, 1, 2, 3, 4, 5},
+		WinningCells:  shared.WinningGrid(game.WinningCells(), game.Settings.Rows, game.Settings.Columns),
+		CanPop:        convertPops(game.LegalMoves(), game.Settings.Columns),
+		CanUndo:       game.CanUndo(),
+		CanRedo:       game.CanRedo(),
+		GameID:        s.id,
+	}
+
+	// Set game state specific fields
+	if game.IsGameOver() {
+		switch game.GetGameState() {
+		case shared.WON:
+			winner := *game.GetWinner()
+			data.GameWon = true
+			data.Winner = int(winner) + 1 // Convert to 1-based
+			if showModal {
+				s.addScore(winner, 1)
+			}
+		case shared.DRAW:
+			data.GameDraw = true
+		}
+		data.ShowModal = showModal
+	}
+
+	return data
+}
+
+// describeMoveError maps an engine error to a user message and HTTP status,
+// trying the mode's own messages first
+func (m *Mode) describeMoveError(err error) (string, int) {
+	if m.MoveError != nil {
+		if message, status, ok := m.MoveError(err); ok {
+			return message, status
+		}
+	}
+
+	switch {
+	case errors.Is(err, shared.ErrGameOver):
+		return "Game is already over!", http.StatusConflict
+	case errors.Is(err, shared.ErrColumnFull):
+		return "Column is full! Try another column or pop a disc.", http.StatusConflict
+	case errors.Is(err, shared.ErrIllegalPop):
+		return "You can only pop one of your own discs from the bottom.", http.StatusConflict
+	case errors.Is(err, shared.ErrColumnOutOfRange):
+		return "That column does not exist.", http.StatusBadRequest
+	default:
+		return "Move rejected: " + err.Error(), http.StatusBadRequest
+	}
+}
+
+// renderGame renders the mode's page with the given status code
+func (m *Mode) renderGame(w http.ResponseWriter, status int, s *session, data GameData) {
+	tmpl, err := template.ParseFiles(m.Template)
+	if err != nil {
+		http.Error(w, "Error parsing template: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var page any = data
+	if m.PageData != nil {
+		page = m.PageData(s.game, data)
+	}
+	w.WriteHeader(status)
+	err = tmpl.Execute(w, page)
+	if err != nil {
+		http.Error(w, "Error executing template: "+err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// HomeHandler renders the game page
+func (m *Mode) HomeHandler(w http.ResponseWriter, r *http.Request) {
+	s := m.sessions.Get(w, r)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m.renderGame(w, http.StatusOK, s, createGameData(s, "", false))
+}
+
+// MoveHandler drops a disc in, or pops a disc out of, the chosen column, as
+// far as the variant allows
+func (m *Mode) MoveHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	column, err := strconv.Atoi(r.FormValue("column"))
+	if err != nil {
+		http.Error(w, "Invalid column number", http.StatusBadRequest)
+		return
+	}
+
+	var kind shared.MoveKind
+	switch r.FormValue("kind") {
+	case "", "drop":
+		kind = shared.DROP
+	case "pop":
+		kind = shared.POP
+	default:
+		http.Error(w, "Invalid move kind", http.StatusBadRequest)
+		return
+	}
+
+	s := m.sessions.Get(w, r)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	game := s.game
+
+	// Make the move, reporting rejected moves back on the board
+	action := shared.Action{Kind: kind, Coordinate: shared.Coordinate{Column: column}}
+	placed, moveErr := game.Play(action)
+	if moveErr != nil {
+		message, status := m.describeMoveError(moveErr)
+		m.renderGame(w, status, s, createGameData(s, message, false))
+		return
+	}
+	s.publish(shared.EVENT_MOVE, &placed)
+
+	var message string
+	switch game.GetGameState() {
+	case shared.WON:
+		if *game.GetWinner() == shared.BLUE {
+			message = "Player 1 (Blue) wins!"
+		} else {
+			message = "Player 2 (Red) wins!"
+		}
+	case shared.DRAW:
+		message = "It's a draw!"
+	}
+
+	data := createGameData(s, message, game.IsGameOver())
+	if game.IsGameOver() {
+		s.publish(shared.EVENT_GAME_OVER, nil)
+		if game.GetGameState() == shared.WON {
+			s.publish(shared.EVENT_SCORES, nil)
+		}
+	}
+	m.renderGame(w, http.StatusOK, s, data)
+}
+
+// NewGameHandler starts a new game
+func (m *Mode) NewGameHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	s := m.sessions.Get(w, r)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.game.ResetGame()
+	s.publish(shared.EVENT_BOARD, nil)
+
+	http.Redirect(w, r, m.Page, http.StatusSeeOther)
+}
+
+// ResetScoresHandler resets player scores
+func (m *Mode) ResetScoresHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	s := m.sessions.Get(w, r)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.player1Score = 0
+	s.player2Score = 0
+	s.publish(shared.EVENT_SCORES, nil)
+
+	http.Redirect(w, r, m.Page, http.StatusSeeOther)
+}
+
+// UndoHandler takes back the last drop or pop of the caller's game
+func (m *Mode) UndoHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	s := m.sessions.Get(w, r)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Taking back a winning move also takes back the point it earned
+	if undone, scored := shared.UndoScored(s.game, s.addScore); undone {
+		s.publish(shared.EVENT_BOARD, nil)
+		if scored {
+			s.publish(shared.EVENT_SCORES, nil)
+		}
+	}
+
+	http.Redirect(w, r, m.Page, http.StatusSeeOther)
+}
+
+// RedoHandler replays the last undone move of the caller's game
+func (m *Mode) RedoHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	s := m.sessions.Get(w, r)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if redone, scored := shared.RedoScored(s.game, s.addScore); redone {
+		s.publish(shared.EVENT_BOARD, nil)
+		if scored {
+			s.publish(shared.EVENT_SCORES, nil)
+		}
+	}
+
+	http.Redirect(w, r, m.Page, http.StatusSeeOther)
+}
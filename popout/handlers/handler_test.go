@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"power4/shared"
+)
+
+// TestMain runs the tests from the repository root so templates resolve
+func TestMain(m *testing.M) {
+	if err := os.Chdir("../.."); err != nil {
+		panic(err)
+	}
+	os.Exit(m.Run())
+}
+
+// newSessionCookie issues a session by visiting the home page
+func newSessionCookie(t *testing.T) *http.Cookie {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	HomeHandler(rec, httptest.NewRequest(http.MethodGet, "/popout", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("home page returned status %d", rec.Code)
+	}
+	for _, cookie := range rec.Result().Cookies() {
+		if cookie.Name == shared.SessionCookieName {
+			return cookie
+		}
+	}
+	t.Fatal("home page did not issue a session cookie")
+	return nil
+}
+
+func postMove(cookie *http.Cookie, kind string, column int) *httptest.ResponseRecorder {
+	form := url.Values{"column": {strconv.Itoa(column)}, "kind": {kind}}
+	req := httptest.NewRequest(http.MethodPost, "/popout/move", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.AddCookie(cookie)
+
+	rec := httptest.NewRecorder()
+	MoveHandler(rec, req)
+	return rec
+}
+
+func TestMoveHandlerPop(t *testing.T) {
+	cookie := newSessionCookie(t)
+
+	postMove(cookie, "drop", 2) // Blue
+	if rec := postMove(cookie, "pop", 2); rec.Code != http.StatusConflict {
+		t.Fatalf("popping the opponent's disc returned status %d", rec.Code)
+	}
+	postMove(cookie, "drop", 2) // Red
+	if rec := postMove(cookie, "pop", 2); rec.Code != http.StatusOK {
+		t.Fatalf("popping an own disc returned status %d", rec.Code)
+	}
+	if rec := postMove(cookie, "shove", 2); rec.Code != http.StatusBadRequest {
+		t.Fatalf("unknown move kind returned status %d", rec.Code)
+	}
+
+	board := popOut.Game(cookie.Value).GetBoard()
+	if board[5][2] != 'R' || board[4][2] != 0 {
+		t.Fatalf("expected the red disc to fall to the bottom after the pop")
+	}
+}
+
+func TestMoveHandlerConcurrent(t *testing.T) {
+	cookie := newSessionCookie(t)
+
+	var wg sync.WaitGroup
+	for worker := 0; worker < 8; worker++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			for i := 0; i < 25; i++ {
+				kind := "drop"
+				if i%3 == 0 {
+					kind = "pop"
+				}
+				if rec := postMove(cookie, kind, (worker+i)%7); rec.Code != http.StatusOK && rec.Code != http.StatusConflict {
+					t.Errorf("move returned status %d", rec.Code)
+				}
+			}
+		}(worker)
+	}
+	wg.Wait()
+
+	board := popOut.Game(cookie.Value).GetBoard()
+	for col := 0; col < 7; col++ {
+		for row := 1; row < 6; row++ {
+			if board[row-1][col] != 0 && board[row][col] == 0 {
+				t.Fatalf("floating disc above row %d column %d", row, col)
+			}
+		}
+	}
+}
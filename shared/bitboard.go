@@ -0,0 +1,407 @@
+package shared
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// Game is the public API shared by the Power engine and its bitboard
+// counterpart
+type Game interface {
+	MakeMove(coord Coordinate) (Coordinate, error)
+	IsValidMove(coord Coordinate) bool
+	GetGameState() GameState
+	IsGameOver() bool
+	GetWinner() *Player
+	GetCurrentPlayer() Player
+	GetSettings() GameSettings
+	GetBoard() [][]rune
+	WinningCells() []Coordinate
+	ResetGame()
+	Undo() (Move, error)
+	Redo() (Move, error)
+	CanUndo() bool
+	CanRedo() bool
+	History() []Move
+}
+
+var (
+	_ Game = (*Power)(nil)
+	_ Game = (*BitPower)(nil)
+)
+
+// MaxBitboardSize is the largest number of rows or columns a BitPower
+// handles, matching the largest bonus board
+const MaxBitboardSize = 15
+
+// ErrUnsupportedSettings is returned by NewBitboardGame for rules the
+// bitboard engine does not implement
+var ErrUnsupportedSettings = errors.New("settings not supported by the bitboard engine")
+
+// bitboard is a set of cells. Each column takes Rows+1 bits, bottom cell
+// first: the spare bit on top keeps lines from wrapping into the next
+// column. 15 columns of 16 bits fit in 256 bits.
+type bitboard [4]uint64
+
+func (b bitboard) and(o bitboard) bitboard {
+	return bitboard{b[0] & o[0], b[1] & o[1], b[2] & o[2], b[3] & o[3]}
+}
+
+func (b bitboard) or(o bitboard) bitboard {
+	return bitboard{b[0] | o[0], b[1] | o[1], b[2] | o[2], b[3] | o[3]}
+}
+
+func (b bitboard) isZero() bool {
+	return b[0]|b[1]|b[2]|b[3] == 0
+}
+
+func (b bitboard) has(i int) bool {
+	return b[i/64]&(1<<(i%64)) != 0
+}
+
+func (b *bitboard) set(i int) {
+	b[i/64] |= 1 << (i % 64)
+}
+
+func (b *bitboard) clear(i int) {
+	b[i/64] &^= 1 << (i % 64)
+}
+
+// shr moves every cell n bits towards index 0
+func (b bitboard) shr(n int) bitboard {
+	var r bitboard
+	words, offset := n/64, uint(n%64)
+	for i := 0; i+words < len(b); i++ {
+		r[i] = b[i+words] >> offset
+		if offset != 0 && i+words+1 < len(b) {
+			r[i] |= b[i+words+1] << (64 - offset)
+		}
+	}
+	return r
+}
+
+// shl moves every cell n bits away from index 0
+func (b bitboard) shl(n int) bitboard {
+	var r bitboard
+	words, offset := n/64, uint(n%64)
+	for i := len(b) - 1; i-words >= 0; i-- {
+		r[i] = b[i-words] << offset
+		if offset != 0 && i-words-1 >= 0 {
+			r[i] |= b[i-words-1] >> (64 - offset)
+		}
+	}
+	return r
+}
+
+// BitPower is a bitboard implementation of the classic rules with the same
+// public API as Power: pieces fall to the bottom, two players alternate and
+// the first line of WinLength pieces wins. Victory detection checks every
+// line of the board with a few word-wide shifts instead of walking cells.
+//
+// Like Power, BitPower is safe for concurrent use: every exported method
+// takes the internal lock.
+type BitPower struct {
+	mu        sync.Mutex
+	settings  GameSettings
+	stride    int         // Bits per column (Rows + 1)
+	pieces    [2]bitboard // Pieces of BLUE and RED
+	heights   []int       // Pieces stacked in each column
+	moves     int         // Pieces on the board
+	isPlaying Player
+	state     GameState
+	winning   bitboard // Cells of the winning line(s)
+	history   []Move
+	undone    []Move
+}
+
+// NewBitboardGame creates a bitboard game, rejecting boards larger than
+// MaxBitboardSize, gravities other than DOWN, variants other than the
+// classic rules, more than two players, boards that are not flat or have
+// obstacles, and invalid settings
+func NewBitboardGame(settings GameSettings) (*BitPower, error) {
+	if err := settings.Validate(); err != nil {
+		return nil, err
+	}
+	if settings.Rows > MaxBitboardSize || settings.Columns > MaxBitboardSize {
+		return nil, fmt.Errorf("%w: board is larger than %dx%d", ErrUnsupportedSettings, MaxBitboardSize, MaxBitboardSize)
+	}
+	if settings.Gravity != DOWN {
+		return nil, fmt.Errorf("%w: gravity %v", ErrUnsupportedSettings, settings.Gravity)
+	}
+	if settings.Variant != "" && settings.Variant != DefaultVariant {
+		return nil, fmt.Errorf("%w: variant %q", ErrUnsupportedSettings, settings.Variant)
+	}
+	if settings.Topology != FLAT {
+		return nil, fmt.Errorf("%w: topology %v", ErrUnsupportedSettings, settings.Topology)
+	}
+	if settings.Obstacles != (Obstacles{}) {
+		return nil, fmt.Errorf("%w: obstacles", ErrUnsupportedSettings)
+	}
+	if len(settings.Twists.Twists) > 0 {
+		return nil, fmt.Errorf("%w: twists", ErrUnsupportedSettings)
+	}
+	if settings.players() != MinPlayers {
+		return nil, fmt.Errorf("%w: %d players", ErrUnsupportedSettings, settings.Players)
+	}
+
+	settings.WinLength = settings.winLength()
+	settings.Variant = DefaultVariant
+	settings.Players = MinPlayers
+	return &BitPower{
+		settings:  settings,
+		stride:    settings.Rows + 1,
+		heights:   make([]int, settings.Columns),
+		isPlaying: BLUE,
+		state:     ONGOING,
+	}, nil
+}
+
+// bit returns the index of a cell given as a Power row (0 is the top row)
+func (b *BitPower) bit(row, col int) int {
+	return col*b.stride + (b.settings.Rows - 1 - row)
+}
+
+// MakeMove drops the current player's piece in coord.Column and returns the
+// cell where it landed, with the same errors as Power.MakeMove
+func (b *BitPower) MakeMove(coord Coordinate) (Coordinate, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	placed, err := b.drop(coord.Column)
+	if err != nil {
+		return Coordinate{}, err
+	}
+	b.history = append(b.history, Move{Player: b.lastMover(), Coordinate: placed})
+	b.undone = nil
+	return placed, nil
+}
+
+// drop plays a piece for the current player without touching the history
+func (b *BitPower) drop(col int) (Coordinate, error) {
+	if b.state != ONGOING {
+		return Coordinate{}, ErrGameOver
+	}
+	if col < 0 || col >= b.settings.Columns {
+		return Coordinate{}, ErrColumnOutOfRange
+	}
+	if b.heights[col] >= b.settings.Rows {
+		return Coordinate{}, ErrColumnFull
+	}
+
+	row := b.settings.Rows - 1 - b.heights[col]
+	b.pieces[b.isPlaying].set(b.bit(row, col))
+	b.heights[col]++
+	b.moves++
+
+	if winning := b.winningLines(b.pieces[b.isPlaying]); !winning.isZero() {
+		b.winning = winning
+		b.state = WON
+	} else if b.moves == b.settings.Rows*b.settings.Columns {
+		b.state = DRAW
+	} else {
+		b.isPlaying = opponent(b.isPlaying)
+	}
+	return Coordinate{Column: col, Row: row}, nil
+}
+
+// lastMover returns the player who made the last move
+func (b *BitPower) lastMover() Player {
+	if b.state == ONGOING {
+		return opponent(b.isPlaying)
+	}
+	return b.isPlaying
+}
+
+// opponent returns the other player of a bitboard game, which is always
+// played by two
+func opponent(player Player) Player {
+	return 1 - player
+}
+
+// winningLines returns every cell of the lines of at least WinLength pieces
+func (b *BitPower) winningLines(pieces bitboard) bitboard {
+	var cells bitboard
+	length := b.settings.WinLength
+	for _, shift := range [4]int{1, b.stride, b.stride + 1, b.stride - 1} {
+		// starts marks the first cell of each run of length pieces
+		starts := pieces
+		for i := 1; i < length && !starts.isZero(); i++ {
+			starts = starts.and(pieces.shr(i * shift))
+		}
+		for i := 0; i < length && !starts.isZero(); i++ {
+			cells = cells.or(starts.shl(i * shift))
+		}
+	}
+	return cells
+}
+
+// IsValidMove checks if a move is valid without making it
+func (b *BitPower) IsValidMove(coord Coordinate) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.state == ONGOING && coord.Column >= 0 && coord.Column < b.settings.Columns &&
+		b.heights[coord.Column] < b.settings.Rows
+}
+
+// GetGameState returns the current game state
+func (b *BitPower) GetGameState() GameState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.state
+}
+
+// IsGameOver returns true if the game has ended
+func (b *BitPower) IsGameOver() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.state != ONGOING
+}
+
+// GetWinner returns the winning player, or nil if no winner yet
+func (b *BitPower) GetWinner() *Player {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state != WON {
+		return nil
+	}
+	winner := b.isPlaying
+	return &winner
+}
+
+// GetCurrentPlayer returns the player whose turn it is
+func (b *BitPower) GetCurrentPlayer() Player {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.isPlaying
+}
+
+// GetSettings returns the settings the game was created with
+func (b *BitPower) GetSettings() GameSettings {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.settings
+}
+
+// GetBoard returns the board in the same layout as Power.Board
+func (b *BitPower) GetBoard() [][]rune {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	board := initBoard(b.settings, nil)
+	for row := range board {
+		for col := range board[row] {
+			i := b.bit(row, col)
+			switch {
+			case b.pieces[BLUE].has(i):
+				board[row][col] = BLUE.Piece()
+			case b.pieces[RED].has(i):
+				board[row][col] = RED.Piece()
+			}
+		}
+	}
+	return board
+}
+
+// WinningCells returns every cell of the line(s) that won the game, or nil
+// while nobody has won
+func (b *BitPower) WinningCells() []Coordinate {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var cells []Coordinate
+	for row := 0; row < b.settings.Rows; row++ {
+		for col := 0; col < b.settings.Columns; col++ {
+			if b.winning.has(b.bit(row, col)) {
+				cells = append(cells, Coordinate{Column: col, Row: row})
+			}
+		}
+	}
+	return cells
+}
+
+// ResetGame resets the game to initial state
+func (b *BitPower) ResetGame() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.pieces = [2]bitboard{}
+	b.heights = make([]int, b.settings.Columns)
+	b.moves = 0
+	b.isPlaying = BLUE
+	b.state = ONGOING
+	b.winning = bitboard{}
+	b.history = nil
+	b.undone = nil
+}
+
+// Undo takes back the last move. Bitboard moves are reversible, so only the
+// moves themselves are kept in the history.
+func (b *BitPower) Undo() (Move, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if len(b.history) == 0 {
+		return Move{}, ErrNothingToUndo
+	}
+
+	last := b.history[len(b.history)-1]
+	b.history = b.history[:len(b.history)-1]
+	b.undone = append(b.undone, last)
+
+	b.pieces[last.Player].clear(b.bit(last.Row, last.Column))
+	b.heights[last.Column]--
+	b.moves--
+	b.isPlaying = last.Player
+	b.state = ONGOING
+	b.winning = bitboard{}
+	return last, nil
+}
+
+// Redo replays the most recently undone move
+func (b *BitPower) Redo() (Move, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if len(b.undone) == 0 {
+		return Move{}, ErrNothingToRedo
+	}
+
+	next := b.undone[len(b.undone)-1]
+	if _, err := b.drop(next.Column); err != nil {
+		return Move{}, err
+	}
+	b.undone = b.undone[:len(b.undone)-1]
+	b.history = append(b.history, next)
+	return next, nil
+}
+
+// CanUndo reports whether there is a move to take back
+func (b *BitPower) CanUndo() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return len(b.history) > 0
+}
+
+// CanRedo reports whether there is an undone move to replay
+func (b *BitPower) CanRedo() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return len(b.undone) > 0
+}
+
+// History returns the moves played so far, oldest first
+func (b *BitPower) History() []Move {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return append(make([]Move, 0, len(b.history)), b.history...)
+}
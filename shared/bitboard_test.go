@@ -0,0 +1,141 @@
+package shared
+
+import (
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"reflect"
+	"slices"
+	"testing"
+)
+
+// sortedCells orders cells so results of both engines can be compared
+func sortedCells(cells []Coordinate) []Coordinate {
+	slices.SortFunc(cells, func(a, b Coordinate) int {
+		if a.Row != b.Row {
+			return a.Row - b.Row
+		}
+		return a.Column - b.Column
+	})
+	return cells
+}
+
+// checkSameGame fails when the two engines disagree on the observable state
+func checkSameGame(t *testing.T, step int, want, got Game) {
+	t.Helper()
+
+	if w, g := want.GetGameState(), got.GetGameState(); w != g {
+		t.Fatalf("step %d: state %v, bitboard has %v", step, w, g)
+	}
+	if w, g := want.GetCurrentPlayer(), got.GetCurrentPlayer(); w != g {
+		t.Fatalf("step %d: current player %v, bitboard has %v", step, w, g)
+	}
+	if !reflect.DeepEqual(want.GetBoard(), got.GetBoard()) {
+		t.Fatalf("step %d: boards differ", step)
+	}
+	if w, g := sortedCells(want.WinningCells()), sortedCells(got.WinningCells()); !reflect.DeepEqual(w, g) {
+		t.Fatalf("step %d: winning cells %v, bitboard has %v", step, w, g)
+	}
+	if !reflect.DeepEqual(want.History(), got.History()) {
+		t.Fatalf("step %d: histories differ", step)
+	}
+	if want.CanUndo() != got.CanUndo() || want.CanRedo() != got.CanRedo() {
+		t.Fatalf("step %d: undo/redo availability differs", step)
+	}
+}
+
+func TestBitboardMatchesPower(t *testing.T) {
+	settings := []GameSettings{
+		{Rows: 6, Columns: 7},
+		{Rows: 4, Columns: 4, WinLength: 3},
+		{Rows: 8, Columns: 5, WinLength: 5},
+		{Rows: 15, Columns: 15},
+		{Rows: 15, Columns: 15, WinLength: 6},
+	}
+
+	for _, s := range settings {
+		t.Run(fmt.Sprintf("%dx%d-%d", s.Rows, s.Columns, s.winLength()), func(t *testing.T) {
+			rng := rand.New(rand.NewPCG(uint64(s.Rows), uint64(s.Columns)))
+			for game := 0; game < 50; game++ {
+				want := NewGameInstance(s)
+				got, err := NewBitboardGame(s)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				for step := 0; step < s.Rows*s.Columns*2; step++ {
+					switch rng.IntN(10) {
+					case 0:
+						_, wantErr := want.Undo()
+						_, gotErr := got.Undo()
+						if !errors.Is(gotErr, wantErr) {
+							t.Fatalf("step %d: undo error %v, bitboard has %v", step, wantErr, gotErr)
+						}
+					case 1:
+						_, wantErr := want.Redo()
+						_, gotErr := got.Redo()
+						if !errors.Is(gotErr, wantErr) {
+							t.Fatalf("step %d: redo error %v, bitboard has %v", step, wantErr, gotErr)
+						}
+					default:
+						coord := Coordinate{Column: rng.IntN(s.Columns+2) - 1}
+						if want.IsValidMove(coord) != got.IsValidMove(coord) {
+							t.Fatalf("step %d: engines disagree on column %d", step, coord.Column)
+						}
+						wantCell, wantErr := want.MakeMove(coord)
+						gotCell, gotErr := got.MakeMove(coord)
+						if !errors.Is(gotErr, wantErr) || wantCell != gotCell {
+							t.Fatalf("step %d: move got %v, %v, bitboard got %v, %v", step, wantCell, wantErr, gotCell, gotErr)
+						}
+					}
+					checkSameGame(t, step, want, got)
+				}
+			}
+		})
+	}
+}
+
+func TestBitboardRejectsLargeBoards(t *testing.T) {
+	for _, s := range []GameSettings{{Rows: 16, Columns: 7}, {Rows: 6, Columns: 16}} {
+		if _, err := NewBitboardGame(s); !errors.Is(err, ErrUnsupportedSettings) {
+			t.Errorf("%dx%d: expected ErrUnsupportedSettings, got %v", s.Rows, s.Columns, err)
+		}
+	}
+	if _, err := NewBitboardGame(GameSettings{Rows: 0, Columns: 7}); !errors.Is(err, ErrInvalidSettings) {
+		t.Errorf("expected ErrInvalidSettings, got %v", err)
+	}
+}
+
+// benchmarkGames plays random games to the end with the given engine. The
+// same columns are tried for both engines so their timings are comparable.
+func benchmarkGames(b *testing.B, settings GameSettings, newGame func() Game) {
+	rng := rand.New(rand.NewPCG(1, 2))
+	columns := make([]int, 4096)
+	for i := range columns {
+		columns[i] = rng.IntN(settings.Columns)
+	}
+
+	next := 0
+	for b.Loop() {
+		game := newGame()
+		for !game.IsGameOver() {
+			game.MakeMove(Coordinate{Column: columns[next%len(columns)]})
+			next++
+		}
+	}
+}
+
+func BenchmarkEngines(b *testing.B) {
+	for _, s := range []GameSettings{{Rows: 6, Columns: 7}, {Rows: 15, Columns: 15, WinLength: 5}} {
+		name := fmt.Sprintf("%dx%d", s.Rows, s.Columns)
+		b.Run("Power/"+name, func(b *testing.B) {
+			benchmarkGames(b, s, func() Game { return NewGameInstance(s) })
+		})
+		b.Run("Bitboard/"+name, func(b *testing.B) {
+			benchmarkGames(b, s, func() Game {
+				game, _ := NewBitboardGame(s)
+				return game
+			})
+		})
+	}
+}
@@ -0,0 +1,356 @@
+package shared
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// EventType names what happened to a game; it is the SSE event field
+type EventType string
+
+const (
+	EVENT_MOVE       EventType = "move"       // A piece was dropped, placed or popped
+	EVENT_GAME_OVER  EventType = "game-over"  // The game was won or drawn
+	EVENT_SCORES     EventType = "scores"     // The scores changed
+	EVENT_GRAVITY    EventType = "gravity"    // The gravity flipped
+	EVENT_BOARD      EventType = "board"      // The game was replaced: new game, undo or redo
+	EVENT_SEATS      EventType = "seats"      // A player took a seat in a room
+	EVENT_SPECTATORS EventType = "spectators" // A spectator opened or closed a room
+)
+
+// DefaultHeartbeat is how often an idle event stream sends a comment so
+// proxies keep the connection open
+const DefaultHeartbeat = 15 * time.Second
+
+// DefaultMaxEventTopics caps the games a hub keeps events for: the least
+// recently used one makes room for a new one
+const DefaultMaxEventTopics = 10000
+
+// eventBacklog is the number of past events kept per game for clients
+// resuming with Last-Event-ID
+const eventBacklog = 64
+
+// eventBuffer is the number of events a subscriber may lag behind before
+// its stream is ended
+const eventBuffer = 16
+
+// gameIDBytes is the amount of randomness in a game ID
+const gameIDBytes = 8
+
+// Event is a message published about a game. IDs count up from 1 for
+// each game.
+type Event struct {
+	ID   uint64
+	Type EventType
+	Data []byte // JSON payload
+}
+
+// GameUpdate is the payload of every game event: the game as it stands
+// once the change is applied, so a page can redraw from any event alone
+type GameUpdate struct {
+	Board         [][]int      `json:"board"`          // 0=empty, the 1-based player number, then blockers
+	CurrentPlayer int          `json:"currentPlayer"`  // 1-based number of the player to move
+	State         string       `json:"state"`          // "Ongoing", "Won" or "Draw"
+	Winner        int          `json:"winner"`         // 1-based number of the winner, 0 if none
+	WinningCells  []Coordinate `json:"winningCells"`   // Discs of the winning line(s)
+	Gravity       string       `json:"gravity"`        // Direction pieces fall in
+	Scores        []int        `json:"scores"`         // Games won by each player
+	Move          *Coordinate  `json:"move,omitempty"` // Cell played, for EVENT_MOVE
+}
+
+// NewGameUpdate captures a game and the scores of its players. Blockers
+// come right after the last of the players on the board.
+func NewGameUpdate(p *Power, scores []int) GameUpdate {
+	board := p.GetBoard()
+	players := p.GetSettings().Players
+	cells := make([][]int, len(board))
+	for i := range board {
+		cells[i] = make([]int, len(board[i]))
+		for j, piece := range board[i] {
+			if piece == Blocker {
+				cells[i][j] = players + 1
+				continue
+			}
+			for player := Player(0); int(player) < players; player++ {
+				if piece == player.Piece() {
+					cells[i][j] = int(player) + 1
+				}
+			}
+		}
+	}
+
+	update := GameUpdate{
+		Board:         cells,
+		CurrentPlayer: int(p.GetCurrentPlayer()) + 1,
+		State:         p.GetGameState().String(),
+		WinningCells:  p.WinningCells(),
+		Gravity:       p.GetGravity().String(),
+		Scores:        scores,
+	}
+	if winner := p.GetWinner(); winner != nil {
+		update.Winner = int(*winner) + 1
+	}
+	return update
+}
+
+// NewGameID generates a random hex-encoded game ID. Unlike a session ID it
+// can be shown in URLs: it only gives access to the game.
+func NewGameID() string {
+	buf := make([]byte, gameIDBytes)
+	if _, err := rand.Read(buf); err != nil {
+		panic("events: cannot read random bytes: " + err.Error())
+	}
+	return hex.EncodeToString(buf)
+}
+
+// IsValidGameID rejects IDs that could not have been issued by NewGameID
+func IsValidGameID(id string) bool {
+	if len(id) != gameIDBytes*2 {
+		return false
+	}
+	_, err := hex.DecodeString(id)
+	return err == nil
+}
+
+// EventHub fans game events out to the streams following each game. It
+// keeps the last events of every game so that a stream can resume from
+// Last-Event-ID; games nobody published to or followed for longer than the
+// TTL are dropped, and the hub never keeps more than max games.
+type EventHub struct {
+	mu        sync.Mutex
+	topics    map[string]*eventTopic
+	ttl       time.Duration
+	max       int
+	heartbeat time.Duration
+	lastSweep time.Time
+}
+
+// eventTopic is the event history and the subscribers of one game
+type eventTopic struct {
+	lastID      uint64
+	recent      []Event // Last eventBacklog events, oldest first
+	subscribers map[chan Event]bool
+	lastSeen    time.Time
+}
+
+// Events carries the events of every game, keyed by game ID
+var Events = NewEventHub(DefaultSessionTTL, DefaultHeartbeat)
+
+// NewEventHub creates a hub dropping games idle for ttl, whose streams send
+// a heartbeat every heartbeat of silence
+func NewEventHub(ttl, heartbeat time.Duration) *EventHub {
+	return &EventHub{
+		topics:    make(map[string]*eventTopic),
+		ttl:       ttl,
+		max:       DefaultMaxEventTopics,
+		heartbeat: heartbeat,
+	}
+}
+
+// topic returns the history of a game, creating it if needed. Callers
+// hold h.mu.
+func (h *EventHub) topic(id string, now time.Time) *eventTopic {
+	h.sweep(now)
+
+	t, ok := h.topics[id]
+	if !ok {
+		if len(h.topics) >= h.max {
+			h.evictOldest()
+		}
+		t = &eventTopic{subscribers: make(map[chan Event]bool)}
+		h.topics[id] = t
+	}
+	t.lastSeen = now
+	return t
+}
+
+// sweep drops idle games without subscribers, at most once per TTL or
+// sweep interval, whichever is shorter. Callers hold h.mu.
+func (h *EventHub) sweep(now time.Time) {
+	if now.Sub(h.lastSweep) < min(h.ttl, sweepInterval) {
+		return
+	}
+	h.lastSweep = now
+
+	for id, t := range h.topics {
+		if len(t.subscribers) == 0 && now.Sub(t.lastSeen) > h.ttl {
+			delete(h.topics, id)
+		}
+	}
+}
+
+// evictOldest drops the least recently used game, ending its streams.
+// Callers hold h.mu.
+func (h *EventHub) evictOldest() {
+	var oldest string
+	var oldestSeen time.Time
+	for id, t := range h.topics {
+		if oldest == "" || t.lastSeen.Before(oldestSeen) {
+			oldest, oldestSeen = id, t.lastSeen
+		}
+	}
+	t := h.topics[oldest]
+	for ch := range t.subscribers {
+		delete(t.subscribers, ch)
+		close(ch)
+	}
+	delete(h.topics, oldest)
+}
+
+// Publish sends an event with data encoded as JSON to the streams of a
+// game. A stream too slow to keep up is ended; its browser reconnects and
+// resumes from the history.
+func (h *EventHub) Publish(game string, eventType EventType, data any) {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		log.Printf("events: cannot encode %s event: %v", eventType, err)
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	t := h.topic(game, time.Now())
+	t.lastID++
+	event := Event{ID: t.lastID, Type: eventType, Data: payload}
+	t.recent = append(t.recent, event)
+	if len(t.recent) > eventBacklog {
+		t.recent = append([]Event(nil), t.recent[len(t.recent)-eventBacklog:]...)
+	}
+
+	for ch := range t.subscribers {
+		select {
+		case ch <- event:
+		default:
+			delete(t.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// PublishGame sends an event carrying the game as it stands and the scores
+// of its players; move is the cell just played, if any
+func (h *EventHub) PublishGame(game string, eventType EventType, p *Power, scores []int, move *Coordinate) {
+	update := NewGameUpdate(p, scores)
+	update.Move = move
+	h.Publish(game, eventType, update)
+}
+
+// Subscribe follows the events of a game. lastID is the last event the
+// caller has seen, 0 for a new follower: the kept events after it are
+// returned as missed. An ID the game never reached means the history was
+// lost, so every kept event is missed. The channel is closed when the
+// caller falls behind; cancel must be called once done.
+func (h *EventHub) Subscribe(game string, lastID uint64) (missed []Event, events <-chan Event, cancel func()) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	t := h.topic(game, time.Now())
+	if lastID > 0 {
+		for _, event := range t.recent {
+			if event.ID > lastID || lastID > t.lastID {
+				missed = append(missed, event)
+			}
+		}
+	}
+
+	ch := make(chan Event, eventBuffer)
+	t.subscribers[ch] = true
+	cancel = func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+
+		if t.subscribers[ch] {
+			delete(t.subscribers, ch)
+			close(ch)
+		}
+		t.lastSeen = time.Now()
+	}
+	return missed, ch, cancel
+}
+
+// writeEvent writes an event in the text/event-stream format
+func writeEvent(w http.ResponseWriter, event Event) error {
+	_, err := fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, event.Data)
+	return err
+}
+
+// ServeHTTP streams the events of the game named by the {id} path value as
+// Server-Sent Events, starting with those missed since Last-Event-ID
+func (h *EventHub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	game := r.PathValue("id")
+	if !IsValidGameID(game) {
+		http.Error(w, "Game not found", http.StatusNotFound)
+		return
+	}
+	h.Stream(w, r, game, nil)
+}
+
+// Stream streams the events of a game as Server-Sent Events, starting with
+// those missed since Last-Event-ID, until the client goes away. opened, if
+// not nil, runs once the stream follows the game, so the events it
+// publishes reach the stream too.
+func (h *EventHub) Stream(w http.ResponseWriter, r *http.Request, game string, opened func()) {
+	var lastID uint64
+	if header := r.Header.Get("Last-Event-ID"); header != "" {
+		id, err := strconv.ParseUint(header, 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid Last-Event-ID", http.StatusBadRequest)
+			return
+		}
+		lastID = id
+	}
+
+	missed, events, cancel := h.Subscribe(game, lastID)
+	defer cancel()
+	if opened != nil {
+		opened()
+	}
+
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	for _, event := range missed {
+		if writeEvent(w, event) != nil {
+			return
+		}
+	}
+	if rc.Flush() != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(h.heartbeat)
+	defer heartbeat.Stop()
+	for {
+		var err error
+		select {
+		case <-r.Context().Done():
+			return
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			err = writeEvent(w, event)
+		case <-heartbeat.C:
+			_, err = fmt.Fprint(w, ": heartbeat\n\n")
+		}
+		if err != nil || rc.Flush() != nil {
+			return
+		}
+		heartbeat.Reset(h.heartbeat)
+	}
+}
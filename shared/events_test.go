@@ -0,0 +1,221 @@
+package shared
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// eventServer serves a hub the way main.go mounts it
+func eventServer(t *testing.T, hub *EventHub) *httptest.Server {
+	t.Helper()
+
+	mux := http.NewServeMux()
+	mux.Handle("GET /games/{id}/events", hub)
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+// openStream requests the event stream of a game, resuming after lastID
+// when it is set
+func openStream(t *testing.T, url, lastID string) *bufio.Reader {
+	t.Helper()
+
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lastID != "" {
+		req.Header.Set("Last-Event-ID", lastID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("stream returned status %d", resp.StatusCode)
+	}
+	if got := resp.Header.Get("Content-Type"); got != "text/event-stream" {
+		t.Fatalf("stream has content type %q", got)
+	}
+	return bufio.NewReader(resp.Body)
+}
+
+// readBlock returns the lines of the next message or comment of a stream
+func readBlock(t *testing.T, stream *bufio.Reader) []string {
+	t.Helper()
+
+	var lines []string
+	for {
+		line, err := stream.ReadString('\n')
+		if err != nil {
+			t.Fatalf("stream ended: %v", err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		if line == "" {
+			return lines
+		}
+		lines = append(lines, line)
+	}
+}
+
+// waitForSubscriber waits until a stream of game is following the hub
+func waitForSubscriber(t *testing.T, hub *EventHub, game string) {
+	t.Helper()
+
+	for range 100 {
+		hub.mu.Lock()
+		topic, ok := hub.topics[game]
+		followed := ok && len(topic.subscribers) > 0
+		hub.mu.Unlock()
+		if followed {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("stream never subscribed")
+}
+
+func TestEventStream(t *testing.T) {
+	hub := NewEventHub(time.Hour, 50*time.Millisecond)
+	server := eventServer(t, hub)
+	game := NewGameID()
+
+	stream := openStream(t, server.URL+"/games/"+game+"/events", "")
+	waitForSubscriber(t, hub, game)
+
+	p := NewGameInstance(GameSettings{Rows: 6, Columns: 7})
+	placed, err := p.MakeMove(Coordinate{Column: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	update := NewGameUpdate(p, []int{0, 0})
+	update.Move = &placed
+	hub.Publish(game, EVENT_MOVE, update)
+
+	block := readBlock(t, stream)
+	if len(block) != 3 || block[0] != "id: 1" || block[1] != "event: move" {
+		t.Fatalf("got event %q", block)
+	}
+	var got GameUpdate
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(block[2], "data: ")), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Board[5][3] != 1 || got.CurrentPlayer != 2 || got.Move == nil || *got.Move != placed {
+		t.Fatalf("got update %+v", got)
+	}
+
+	// An idle stream keeps sending heartbeats
+	if block := readBlock(t, stream); len(block) != 1 || !strings.HasPrefix(block[0], ":") {
+		t.Fatalf("got %q, want a heartbeat", block)
+	}
+}
+
+func TestEventStreamResume(t *testing.T) {
+	hub := NewEventHub(time.Hour, time.Hour)
+	server := eventServer(t, hub)
+	game := NewGameID()
+
+	for _, eventType := range []EventType{EVENT_MOVE, EVENT_GAME_OVER, EVENT_SCORES} {
+		hub.Publish(game, eventType, GameUpdate{})
+	}
+
+	stream := openStream(t, server.URL+"/games/"+game+"/events", "1")
+	for _, want := range []string{"id: 2", "id: 3"} {
+		if block := readBlock(t, stream); block[0] != want {
+			t.Fatalf("got event %q, want %s", block, want)
+		}
+	}
+
+	// A new follower does not get the history, a follower ahead of the
+	// game gets all of it
+	if missed, _, cancel := hub.Subscribe(game, 0); len(missed) != 0 {
+		t.Fatalf("new follower missed %d events", len(missed))
+	} else {
+		cancel()
+	}
+	if missed, _, cancel := hub.Subscribe(game, 40); len(missed) != 3 {
+		t.Fatalf("follower with a lost history missed %d events, want 3", len(missed))
+	} else {
+		cancel()
+	}
+}
+
+func TestEventHubSlowSubscriber(t *testing.T) {
+	hub := NewEventHub(time.Hour, time.Hour)
+	game := NewGameID()
+
+	_, events, cancel := hub.Subscribe(game, 0)
+	defer cancel()
+	for range eventBuffer + 1 {
+		hub.Publish(game, EVENT_MOVE, GameUpdate{})
+	}
+
+	received := 0
+	for range events {
+		received++
+	}
+	if received != eventBuffer {
+		t.Fatalf("received %d events before the stream ended, want %d", received, eventBuffer)
+	}
+
+	// The history still holds the dropped event
+	if missed, _, cancel := hub.Subscribe(game, eventBuffer); len(missed) != 1 {
+		t.Fatalf("resuming missed %d events, want 1", len(missed))
+	} else {
+		cancel()
+	}
+}
+
+func TestEventStreamErrors(t *testing.T) {
+	server := eventServer(t, NewEventHub(time.Hour, time.Hour))
+
+	tests := []struct {
+		path, lastID string
+		want         int
+	}{
+		{"/games/not-a-game/events", "", http.StatusNotFound},
+		{"/games/" + NewGameID() + "/events", "abc", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest(http.MethodGet, server.URL+tt.path, nil)
+		req.Header.Set("Last-Event-ID", tt.lastID)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tt.want {
+			t.Errorf("GET %s returned status %d, want %d", tt.path, resp.StatusCode, tt.want)
+		}
+	}
+}
+
+func TestEventHubCap(t *testing.T) {
+	hub := NewEventHub(time.Hour, time.Hour)
+	hub.max = 2
+
+	first, second := NewGameID(), NewGameID()
+	_, events, cancel := hub.Subscribe(first, 0)
+	defer cancel()
+	time.Sleep(time.Millisecond)
+	hub.Publish(second, EVENT_MOVE, GameUpdate{})
+	time.Sleep(time.Millisecond)
+	hub.Publish(NewGameID(), EVENT_MOVE, GameUpdate{})
+
+	// The oldest game is dropped and its stream ended
+	if _, ok := <-events; ok {
+		t.Fatal("expected the stream of the dropped game to end")
+	}
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+	if _, kept := hub.topics[first]; kept || len(hub.topics) != 2 {
+		t.Fatalf("hub holds %d games, want 2 without the oldest", len(hub.topics))
+	}
+}
@@ -1,32 +1,205 @@
 package shared
 
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+)
+
+// Player is the index of a player in turn order
 type Player int
 
 const (
 	BLUE Player = iota
 	RED
+	GREEN
+	YELLOW
+)
+
+// Number of players a game can be played by
+const (
+	MinPlayers = 2
+	MaxPlayers = 4
 )
 
+// pieces marks the pieces of each player on the board
+var pieces = [MaxPlayers]rune{'B', 'R', 'G', 'Y'}
+
 type GameState int
 
 const (
 	ONGOING GameState = iota
-	BLUE_WINS
-	RED_WINS
+	WON               // GetWinner tells who won
 	DRAW
 )
 
+// Phase is the stage of a game whose rules change as it goes on
+type Phase int
+
+const (
+	PLAYING    Phase = iota // Regular play
+	SETTING_UP              // Pop 10: the board is being filled
+	POPPING                 // Pop 10: players pop their discs from the bottom row
+	RETURNING               // Pop 10: a popped disc that was in no line goes back on top
+)
+
+// Gravity is the direction pieces fall in
+type Gravity int
+
+const (
+	DOWN  Gravity = iota // Pieces stack from the bottom of a column
+	UP                   // Pieces stack from the top of a column
+	LEFT                 // Pieces stack from the left of a row
+	RIGHT                // Pieces stack from the right of a row
+	NONE                 // Pieces stay in the cell they are played in (gomoku)
+)
+
+// Topology is the way the edges of the board connect
+type Topology int
+
+const (
+	FLAT     Topology = iota // Lines stop at the edges of the board
+	CYLINDER                 // The left and right edges are joined: lines wrap across Columns
+)
+
 type GameSettings struct {
-	Rows    int
-	Columns int
+	Rows      int
+	Columns   int
+	WinLength int     // Pieces in a row needed to win, DefaultWinLength when zero
+	Gravity   Gravity // Gravity at the start of the game
+	Variant   string  // Name of a registered Variant, DefaultVariant when empty
+	Players   int     // Players taking turns, MinPlayers when zero
+	Topology  Topology
+	Obstacles Obstacles     // Neutral cells blocked before the first move
+	Twists    TwistSchedule // Events that change the game between turns
+}
+
+// DefaultWinLength is the classic Connect 4 rule
+const DefaultWinLength = 4
+
+// GomokuWinLength is the default win length when pieces do not fall
+const GomokuWinLength = 5
+
+// MinWinLength is the shortest line that can win a game
+const MinWinLength = 3
+
+// ErrInvalidSettings is wrapped by every error GameSettings.Validate returns
+var ErrInvalidSettings = errors.New("invalid game settings")
+
+// Errors returned by GameSettings.Validate, by rule broken
+var (
+	ErrEmptyBoard          = fmt.Errorf("%w: board must have at least one row and one column", ErrInvalidSettings)
+	ErrWinLengthTooShort   = fmt.Errorf("%w: win length is too short", ErrInvalidSettings)
+	ErrLineTooLong         = fmt.Errorf("%w: winning line does not fit on the board", ErrInvalidSettings)
+	ErrUnknownGravity      = fmt.Errorf("%w: unknown gravity", ErrInvalidSettings)
+	ErrUnknownTopology     = fmt.Errorf("%w: unknown topology", ErrInvalidSettings)
+	ErrUnknownVariant      = fmt.Errorf("%w: unknown variant", ErrInvalidSettings)
+	ErrPlayerCount         = fmt.Errorf("%w: unsupported number of players", ErrInvalidSettings)
+	ErrCylinderQuarterTurn = fmt.Errorf("%w: a cylinder cannot turn a quarter", ErrInvalidSettings)
+)
+
+// Validate checks that the board exists and that a winning line fits on it
+func (s GameSettings) Validate() error {
+	if s.Rows <= 0 || s.Columns <= 0 {
+		return ErrEmptyBoard
+	}
+
+	winLength := s.winLength()
+	if winLength < MinWinLength {
+		return fmt.Errorf("%w: %d, want at least %d", ErrWinLengthTooShort, winLength, MinWinLength)
+	}
+	if winLength > s.Rows && winLength > s.Columns {
+		return fmt.Errorf("%w: a line of %d on a %dx%d board", ErrLineTooLong, winLength, s.Rows, s.Columns)
+	}
+	if s.Gravity < DOWN || s.Gravity > NONE {
+		return fmt.Errorf("%w: %d", ErrUnknownGravity, s.Gravity)
+	}
+	if s.Topology < FLAT || s.Topology > CYLINDER {
+		return fmt.Errorf("%w: %d", ErrUnknownTopology, s.Topology)
+	}
+	if err := s.Obstacles.validate(s.Rows, s.Columns); err != nil {
+		return err
+	}
+	if err := s.Twists.validate(); err != nil {
+		return err
+	}
+	if s.Topology == CYLINDER && slices.Contains(s.Twists.Twists, ROTATE_QUARTER) {
+		return ErrCylinderQuarterTurn
+	}
+	variant, ok := LookupVariant(s.Variant)
+	if !ok {
+		return fmt.Errorf("%w: %q", ErrUnknownVariant, s.Variant)
+	}
+
+	players := s.players()
+	if players < MinPlayers || players > MaxPlayers {
+		return fmt.Errorf("%w: %d, want %d to %d", ErrPlayerCount, players, MinPlayers, MaxPlayers)
+	}
+	if limited, ok := variant.(PlayerLimit); ok && players > limited.MaxPlayers() {
+		return fmt.Errorf("%w: %s is played by at most %d players", ErrPlayerCount, variant.Name(), limited.MaxPlayers())
+	}
+	return nil
+}
+
+// Step returns the cell next to (row, col) in a direction, following the
+// topology of the board, and false when the step leaves the board
+func (s GameSettings) Step(row, col, deltaRow, deltaCol int) (int, int, bool) {
+	row, col = row+deltaRow, col+deltaCol
+	if s.Topology == CYLINDER {
+		col = (col%s.Columns + s.Columns) % s.Columns
+	}
+	return row, col, row >= 0 && row < s.Rows && col >= 0 && col < s.Columns
+}
+
+// players returns the configured number of players or the two of the
+// classic game
+func (s GameSettings) players() int {
+	if s.Players == 0 {
+		return MinPlayers
+	}
+	return s.Players
+}
+
+// winLength returns the configured win length or the default of the mode
+func (s GameSettings) winLength() int {
+	if s.WinLength == 0 {
+		if s.Gravity == NONE {
+			return GomokuWinLength
+		}
+		return DefaultWinLength
+	}
+	return s.WinLength
 }
 
 // Board size can be modified in the game overlay while not in game
+//
+// Power is safe for concurrent use: every exported method takes the internal
+// lock, while unexported helpers expect the caller to already hold it. The
+// exported fields may only be touched directly by a caller that otherwise
+// serializes all access to the game; concurrent readers should use GetBoard
+// and the other accessors instead.
 type Power struct {
-	Board     [][]rune
-	IsPlaying Player
-	Settings  GameSettings
-	State     GameState
+	mu           sync.Mutex
+	Board        [][]rune
+	IsPlaying    Player
+	Settings     GameSettings
+	State        GameState
+	Gravity      Gravity             // Direction the next piece falls in
+	variant      Variant             // Rules the game is played with
+	turns        int                 // Moves played so far
+	phase        Phase               // Stage of the game, for variants that have several
+	winner       Player              // Player who won, when State is WON
+	captured     [MaxPlayers]int     // Pieces each player has taken off the board
+	obstacles    map[Coordinate]bool // Blocked cells of a new board
+	lockedColumn int                 // Column closed by a LOCK_COLUMN twist
+	lockedUntil  int                 // Turn the locked column opens again, 0 when none is
+	lastTwist    *TwistEvent         // Twist that happened after the last move
+	turned       bool                // Whether a quarter turn swapped Settings.Rows and Settings.Columns
+	keepTurn     bool                // Set by a variant so the current move does not pass the turn
+	winningCells []Coordinate        // Cells of the winning line(s), if any
+	history      []turn              // Moves played, oldest first
+	undone       []turn              // Undone moves, most recently undone last
 }
 
 type Coordinate struct {
@@ -34,101 +207,259 @@ type Coordinate struct {
 	Row    int
 }
 
-func initBoard(settings GameSettings) [][]rune {
+// MoveKind tells what a move does with its column (or row)
+type MoveKind int
+
+const (
+	DROP MoveKind = iota // Put a piece in
+	POP                  // Take a piece out from the gravity edge (Pop Out)
+)
+
+// Action is a move a player asks for: what to do, and in which column (or
+// row, when pieces fall sideways)
+type Action struct {
+	Kind MoveKind
+	Coordinate
+}
+
+// Errors returned by MakeMove when a move is rejected
+var (
+	ErrGameOver         = errors.New("game is already over")
+	ErrColumnOutOfRange = errors.New("column is out of range")
+	ErrColumnFull       = errors.New("column is full")
+	ErrRowOutOfRange    = errors.New("row is out of range")
+	ErrRowFull          = errors.New("row is full")
+	ErrCellOccupied     = errors.New("cell is already occupied")
+)
+
+// initBoard creates an empty board with a Blocker in every obstacle cell
+func initBoard(settings GameSettings, obstacles map[Coordinate]bool) [][]rune {
 	board := make([][]rune, settings.Rows)
 
 	for i := 0; i < settings.Rows; i++ {
 		board[i] = make([]rune, settings.Columns)
 	}
+	for cell := range obstacles {
+		board[cell.Row][cell.Column] = Blocker
+	}
 	return board
 }
 
+// NewGameInstance creates a game played with the variant named in the
+// settings, falling back to the classic rules for an unknown name
 func NewGameInstance(settings GameSettings) *Power {
-	return &Power{
-		Board:     initBoard(settings),
+	settings.WinLength = settings.winLength()
+	settings.Players = settings.players()
+	variant, ok := LookupVariant(settings.Variant)
+	if !ok {
+		variant = Classic{}
+	}
+	settings.Variant = variant.Name()
+	obstacles := settings.Obstacles.cells(settings.Rows, settings.Columns, settings.Gravity)
+
+	p := &Power{
+		Board:     initBoard(settings, obstacles),
 		IsPlaying: BLUE,
 		Settings:  settings,
 		State:     ONGOING,
+		Gravity:   settings.Gravity,
+		variant:   variant,
+		obstacles: obstacles,
 	}
+	variant.Start(p.position())
+	return p
+}
+
+// MakeMove drops the current player's piece according to the variant and
+// returns the cell where it landed. With the classic rules the piece is
+// played in coord.Column (DOWN, UP) or coord.Row (LEFT, RIGHT) and falls onto
+// the empty cell closest to the gravity edge; with NONE it stays in the cell
+// at coord.Row, coord.Column. The board is left untouched when an error is
+// returned.
+func (p *Power) MakeMove(coord Coordinate) (Coordinate, error) {
+	return p.Play(Action{Kind: DROP, Coordinate: coord})
 }
 
-func (p *Power) MakeMove(coord Coordinate) {
+// Play makes any move the variant allows, such as a POP in Pop Out, and
+// returns the cell the move changed. The board is left untouched when an
+// error is returned.
+func (p *Power) Play(action Action) (Coordinate, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
 	// Don't allow moves if game is over
 	if p.State != ONGOING {
-		return
+		return Coordinate{}, ErrGameOver
 	}
 
-	if coord.Column < 0 || coord.Column >= p.Settings.Columns {
-		return
+	pos := p.position()
+	if err := p.variant.CheckMove(pos, action); err != nil {
+		return Coordinate{}, err
 	}
 
-	for row := p.Settings.Rows - 1; row >= 0; row-- {
-		if p.Board[row][coord.Column] == 0 {
-			if p.IsPlaying == BLUE {
-				p.Board[row][coord.Column] = 'B'
-			} else {
-				p.Board[row][coord.Column] = 'R'
-			}
-
-			// Check for victory or draw after the move
-			p.checkGameState(row, coord.Column)
+	before := p.snapshot()
+	cell := p.variant.Apply(pos, action)
+	p.endTurn(before, Move{Player: p.IsPlaying, Kind: action.Kind, Coordinate: cell})
+	return cell, nil
+}
 
-			// Switch player only if game is still ongoing
-			if p.State == ONGOING {
-				if p.IsPlaying == BLUE {
-					p.IsPlaying = RED
-				} else {
-					p.IsPlaying = BLUE
-				}
-			}
-			break
+// lane returns the cells of the column of coord (or its row, when pieces
+// fall sideways), starting from the gravity edge. Without gravity the lane
+// is the cell itself.
+func (p *Power) lane(coord Coordinate) ([]Coordinate, error) {
+	var row, col, length int
+	switch p.Gravity {
+	case NONE:
+		if coord.Column < 0 || coord.Column >= p.Settings.Columns {
+			return nil, ErrColumnOutOfRange
+		}
+		if coord.Row < 0 || coord.Row >= p.Settings.Rows {
+			return nil, ErrRowOutOfRange
+		}
+		return []Coordinate{coord}, nil
+	case LEFT, RIGHT:
+		if coord.Row < 0 || coord.Row >= p.Settings.Rows {
+			return nil, ErrRowOutOfRange
 		}
+		row, col, length = coord.Row, 0, p.Settings.Columns
+		if p.Gravity == RIGHT {
+			col = p.Settings.Columns - 1
+		}
+	default:
+		if coord.Column < 0 || coord.Column >= p.Settings.Columns {
+			return nil, ErrColumnOutOfRange
+		}
+		row, col, length = p.Settings.Rows-1, coord.Column, p.Settings.Rows
+		if p.Gravity == UP {
+			row = 0
+		}
+	}
+
+	// Walk from the gravity edge against the gravity
+	deltaRow, deltaCol := p.Gravity.delta()
+	cells := make([]Coordinate, length)
+	for i := range cells {
+		cells[i] = Coordinate{Column: col, Row: row}
+		row, col = row-deltaRow, col-deltaCol
 	}
+	return cells, nil
 }
 
-// checkGameState checks for victory or draw conditions after a move
-func (p *Power) checkGameState(lastRow, lastCol int) {
-	// Check if current player won
-	if p.checkVictory(lastRow, lastCol) {
-		if p.IsPlaying == BLUE {
-			p.State = BLUE_WINS
-		} else {
-			p.State = RED_WINS
+// landing returns the cell where a piece played in coord comes to rest under
+// the current gravity. Pieces stack from the gravity edge, so each lane is
+// filled from its two ends and its empty cells stay contiguous. A Blocker
+// acts as the gravity edge: pieces stack on top of the blocker closest to
+// the side they are played from, and the cells behind it cannot be reached.
+func (p *Power) landing(coord Coordinate) (row, col int, err error) {
+	cells, err := p.lane(coord)
+	if err != nil {
+		return 0, 0, err
+	}
+	for i := len(cells) - 1; i >= 0; i-- {
+		if p.Board[cells[i].Row][cells[i].Column] == Blocker {
+			cells = cells[i+1:]
+			break
+		}
+	}
+	for _, cell := range cells {
+		if p.Board[cell.Row][cell.Column] == 0 {
+			return cell.Row, cell.Column, nil
 		}
-		return
 	}
+	switch p.Gravity {
+	case NONE:
+		return 0, 0, ErrCellOccupied
+	case LEFT, RIGHT:
+		return 0, 0, ErrRowFull
+	}
+	return 0, 0, ErrColumnFull
+}
 
-	// Check for draw (board full)
-	if p.isBoardFull() {
-		p.State = DRAW
+// SetGravity changes the direction the next pieces fall in. Pieces already
+// on the board stay where they are. The change is part of the last move, so
+// Undo and Redo restore it along with the move; moves that could have been
+// redone are dropped.
+func (p *Power) SetGravity(gravity Gravity) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.Gravity = gravity
+	if len(p.history) > 0 {
+		p.history[len(p.history)-1].after = p.snapshot()
 	}
+	p.undone = nil
 }
 
-// checkVictory checks if the last move resulted in a victory
-func (p *Power) checkVictory(row, col int) bool {
-	piece := p.Board[row][col]
+// GetGravity returns the direction the next piece falls in
+func (p *Power) GetGravity() Gravity {
+	p.mu.Lock()
+	defer p.mu.Unlock()
 
-	// Check horizontal
-	if p.checkDirection(row, col, 0, 1, piece) >= 4 {
-		return true
-	}
+	return p.Gravity
+}
 
-	// Check vertical
-	if p.checkDirection(row, col, 1, 0, piece) >= 4 {
-		return true
+// endTurn lets the variant decide the outcome of a move, passes the turn if
+// the game goes on and records the move. Callers hold p.mu.
+func (p *Power) endTurn(before snapshot, move Move) {
+	pos := p.position()
+	p.turns++
+	p.keepTurn = false
+	p.State = p.variant.Outcome(pos, move)
+
+	// Switch player only if game is still ongoing
+	if p.State == ONGOING {
+		if !p.keepTurn {
+			p.IsPlaying = p.nextPlayer(p.IsPlaying)
+		}
+		p.variant.AfterTurn(pos)
+		p.State = p.twist(move.Player)
+	} else {
+		p.lastTwist = nil
 	}
 
-	// Check diagonal (top-left to bottom-right)
-	if p.checkDirection(row, col, 1, 1, piece) >= 4 {
-		return true
+	p.record(move, before)
+}
+
+// directions are the four line orientations checked for a victory
+var directions = [4][2]int{
+	{0, 1},  // horizontal
+	{1, 0},  // vertical
+	{1, 1},  // diagonal (top-left to bottom-right)
+	{1, -1}, // diagonal (top-right to bottom-left)
+}
+
+// checkVictory checks if the last move completed a line of WinLength pieces
+// and records every cell of the winning line(s)
+func (p *Power) checkVictory(row, col int) bool {
+	cells := p.winningLine(row, col)
+	if cells == nil {
+		return false
 	}
 
-	// Check diagonal (top-right to bottom-left)
-	if p.checkDirection(row, col, 1, -1, piece) >= 4 {
-		return true
+	p.winningCells = cells
+	return true
+}
+
+// winningLine returns every cell of the lines of at least WinLength pieces
+// through (row, col), or nil when there is none
+func (p *Power) winningLine(row, col int) []Coordinate {
+	piece := p.Board[row][col]
+	if piece == 0 || piece == Blocker {
+		return nil
 	}
+	winLength := p.Settings.winLength()
 
-	return false
+	var cells []Coordinate
+	for _, dir := range directions {
+		if p.checkDirection(row, col, dir[0], dir[1], piece) >= winLength {
+			// A single piece can complete several lines at once
+			cells = append(cells, p.lineCells(row, col, dir[0], dir[1], piece)...)
+		}
+	}
+	if cells == nil {
+		return nil
+	}
+	return append(cells, Coordinate{Column: col, Row: row})
 }
 
 // checkDirection counts consecutive pieces in a given direction
@@ -136,28 +467,66 @@ func (p *Power) checkDirection(row, col, deltaRow, deltaCol int, piece rune) int
 	count := 1 // Count the current piece
 
 	// Check in positive direction
-	r, c := row+deltaRow, col+deltaCol
-	for r >= 0 && r < p.Settings.Rows && c >= 0 && c < p.Settings.Columns && p.Board[r][c] == piece {
+	r, c, ok := p.Settings.Step(row, col, deltaRow, deltaCol)
+	for ok && p.Board[r][c] == piece {
+		if r == row && c == col {
+			// The line goes all the way around the cylinder
+			return count
+		}
 		count++
-		r += deltaRow
-		c += deltaCol
+		r, c, ok = p.Settings.Step(r, c, deltaRow, deltaCol)
 	}
 
 	// Check in negative direction
-	r, c = row-deltaRow, col-deltaCol
-	for r >= 0 && r < p.Settings.Rows && c >= 0 && c < p.Settings.Columns && p.Board[r][c] == piece {
+	r, c, ok = p.Settings.Step(row, col, -deltaRow, -deltaCol)
+	for ok && p.Board[r][c] == piece {
 		count++
-		r -= deltaRow
-		c -= deltaCol
+		r, c, ok = p.Settings.Step(r, c, -deltaRow, -deltaCol)
 	}
 
 	return count
 }
 
-// isBoardFull checks if the board is completely full
+// lineCells returns the cells of the line through (row, col) that hold piece,
+// excluding (row, col) itself
+func (p *Power) lineCells(row, col, deltaRow, deltaCol int, piece rune) []Coordinate {
+	var cells []Coordinate
+	for _, sign := range [2]int{1, -1} {
+		r, c, ok := p.Settings.Step(row, col, sign*deltaRow, sign*deltaCol)
+		for ok && p.Board[r][c] == piece {
+			if r == row && c == col {
+				// The line goes all the way around the cylinder
+				return cells
+			}
+			cells = append(cells, Coordinate{Column: c, Row: r})
+			r, c, ok = p.Settings.Step(r, c, sign*deltaRow, sign*deltaCol)
+		}
+	}
+	return cells
+}
+
+// isBoardFull checks if the board is completely full. Every cell is checked
+// because pieces played without gravity can leave gaps below the top row.
+// Whatever the gravity, a piece can be dropped as long as its lane has an
+// empty cell, so a full board is a draw. With blockers, a board whose empty
+// cells all lie behind a blocker is full too.
 func (p *Power) isBoardFull() bool {
-	for col := 0; col < p.Settings.Columns; col++ {
-		if p.Board[0][col] == 0 {
+	full := true
+	for row := 0; row < p.Settings.Rows && full; row++ {
+		for col := 0; col < p.Settings.Columns; col++ {
+			if p.Board[row][col] == 0 {
+				full = false
+				break
+			}
+		}
+	}
+	if full || len(p.obstacles) == 0 {
+		return full
+	}
+
+	// Empty cells behind a blocker cannot be played
+	for _, lane := range Lanes(p.position()) {
+		if _, _, err := p.landing(lane); err == nil {
 			return false
 		}
 	}
@@ -166,47 +535,129 @@ func (p *Power) isBoardFull() bool {
 
 // GetGameState returns the current game state
 func (p *Power) GetGameState() GameState {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
 	return p.State
 }
 
 // IsGameOver returns true if the game has ended
 func (p *Power) IsGameOver() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
 	return p.State != ONGOING
 }
 
 // GetWinner returns the winning player, or nil if no winner yet
 func (p *Power) GetWinner() *Player {
-	switch p.State {
-	case BLUE_WINS:
-		winner := BLUE
-		return &winner
-	case RED_WINS:
-		winner := RED
-		return &winner
-	default:
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.State != WON {
 		return nil
 	}
+	winner := p.winner
+	return &winner
 }
 
 // ResetGame resets the game to initial state
 func (p *Power) ResetGame() {
-	p.Board = initBoard(p.Settings)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.turned {
+		p.Settings.Rows, p.Settings.Columns = p.Settings.Columns, p.Settings.Rows
+		p.turned = false
+	}
+	p.Board = initBoard(p.Settings, p.obstacles)
 	p.IsPlaying = BLUE
 	p.State = ONGOING
+	p.Gravity = p.Settings.Gravity
+	p.turns = 0
+	p.phase = PLAYING
+	p.winner = 0
+	p.captured = [MaxPlayers]int{}
+	p.lockedUntil = 0
+	p.lastTwist = nil
+	p.winningCells = nil
+	p.history = nil
+	p.undone = nil
+	p.variant.Start(p.position())
 }
 
 // IsValidMove checks if a move is valid without making it
 func (p *Power) IsValidMove(coord Coordinate) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
 	if p.State != ONGOING {
 		return false
 	}
 
-	if coord.Column < 0 || coord.Column >= p.Settings.Columns {
-		return false
+	return p.variant.CheckMove(p.position(), Action{Kind: DROP, Coordinate: coord}) == nil
+}
+
+// LegalMoves lists the moves the current player can make, none once the
+// game is over
+func (p *Power) LegalMoves() []Action {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.State != ONGOING {
+		return nil
 	}
+	return p.variant.LegalMoves(p.position())
+}
+
+// GetVariant returns the rules the game is played with
+func (p *Power) GetVariant() Variant {
+	p.mu.Lock()
+	defer p.mu.Unlock()
 
-	// Check if column has space (top row is empty)
-	return p.Board[0][coord.Column] == 0
+	return p.variant
+}
+
+// Turns returns the number of moves played so far
+func (p *Power) Turns() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.turns
+}
+
+// GetPhase returns the stage of the game
+func (p *Power) GetPhase() Phase {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.phase
+}
+
+// Captured returns how many pieces a player has taken off the board
+func (p *Power) Captured(player Player) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.captured[player]
+}
+
+// Piece returns the rune that marks the player's pieces on the board
+func (player Player) Piece() rune {
+	return pieces[player]
+}
+
+// NextPlayer returns the player who plays after player
+func (p *Power) NextPlayer(player Player) Player {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.nextPlayer(player)
+}
+
+// nextPlayer returns the player who plays after player. Callers hold p.mu.
+func (p *Power) nextPlayer(player Player) Player {
+	return (player + 1) % Player(p.Settings.players())
 }
 
 // String returns a string representation of the player
@@ -216,6 +667,99 @@ func (player Player) String() string {
 		return "Blue"
 	case RED:
 		return "Red"
+	case GREEN:
+		return "Green"
+	case YELLOW:
+		return "Yellow"
+	default:
+		return "Unknown"
+	}
+}
+
+// delta returns the step a falling piece takes, in rows and columns
+func (gravity Gravity) delta() (int, int) {
+	switch gravity {
+	case UP:
+		return -1, 0
+	case LEFT:
+		return 0, -1
+	case RIGHT:
+		return 0, 1
+	case NONE:
+		return 0, 0
+	default:
+		return 1, 0
+	}
+}
+
+// opposite returns the gravity pulling the other way. NONE stays NONE.
+func (gravity Gravity) opposite() Gravity {
+	switch gravity {
+	case DOWN:
+		return UP
+	case UP:
+		return DOWN
+	case LEFT:
+		return RIGHT
+	case RIGHT:
+		return LEFT
+	}
+	return gravity
+}
+
+// String returns a string representation of the gravity
+func (gravity Gravity) String() string {
+	switch gravity {
+	case DOWN:
+		return "Down"
+	case UP:
+		return "Up"
+	case LEFT:
+		return "Left"
+	case RIGHT:
+		return "Right"
+	case NONE:
+		return "None"
+	default:
+		return "Unknown"
+	}
+}
+
+// String returns a string representation of the move kind
+func (kind MoveKind) String() string {
+	switch kind {
+	case DROP:
+		return "Drop"
+	case POP:
+		return "Pop"
+	default:
+		return "Unknown"
+	}
+}
+
+// String returns a string representation of the topology
+func (topology Topology) String() string {
+	switch topology {
+	case FLAT:
+		return "Flat"
+	case CYLINDER:
+		return "Cylinder"
+	default:
+		return "Unknown"
+	}
+}
+
+// String returns a string representation of the phase
+func (phase Phase) String() string {
+	switch phase {
+	case PLAYING:
+		return "Playing"
+	case SETTING_UP:
+		return "Setting up"
+	case POPPING:
+		return "Popping"
+	case RETURNING:
+		return "Returning"
 	default:
 		return "Unknown"
 	}
@@ -226,10 +770,8 @@ func (state GameState) String() string {
 	switch state {
 	case ONGOING:
 		return "Ongoing"
-	case BLUE_WINS:
-		return "Blue Wins"
-	case RED_WINS:
-		return "Red Wins"
+	case WON:
+		return "Won"
 	case DRAW:
 		return "Draw"
 	default:
@@ -237,7 +779,52 @@ func (state GameState) String() string {
 	}
 }
 
+// GetBoard returns a copy of the board that stays valid after the lock is released
+func (p *Power) GetBoard() [][]rune {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	board := make([][]rune, len(p.Board))
+	for i := range p.Board {
+		board[i] = append([]rune(nil), p.Board[i]...)
+	}
+	return board
+}
+
+// Clone returns an independent copy of the game, without its move history,
+// that can be played on freely (e.g. to search ahead)
+func (p *Power) Clone() *Power {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	current := p.snapshot()
+	clone := &Power{Settings: p.Settings, variant: p.variant, obstacles: p.obstacles}
+	clone.restore(current)
+	return clone
+}
+
+// WinningCells returns every cell of the line(s) that won the game, or nil
+// while nobody has won
+func (p *Power) WinningCells() []Coordinate {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return append([]Coordinate(nil), p.winningCells...)
+}
+
 // GetCurrentPlayer returns the player whose turn it is
 func (p *Power) GetCurrentPlayer() Player {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
 	return p.IsPlaying
 }
+
+// GetSettings returns the settings the game was created with. Rows and
+// Columns are those of the board as it is now, swapped by quarter turns.
+func (p *Power) GetSettings() GameSettings {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.Settings
+}
@@ -0,0 +1,441 @@
+package shared
+
+import (
+	"errors"
+	"sync"
+	"testing"
+)
+
+// checkBoardConsistency verifies that pieces are stacked without holes and
+// that both players have played alternately
+func checkBoardConsistency(t *testing.T, p *Power) {
+	t.Helper()
+
+	board := p.GetBoard()
+	blue, red := 0, 0
+	for col := 0; col < p.Settings.Columns; col++ {
+		seenEmpty := false
+		for row := p.Settings.Rows - 1; row >= 0; row-- {
+			switch board[row][col] {
+			case 0:
+				seenEmpty = true
+			case 'B', 'R':
+				if seenEmpty {
+					t.Fatalf("floating piece at row %d column %d", row, col)
+				}
+				if board[row][col] == 'B' {
+					blue++
+				} else {
+					red++
+				}
+			default:
+				t.Fatalf("unexpected piece %q at row %d column %d", board[row][col], row, col)
+			}
+		}
+	}
+	if blue != red && blue != red+1 {
+		t.Fatalf("players did not alternate: %d blue pieces, %d red pieces", blue, red)
+	}
+}
+
+// hasWon reports whether player won the game
+func hasWon(p *Power, player Player) bool {
+	winner := p.GetWinner()
+	return p.GetGameState() == WON && winner != nil && *winner == player
+}
+
+func TestPowerConcurrentMoves(t *testing.T) {
+	for round := 0; round < 20; round++ {
+		p := NewGameInstance(GameSettings{Rows: 6, Columns: 7})
+
+		var wg sync.WaitGroup
+		for worker := 0; worker < 8; worker++ {
+			wg.Add(1)
+			go func(worker int) {
+				defer wg.Done()
+				for i := 0; i < 50; i++ {
+					coord := Coordinate{Column: (worker + i) % p.Settings.Columns}
+					if p.IsValidMove(coord) {
+						p.MakeMove(coord)
+					}
+					p.GetBoard()
+					p.GetCurrentPlayer()
+					p.GetWinner()
+				}
+			}(worker)
+		}
+		wg.Wait()
+
+		checkBoardConsistency(t, p)
+	}
+}
+
+func TestPowerConcurrentReset(t *testing.T) {
+	p := NewGameInstance(GameSettings{Rows: 6, Columns: 7})
+
+	var wg sync.WaitGroup
+	for worker := 0; worker < 4; worker++ {
+		wg.Add(2)
+		go func(worker int) {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				p.MakeMove(Coordinate{Column: (worker * i) % p.Settings.Columns})
+			}
+		}(worker)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 20; i++ {
+				p.ResetGame()
+			}
+		}()
+	}
+	wg.Wait()
+
+	checkBoardConsistency(t, p)
+}
+
+func TestMakeMoveErrors(t *testing.T) {
+	p := NewGameInstance(GameSettings{Rows: 4, Columns: 4})
+
+	if _, err := p.MakeMove(Coordinate{Column: 4}); !errors.Is(err, ErrColumnOutOfRange) {
+		t.Fatalf("expected ErrColumnOutOfRange, got %v", err)
+	}
+
+	for row := 3; row >= 0; row-- {
+		placed, err := p.MakeMove(Coordinate{Column: 0})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if placed != (Coordinate{Column: 0, Row: row}) {
+			t.Fatalf("piece landed at %+v, expected row %d", placed, row)
+		}
+	}
+	if _, err := p.MakeMove(Coordinate{Column: 0}); !errors.Is(err, ErrColumnFull) {
+		t.Fatalf("expected ErrColumnFull, got %v", err)
+	}
+
+	// Blue wins on the bottom row
+	for _, col := range []int{1, 1, 2, 2, 3} {
+		p.MakeMove(Coordinate{Column: col})
+	}
+	if _, err := p.MakeMove(Coordinate{Column: 3}); !errors.Is(err, ErrGameOver) {
+		t.Fatalf("expected ErrGameOver, got %v", err)
+	}
+}
+
+func TestUndoRedo(t *testing.T) {
+	p := NewGameInstance(GameSettings{Rows: 6, Columns: 7})
+
+	if _, err := p.Undo(); !errors.Is(err, ErrNothingToUndo) {
+		t.Fatalf("expected ErrNothingToUndo, got %v", err)
+	}
+
+	// Blue wins on the bottom row with its fourth piece
+	for _, col := range []int{0, 0, 1, 1, 2, 2, 3} {
+		p.MakeMove(Coordinate{Column: col})
+	}
+	if !hasWon(p, BLUE) {
+		t.Fatalf("expected blue to win, got %v", p.GetGameState())
+	}
+
+	move, err := p.Undo()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if move != (Move{Player: BLUE, Coordinate: Coordinate{Column: 3, Row: 5}}) {
+		t.Fatalf("undid %+v", move)
+	}
+	if p.GetGameState() != ONGOING || p.GetCurrentPlayer() != BLUE || p.GetBoard()[5][3] != 0 {
+		t.Fatal("undo did not restore the position before the winning move")
+	}
+
+	if _, err := p.Redo(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !hasWon(p, BLUE) || p.GetBoard()[5][3] != 'B' {
+		t.Fatal("redo did not replay the winning move")
+	}
+
+	p.Undo()
+	p.MakeMove(Coordinate{Column: 6})
+	if _, err := p.Redo(); !errors.Is(err, ErrNothingToRedo) {
+		t.Fatalf("a new move should clear the redo stack, got %v", err)
+	}
+	if got := len(p.History()); got != 7 {
+		t.Fatalf("expected 7 moves in history, got %d", got)
+	}
+}
+
+func TestWinLength(t *testing.T) {
+	if err := (GameSettings{Rows: 6, Columns: 7, WinLength: 8}).Validate(); !errors.Is(err, ErrLineTooLong) {
+		t.Fatalf("expected ErrLineTooLong for a line longer than the board, got %v", err)
+	}
+	if err := (GameSettings{Rows: 4, Columns: 4, WinLength: 2}).Validate(); !errors.Is(err, ErrWinLengthTooShort) {
+		t.Fatalf("expected ErrWinLengthTooShort for a too short line, got %v", err)
+	}
+
+	p := NewGameInstance(GameSettings{Rows: 4, Columns: 4, WinLength: 3})
+	for _, col := range []int{0, 0, 1, 1, 2} {
+		p.MakeMove(Coordinate{Column: col})
+	}
+	if !hasWon(p, BLUE) {
+		t.Fatalf("expected blue to win Connect-3, got %v", p.GetGameState())
+	}
+
+	p = NewGameInstance(GameSettings{Rows: 15, Columns: 15, WinLength: 5})
+	for _, col := range []int{0, 0, 1, 1, 2, 2, 3, 3} {
+		p.MakeMove(Coordinate{Column: col})
+	}
+	if p.GetGameState() != ONGOING {
+		t.Fatal("four in a row must not win Connect-5")
+	}
+	p.MakeMove(Coordinate{Column: 4})
+	if !hasWon(p, BLUE) {
+		t.Fatalf("expected blue to win Connect-5, got %v", p.GetGameState())
+	}
+}
+
+func TestWinningCellsMultipleLines(t *testing.T) {
+	p := NewGameInstance(GameSettings{Rows: 6, Columns: 7, WinLength: 4, Gravity: NONE})
+
+	// Blue's last piece completes a horizontal and a vertical line at once
+	moves := []Coordinate{
+		{Row: 5, Column: 0}, {Row: 0, Column: 6},
+		{Row: 5, Column: 1}, {Row: 1, Column: 6},
+		{Row: 5, Column: 2}, {Row: 2, Column: 6},
+		{Row: 4, Column: 3}, {Row: 0, Column: 5},
+		{Row: 3, Column: 3}, {Row: 0, Column: 4},
+		{Row: 2, Column: 3}, {Row: 1, Column: 5},
+		{Row: 5, Column: 3},
+	}
+	for _, move := range moves {
+		if _, err := p.MakeMove(move); err != nil {
+			t.Fatalf("unexpected error at %+v: %v", move, err)
+		}
+	}
+	if !hasWon(p, BLUE) {
+		t.Fatalf("expected blue to win, got %v", p.GetGameState())
+	}
+
+	got := make(map[Coordinate]bool)
+	for _, cell := range p.WinningCells() {
+		got[cell] = true
+	}
+	want := []Coordinate{
+		{Row: 5, Column: 0}, {Row: 5, Column: 1}, {Row: 5, Column: 2}, {Row: 5, Column: 3},
+		{Row: 4, Column: 3}, {Row: 3, Column: 3}, {Row: 2, Column: 3},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("expected %d winning cells, got %v", len(want), p.WinningCells())
+	}
+	for _, cell := range want {
+		if !got[cell] {
+			t.Fatalf("missing winning cell %+v in %v", cell, p.WinningCells())
+		}
+	}
+
+	p.Undo()
+	if cells := p.WinningCells(); cells != nil {
+		t.Fatalf("undo should clear the winning cells, got %v", cells)
+	}
+}
+
+func TestGravity(t *testing.T) {
+	tests := []struct {
+		gravity Gravity
+		coord   Coordinate
+		want    [2]Coordinate // Landing cells of two moves in the same lane
+	}{
+		{DOWN, Coordinate{Column: 2}, [2]Coordinate{{Column: 2, Row: 3}, {Column: 2, Row: 2}}},
+		{UP, Coordinate{Column: 2}, [2]Coordinate{{Column: 2, Row: 0}, {Column: 2, Row: 1}}},
+		{LEFT, Coordinate{Row: 1}, [2]Coordinate{{Column: 0, Row: 1}, {Column: 1, Row: 1}}},
+		{RIGHT, Coordinate{Row: 1}, [2]Coordinate{{Column: 4, Row: 1}, {Column: 3, Row: 1}}},
+	}
+
+	for _, tt := range tests {
+		p := NewGameInstance(GameSettings{Rows: 4, Columns: 5, Gravity: tt.gravity})
+		for i, want := range tt.want {
+			got, err := p.MakeMove(tt.coord)
+			if err != nil {
+				t.Fatalf("%v: move %d: %v", tt.gravity, i, err)
+			}
+			if got != want {
+				t.Errorf("%v: move %d landed on %+v, want %+v", tt.gravity, i, got, want)
+			}
+		}
+	}
+
+	// After a flip, pieces stack against the other end of the column and the
+	// column is only full once no cell is left
+	p := NewGameInstance(GameSettings{Rows: 3, Columns: 5})
+	landed := []int{}
+	for _, gravity := range []Gravity{DOWN, UP, DOWN} {
+		p.SetGravity(gravity)
+		placed, err := p.MakeMove(Coordinate{Column: 0})
+		if err != nil {
+			t.Fatal(err)
+		}
+		landed = append(landed, placed.Row)
+	}
+	if landed[0] != 2 || landed[1] != 0 || landed[2] != 1 {
+		t.Errorf("expected rows [2 0 1], got %v", landed)
+	}
+	if p.IsValidMove(Coordinate{Column: 0}) {
+		t.Error("column 0 should be full")
+	}
+	if _, err := p.MakeMove(Coordinate{Column: 0}); !errors.Is(err, ErrColumnFull) {
+		t.Errorf("expected ErrColumnFull, got %v", err)
+	}
+
+	p = NewGameInstance(GameSettings{Rows: 4, Columns: 3, Gravity: LEFT})
+	if _, err := p.MakeMove(Coordinate{Row: 4}); !errors.Is(err, ErrRowOutOfRange) {
+		t.Errorf("expected ErrRowOutOfRange, got %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		p.MakeMove(Coordinate{Row: 2})
+	}
+	if _, err := p.MakeMove(Coordinate{Row: 2}); !errors.Is(err, ErrRowFull) {
+		t.Errorf("expected ErrRowFull, got %v", err)
+	}
+	if err := (GameSettings{Rows: 4, Columns: 5, Gravity: NONE + 1}).Validate(); !errors.Is(err, ErrInvalidSettings) {
+		t.Errorf("expected ErrInvalidSettings for an unknown gravity, got %v", err)
+	}
+}
+
+func TestNoGravity(t *testing.T) {
+	p := NewGameInstance(GameSettings{Rows: 6, Columns: 7, Gravity: NONE})
+	if p.GetSettings().winLength() != GomokuWinLength {
+		t.Fatalf("expected a default win length of %d without gravity", GomokuWinLength)
+	}
+
+	placed, err := p.MakeMove(Coordinate{Column: 1, Row: 1})
+	if err != nil || placed != (Coordinate{Column: 1, Row: 1}) {
+		t.Fatalf("expected the piece to stay in row 1 column 1, got %+v (%v)", placed, err)
+	}
+	if _, err := p.MakeMove(Coordinate{Column: 1, Row: 1}); !errors.Is(err, ErrCellOccupied) {
+		t.Errorf("expected ErrCellOccupied, got %v", err)
+	}
+	if _, err := p.MakeMove(Coordinate{Column: 3, Row: 6}); !errors.Is(err, ErrRowOutOfRange) {
+		t.Errorf("expected ErrRowOutOfRange, got %v", err)
+	}
+	if moves := p.LegalMoves(); len(moves) != 6*7-1 {
+		t.Errorf("expected every empty cell to be playable, got %d moves", len(moves))
+	}
+
+	// Blue builds a diagonal from (1,1) while red plays the bottom row: four
+	// in a row is not enough, the fifth wins
+	for i := 1; i < 5; i++ {
+		p.MakeMove(Coordinate{Column: i - 1, Row: 5})
+		p.MakeMove(Coordinate{Column: 1 + i, Row: 1 + i})
+		if i < 4 && p.IsGameOver() {
+			t.Fatalf("game ended after %d blue pieces in a row", i+1)
+		}
+	}
+	if !hasWon(p, BLUE) || len(p.WinningCells()) != 5 {
+		t.Fatalf("expected blue to win with 5 cells, got %v with %v", p.GetGameState(), p.WinningCells())
+	}
+}
+
+func TestUndoRedoGravity(t *testing.T) {
+	p := NewGameInstance(GameSettings{Rows: 6, Columns: 7})
+	p.MakeMove(Coordinate{Column: 0})
+	p.SetGravity(UP)
+	p.MakeMove(Coordinate{Column: 1})
+
+	p.Undo()
+	if p.GetGravity() != UP {
+		t.Fatalf("undoing the second move should keep the flip, got %v", p.GetGravity())
+	}
+	p.Undo()
+	if p.GetGravity() != DOWN {
+		t.Fatalf("undoing the flipped move should restore DOWN, got %v", p.GetGravity())
+	}
+	p.Redo()
+	if p.GetGravity() != UP {
+		t.Fatalf("redoing the flipped move should restore UP, got %v", p.GetGravity())
+	}
+	if move, _ := p.Redo(); move.Row != 0 {
+		t.Fatalf("expected the redone move to stack from the top, got row %d", move.Row)
+	}
+}
+
+func TestFourPlayers(t *testing.T) {
+	settings := GameSettings{Rows: 6, Columns: 7, Players: 4}
+	if err := settings.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	p := NewGameInstance(settings)
+
+	// Turns rotate through every player, each with their own piece
+	for i, want := range []Player{BLUE, RED, GREEN, YELLOW, BLUE} {
+		if got := p.GetCurrentPlayer(); got != want {
+			t.Fatalf("turn %d: expected %v to play, got %v", i, want, got)
+		}
+		placed, _ := p.MakeMove(Coordinate{Column: i % 4})
+		if piece := p.GetBoard()[placed.Row][placed.Column]; piece != want.Piece() {
+			t.Fatalf("turn %d: expected piece %q, got %q", i, want.Piece(), piece)
+		}
+	}
+
+	// Green stacks a column while the others play elsewhere
+	for i := 0; i < 3; i++ {
+		p.MakeMove(Coordinate{Column: 4}) // Red
+		p.MakeMove(Coordinate{Column: 6}) // Green
+		p.MakeMove(Coordinate{Column: 5}) // Yellow
+		p.MakeMove(Coordinate{Column: 4}) // Blue
+	}
+	p.MakeMove(Coordinate{Column: 5}) // Red
+	p.MakeMove(Coordinate{Column: 6}) // Green
+	if !hasWon(p, GREEN) || p.GetGameState().String() != "Won" {
+		t.Fatalf("expected green to win, got %v", p.GetGameState())
+	}
+	p.Undo()
+	if p.GetWinner() != nil || p.GetCurrentPlayer() != GREEN {
+		t.Fatalf("undo should take back the win, got winner %v", p.GetWinner())
+	}
+
+	for _, bad := range []GameSettings{
+		{Rows: 6, Columns: 7, Players: 1},
+		{Rows: 6, Columns: 7, Players: MaxPlayers + 1},
+		{Rows: 6, Columns: 7, Players: 3, Variant: "popout"},
+	} {
+		if err := bad.Validate(); !errors.Is(err, ErrPlayerCount) || !errors.Is(err, ErrInvalidSettings) {
+			t.Errorf("%+v: expected ErrPlayerCount, got %v", bad, err)
+		}
+	}
+}
+
+func TestCylinder(t *testing.T) {
+	p := NewGameInstance(GameSettings{Rows: 6, Columns: 7, Topology: CYLINDER})
+
+	// Blue lines up columns 5, 6, 0 and 1 across the joined edges
+	for _, col := range []int{5, 6, 0} {
+		p.MakeMove(Coordinate{Column: col})
+		p.MakeMove(Coordinate{Column: 3})
+	}
+	p.MakeMove(Coordinate{Column: 1})
+	if !hasWon(p, BLUE) || len(p.WinningCells()) != 4 {
+		t.Fatalf("expected blue to win across the edges, got %v with %v", p.GetGameState(), p.WinningCells())
+	}
+
+	// A row filling the whole ring is counted once
+	p = NewGameInstance(GameSettings{Rows: 4, Columns: 4, Topology: CYLINDER})
+	for col := 0; col < 4; col++ {
+		p.MakeMove(Coordinate{Column: (col + 2) % 4})
+		if col < 3 {
+			p.MakeMove(Coordinate{Column: (col + 2) % 4})
+		}
+	}
+	if !hasWon(p, BLUE) || len(p.WinningCells()) != 4 {
+		t.Fatalf("expected blue to win with the full row, got %v with %v", p.GetGameState(), p.WinningCells())
+	}
+
+	flat := NewGameInstance(GameSettings{Rows: 6, Columns: 7})
+	for i, col := range []int{5, 6, 0, 1} {
+		flat.MakeMove(Coordinate{Column: col})
+		flat.MakeMove(Coordinate{Column: 3 + i%2})
+	}
+	if flat.IsGameOver() {
+		t.Fatal("lines should not wrap on a flat board")
+	}
+}
@@ -0,0 +1,183 @@
+package shared
+
+import "errors"
+
+// Errors returned by Undo and Redo
+var (
+	ErrNothingToUndo = errors.New("no move to undo")
+	ErrNothingToRedo = errors.New("no move to redo")
+)
+
+// Move is a move made by a player: the piece placed (or popped) and its cell
+type Move struct {
+	Player Player
+	Kind   MoveKind
+	Coordinate
+}
+
+// snapshot is the part of a Power that a move can change
+type snapshot struct {
+	board        [][]rune
+	rows         int
+	columns      int
+	turned       bool
+	isPlaying    Player
+	state        GameState
+	winner       Player
+	gravity      Gravity
+	turns        int
+	phase        Phase
+	captured     [MaxPlayers]int
+	lockedColumn int
+	lockedUntil  int
+	lastTwist    *TwistEvent
+	winningCells []Coordinate
+}
+
+// turn is a history entry: the move and the game before and after it
+type turn struct {
+	move   Move
+	before snapshot
+	after  snapshot
+}
+
+// snapshot copies the mutable game state. Callers hold p.mu.
+func (p *Power) snapshot() snapshot {
+	board := make([][]rune, len(p.Board))
+	for i := range p.Board {
+		board[i] = append([]rune(nil), p.Board[i]...)
+	}
+	return snapshot{
+		board:        board,
+		rows:         p.Settings.Rows,
+		columns:      p.Settings.Columns,
+		turned:       p.turned,
+		isPlaying:    p.IsPlaying,
+		state:        p.State,
+		winner:       p.winner,
+		gravity:      p.Gravity,
+		turns:        p.turns,
+		phase:        p.phase,
+		captured:     p.captured,
+		lockedColumn: p.lockedColumn,
+		lockedUntil:  p.lockedUntil,
+		lastTwist:    p.lastTwist,
+		winningCells: append([]Coordinate(nil), p.winningCells...),
+	}
+}
+
+// restore puts the game back into a snapshot taken earlier. The board is
+// copied so the snapshot can be restored again. Callers hold p.mu.
+func (p *Power) restore(s snapshot) {
+	p.Board = make([][]rune, len(s.board))
+	for i := range s.board {
+		p.Board[i] = append([]rune(nil), s.board[i]...)
+	}
+	p.Settings.Rows, p.Settings.Columns = s.rows, s.columns
+	p.turned = s.turned
+	p.IsPlaying = s.isPlaying
+	p.State = s.state
+	p.winner = s.winner
+	p.Gravity = s.gravity
+	p.turns = s.turns
+	p.phase = s.phase
+	p.captured = s.captured
+	p.lockedColumn = s.lockedColumn
+	p.lockedUntil = s.lockedUntil
+	p.lastTwist = s.lastTwist
+	p.winningCells = append([]Coordinate(nil), s.winningCells...)
+}
+
+// repetitions counts the earlier positions with the same board as now and
+// the player after the current one to move: while a move is being played,
+// how often the position it reaches occurred before. Callers hold p.mu.
+func (p *Power) repetitions() int {
+	next := p.nextPlayer(p.IsPlaying)
+	count := 0
+	for _, t := range p.history {
+		if t.before.isPlaying == next && sameBoard(t.before.board, p.Board) {
+			count++
+		}
+	}
+	return count
+}
+
+// sameBoard reports whether two boards hold the same pieces
+func sameBoard(a, b [][]rune) bool {
+	for row := range a {
+		for col := range a[row] {
+			if a[row][col] != b[row][col] {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// record appends a move played from the before snapshot to the history and
+// drops the moves that could have been redone. Callers hold p.mu.
+func (p *Power) record(move Move, before snapshot) {
+	p.history = append(p.history, turn{move: move, before: before, after: p.snapshot()})
+	p.undone = nil
+}
+
+// Undo takes back the last move, restoring the board, the player to move and
+// the game state, and returns the move that was undone
+func (p *Power) Undo() (Move, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if len(p.history) == 0 {
+		return Move{}, ErrNothingToUndo
+	}
+
+	last := p.history[len(p.history)-1]
+	p.history = p.history[:len(p.history)-1]
+	p.undone = append(p.undone, last)
+	p.restore(last.before)
+	return last.move, nil
+}
+
+// Redo replays the most recently undone move and returns it
+func (p *Power) Redo() (Move, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if len(p.undone) == 0 {
+		return Move{}, ErrNothingToRedo
+	}
+
+	next := p.undone[len(p.undone)-1]
+	p.undone = p.undone[:len(p.undone)-1]
+	p.history = append(p.history, next)
+	p.restore(next.after)
+	return next.move, nil
+}
+
+// CanUndo reports whether there is a move to take back
+func (p *Power) CanUndo() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return len(p.history) > 0
+}
+
+// CanRedo reports whether there is an undone move to replay
+func (p *Power) CanRedo() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return len(p.undone) > 0
+}
+
+// History returns the moves played so far, oldest first
+func (p *Power) History() []Move {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	moves := make([]Move, len(p.history))
+	for i, t := range p.history {
+		moves[i] = t.move
+	}
+	return moves
+}
@@ -0,0 +1,127 @@
+package shared
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"sort"
+)
+
+// Blocker marks a neutral cell that belongs to no player. Pieces stack on
+// top of it and no line goes through it.
+const Blocker = '#'
+
+// Obstacles describes the blockers placed before the first move: a preset
+// layout by name, or Count cells picked at random from Seed. The same
+// settings always give the same layout, so a rematch is played on the same
+// board.
+type Obstacles struct {
+	Preset string // Name of a layout in ObstaclePresets, empty for none
+	Count  int    // Blockers placed at random when there is no preset
+	Seed   uint64 // Seed of the random placement
+}
+
+// obstaclePresets are the hand-picked layouts, scaled to the board size
+var obstaclePresets = map[string]func(rows, cols int) []Coordinate{
+	// A single blocker in the middle of the board
+	"center": func(rows, cols int) []Coordinate {
+		return []Coordinate{{Column: cols / 2, Row: rows / 2}}
+	},
+	// The four corners of the board
+	"corners": func(rows, cols int) []Coordinate {
+		return []Coordinate{
+			{Column: 0, Row: 0},
+			{Column: cols - 1, Row: 0},
+			{Column: 0, Row: rows - 1},
+			{Column: cols - 1, Row: rows - 1},
+		}
+	},
+	// Two columns of blockers a third of the board high, standing on the
+	// bottom row a quarter of the way in from each side
+	"pillars": func(rows, cols int) []Coordinate {
+		var cells []Coordinate
+		for _, col := range []int{cols / 4, cols - 1 - cols/4} {
+			for row := rows - 1; row >= rows-max(rows/3, 1); row-- {
+				cells = append(cells, Coordinate{Column: col, Row: row})
+			}
+		}
+		return cells
+	},
+}
+
+// ObstaclePresets returns the names of the preset layouts, sorted
+func ObstaclePresets() []string {
+	names := make([]string, 0, len(obstaclePresets))
+	for name := range obstaclePresets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Errors returned by GameSettings.Validate for a layout that cannot be placed
+var (
+	ErrUnknownObstacles = fmt.Errorf("%w: unknown obstacle layout", ErrInvalidSettings)
+	ErrTooManyObstacles = fmt.Errorf("%w: blockers must leave at least half the board free", ErrInvalidSettings)
+)
+
+// validate checks that the layout exists and leaves room to play on a board
+// of the given size
+func (o Obstacles) validate(rows, cols int) error {
+	if o.Preset != "" {
+		if _, ok := obstaclePresets[o.Preset]; !ok {
+			return fmt.Errorf("%w: %q", ErrUnknownObstacles, o.Preset)
+		}
+		return nil
+	}
+	if o.Count < 0 || o.Count > rows*cols/2 {
+		return fmt.Errorf("%w: %d blockers on a %dx%d board", ErrTooManyObstacles, o.Count, rows, cols)
+	}
+	return nil
+}
+
+// cells returns the blocked cells of a board of the given size. Random
+// blockers stay out of the cell each lane is entered from under gravity, so
+// no layout seals every lane before the first move.
+func (o Obstacles) cells(rows, cols int, gravity Gravity) map[Coordinate]bool {
+	blocked := make(map[Coordinate]bool)
+	if preset, ok := obstaclePresets[o.Preset]; ok {
+		for _, cell := range preset(rows, cols) {
+			blocked[cell] = true
+		}
+		return blocked
+	}
+
+	var free []Coordinate
+	for row := 0; row < rows; row++ {
+		for col := 0; col < cols; col++ {
+			if !isEntry(row, col, rows, cols, gravity) {
+				free = append(free, Coordinate{Column: col, Row: row})
+			}
+		}
+	}
+
+	// Drawing from a shuffled list of cells keeps the blockers distinct
+	rng := rand.New(rand.NewPCG(o.Seed, o.Seed))
+	order := rng.Perm(len(free))
+	for _, i := range order[:min(o.Count, len(order))] {
+		blocked[free[i]] = true
+	}
+	return blocked
+}
+
+// isEntry reports whether a piece enters its lane through the cell at row,
+// col: the end of the lane away from the gravity edge. Without gravity every
+// cell is a lane of its own and none is kept free.
+func isEntry(row, col, rows, cols int, gravity Gravity) bool {
+	switch gravity {
+	case DOWN:
+		return row == 0
+	case UP:
+		return row == rows-1
+	case LEFT:
+		return col == cols-1
+	case RIGHT:
+		return col == 0
+	}
+	return false
+}
@@ -0,0 +1,84 @@
+package shared
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestObstacles(t *testing.T) {
+	// Pieces stack on top of the pillars
+	p := NewGameInstance(GameSettings{Rows: 6, Columns: 7, Obstacles: Obstacles{Preset: "pillars"}})
+	if board := p.GetBoard(); board[5][1] != Blocker || board[4][5] != Blocker || board[3][1] != 0 {
+		t.Fatal("expected two blockers at the bottom of columns 1 and 5")
+	}
+	if placed, _ := p.MakeMove(Coordinate{Column: 1}); placed.Row != 3 {
+		t.Fatalf("expected the piece to rest on the pillar, got row %d", placed.Row)
+	}
+
+	// The cells below a blocker cannot be reached
+	p = NewGameInstance(GameSettings{Rows: 6, Columns: 7, Obstacles: Obstacles{Preset: "center"}})
+	for want := 2; want >= 0; want-- {
+		if placed, err := p.MakeMove(Coordinate{Column: 3}); err != nil || placed.Row != want {
+			t.Fatalf("expected row %d, got %d (%v)", want, placed.Row, err)
+		}
+	}
+	if _, err := p.MakeMove(Coordinate{Column: 3}); !errors.Is(err, ErrColumnFull) {
+		t.Fatalf("expected ErrColumnFull above the blocker, got %v", err)
+	}
+
+	// A board whose empty cells all lie behind a blocker is a draw
+	p = NewGameInstance(GameSettings{Rows: 3, Columns: 4, Obstacles: Obstacles{Preset: "center"}})
+	for _, col := range []int{0, 0, 0, 1, 1, 1, 3, 3, 3, 2} {
+		if _, err := p.MakeMove(Coordinate{Column: col}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if p.GetGameState() != DRAW {
+		t.Fatalf("expected a draw, got %v", p.GetGameState())
+	}
+	p.ResetGame()
+	if p.GetBoard()[1][2] != Blocker {
+		t.Fatal("reset should keep the blockers")
+	}
+
+	// The same seed gives the same layout
+	random := GameSettings{Rows: 6, Columns: 7, Obstacles: Obstacles{Count: 5, Seed: 42}}
+	a, b := NewGameInstance(random).GetBoard(), NewGameInstance(random).GetBoard()
+	blockers := 0
+	for row := range a {
+		for col := range a[row] {
+			if a[row][col] != b[row][col] {
+				t.Fatal("the same seed gave two layouts")
+			}
+			if a[row][col] == Blocker {
+				blockers++
+			}
+		}
+	}
+	if blockers != 5 {
+		t.Fatalf("expected 5 blockers, got %d", blockers)
+	}
+
+	// Random blockers never seal every lane, whatever the gravity
+	for _, seed := range []uint64{34, 57, 117} {
+		for gravity := DOWN; gravity < NONE; gravity++ {
+			settings := GameSettings{Rows: 4, Columns: 4, WinLength: 3, Gravity: gravity, Obstacles: Obstacles{Count: 8, Seed: seed}}
+			if err := settings.Validate(); err != nil {
+				t.Fatal(err)
+			}
+			if p := NewGameInstance(settings); len(p.LegalMoves()) == 0 {
+				t.Errorf("seed %d, gravity %d: no legal move before the first one", seed, gravity)
+			}
+		}
+	}
+
+	for bad, want := range map[Obstacles]error{
+		{Preset: "maze"}: ErrUnknownObstacles,
+		{Count: 22}:      ErrTooManyObstacles,
+		{Count: -1}:      ErrTooManyObstacles,
+	} {
+		if err := (GameSettings{Rows: 6, Columns: 7, Obstacles: bad}).Validate(); !errors.Is(err, want) {
+			t.Errorf("%+v: expected %v, got %v", bad, want, err)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package shared
+
+// WinningGrid marks the cells of the winning line(s) on a grid shaped like
+// the board, for the templates of the game pages
+func WinningGrid(cells []Coordinate, rows, cols int) [][]bool {
+	winning := make([][]bool, rows)
+	for i := range winning {
+		winning[i] = make([]bool, cols)
+	}
+	for _, cell := range cells {
+		winning[cell.Row][cell.Column] = true
+	}
+	return winning
+}
+
+// UndoScored takes back the last move of a game kept with scores: when the
+// move won the game, addScore takes back the point it earned. It reports
+// whether a move was taken back and whether a score changed.
+func UndoScored(p *Power, addScore func(player Player, delta int)) (undone, scored bool) {
+	winner := p.GetWinner()
+	if _, err := p.Undo(); err != nil {
+		return false, false
+	}
+	if winner != nil {
+		addScore(*winner, -1)
+	}
+	return true, winner != nil
+}
+
+// RedoScored replays the last undone move of a game kept with scores: when
+// the move wins the game, addScore gives back the point it earned. It
+// reports whether a move was replayed and whether a score changed.
+func RedoScored(p *Power, addScore func(player Player, delta int)) (redone, scored bool) {
+	if _, err := p.Redo(); err != nil {
+		return false, false
+	}
+	winner := p.GetWinner()
+	if winner != nil {
+		addScore(*winner, 1)
+	}
+	return true, winner != nil
+}
@@ -0,0 +1,126 @@
+package shared
+
+import "fmt"
+
+// Pop10 is played in two stages. Players first take turns filling the
+// board, lines not counting yet. Then each turn a player pops one of their
+// discs from the bottom row: a disc that was part of a line of WinLength is
+// captured, any other disc must go straight back on top of a column by the
+// same player. The first player to capture Goal discs wins. A player who
+// cannot pop passes, and the third time the same position comes up the game
+// is a draw.
+type Pop10 struct {
+	Classic
+	Goal int
+}
+
+func (Pop10) Name() string {
+	return "pop10"
+}
+
+func (v Pop10) Description() string {
+	return fmt.Sprintf("Fill the board, then pop your discs out of lines: first to %d wins.", v.Goal)
+}
+
+// MaxPlayers is two: a player who cannot pop passes to their only opponent
+func (Pop10) MaxPlayers() int {
+	return 2
+}
+
+func (Pop10) Start(pos *Position) {
+	pos.SetPhase(SETTING_UP)
+}
+
+func (v Pop10) LegalMoves(pos *Position) []Action {
+	return v.moves(pos, pos.CurrentPlayer())
+}
+
+// moves lists the moves player could make in the current phase
+func (Pop10) moves(pos *Position, player Player) []Action {
+	if pos.Phase() != POPPING {
+		return Classic{}.LegalMoves(pos)
+	}
+
+	var moves []Action
+	for _, lane := range Lanes(pos) {
+		if canPop(pos, lane, player) {
+			moves = append(moves, Action{Kind: POP, Coordinate: lane})
+		}
+	}
+	return moves
+}
+
+func (v Pop10) CheckMove(pos *Position, action Action) error {
+	if pos.Phase() != POPPING {
+		if action.Kind != DROP {
+			return ErrMoveNotAllowed
+		}
+		return v.Classic.CheckMove(pos, action)
+	}
+
+	if action.Kind != POP {
+		return ErrMoveNotAllowed
+	}
+	if _, err := pos.Lane(action.Coordinate); err != nil {
+		return err
+	}
+	if !canPop(pos, action.Coordinate, pos.CurrentPlayer()) {
+		return ErrIllegalPop
+	}
+	return nil
+}
+
+// Apply drops a disc, or pops one and either captures it or asks for it to
+// be returned
+func (v Pop10) Apply(pos *Position, action Action) Coordinate {
+	if action.Kind != POP {
+		return v.Classic.Apply(pos, action)
+	}
+
+	cells, _ := pos.Lane(action.Coordinate)
+	inLine := pos.LineCells(cells[0]) != nil
+	cell := popPiece(pos, action.Coordinate)
+	if inLine {
+		pos.Capture(pos.CurrentPlayer())
+	} else {
+		pos.SetPhase(RETURNING)
+	}
+	return cell
+}
+
+// Outcome moves the game through its phases and checks the capture goal
+func (v Pop10) Outcome(pos *Position, move Move) GameState {
+	mover := pos.CurrentPlayer()
+
+	switch pos.Phase() {
+	case SETTING_UP:
+		if pos.IsFull() {
+			pos.SetPhase(POPPING)
+		}
+	case RETURNING:
+		if move.Kind == POP {
+			// The popped disc was in no line: the same player puts it back
+			pos.KeepTurn()
+			return ONGOING
+		}
+		pos.SetPhase(POPPING)
+	case POPPING:
+		if pos.Captured(mover) >= v.Goal {
+			return pos.Win(mover)
+		}
+	}
+
+	if pos.Repetitions() >= 2 {
+		return DRAW
+	}
+	switch {
+	case len(v.moves(pos, pos.NextPlayer(mover))) > 0:
+		return ONGOING
+	case len(v.moves(pos, mover)) > 0:
+		// The opponent has no disc to pop and passes
+		pos.KeepTurn()
+		return ONGOING
+	default:
+		return DRAW
+	}
+}
@@ -0,0 +1,77 @@
+package shared
+
+import (
+	"errors"
+	"testing"
+)
+
+// shortPop10 plays Pop 10 to two captures so a small board is enough
+type shortPop10 struct {
+	Pop10
+}
+
+func (shortPop10) Name() string {
+	return "test-pop2"
+}
+
+func TestPop10(t *testing.T) {
+	if _, ok := LookupVariant("test-pop2"); !ok {
+		RegisterVariant(shortPop10{Pop10{Goal: 2}})
+	}
+	p := NewGameInstance(GameSettings{Rows: 4, Columns: 4, Variant: "test-pop2"})
+	if p.GetPhase() != SETTING_UP {
+		t.Fatalf("expected the game to start in the setup phase, got %v", p.GetPhase())
+	}
+
+	play := func(kind MoveKind, col int) {
+		t.Helper()
+		if _, err := p.Play(Action{Kind: kind, Coordinate: Coordinate{Column: col}}); err != nil {
+			t.Fatalf("%v in column %d: %v", kind, col, err)
+		}
+	}
+
+	// Fill the board column by column: blue lines up the bottom row and red
+	// the row above, which does not win during the setup
+	for col := 0; col < 4; col++ {
+		for i := 0; i < 4; i++ {
+			play(DROP, col)
+		}
+	}
+	if p.GetGameState() != ONGOING || p.GetPhase() != POPPING {
+		t.Fatalf("expected the popping phase to start, got %v in phase %v", p.GetGameState(), p.GetPhase())
+	}
+	if _, err := p.MakeMove(Coordinate{Column: 0}); !errors.Is(err, ErrMoveNotAllowed) {
+		t.Fatalf("dropping while popping: expected ErrMoveNotAllowed, got %v", err)
+	}
+
+	// Blue pops a disc of its bottom line and keeps it
+	play(POP, 0)
+	if p.Captured(BLUE) != 1 || p.GetCurrentPlayer() != RED {
+		t.Fatalf("expected blue to capture and red to play, got %d captured and %v to play", p.Captured(BLUE), p.GetCurrentPlayer())
+	}
+
+	// Red pops a disc in no line and has to put it back
+	play(POP, 0)
+	if p.GetPhase() != RETURNING || p.GetCurrentPlayer() != RED || p.Captured(RED) != 0 {
+		t.Fatalf("expected red to return its disc, got phase %v and %v to play", p.GetPhase(), p.GetCurrentPlayer())
+	}
+	play(DROP, 0)
+	if p.GetPhase() != POPPING || p.GetCurrentPlayer() != BLUE {
+		t.Fatalf("expected blue to pop next, got phase %v and %v to play", p.GetPhase(), p.GetCurrentPlayer())
+	}
+
+	// Blue's second capture reaches the goal
+	play(POP, 1)
+	if !hasWon(p, BLUE) {
+		t.Fatalf("expected blue to win with 2 captures, got %v", p.GetGameState())
+	}
+
+	p.Undo()
+	if p.Captured(BLUE) != 1 || p.GetPhase() != POPPING || p.GetGameState() != ONGOING {
+		t.Fatalf("undo should restore the captures and phase, got %d captured in phase %v", p.Captured(BLUE), p.GetPhase())
+	}
+	p.ResetGame()
+	if p.Captured(BLUE) != 0 || p.GetPhase() != SETTING_UP {
+		t.Fatalf("reset should start a new setup, got %d captured in phase %v", p.Captured(BLUE), p.GetPhase())
+	}
+}
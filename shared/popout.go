@@ -0,0 +1,127 @@
+package shared
+
+import "errors"
+
+// ErrIllegalPop is returned when a player tries to pop a piece that is not
+// their own or a column with nothing to pop
+var ErrIllegalPop = errors.New("only your own piece at the bottom can be popped")
+
+// PopOut lets a player either drop a piece or pop one of their own pieces
+// out of the bottom of a column, the pieces above it falling one cell. A pop
+// that completes lines for both players wins for the player who popped, and
+// the third time the same position comes up the game is a draw.
+type PopOut struct {
+	Classic
+}
+
+func (PopOut) Name() string {
+	return "popout"
+}
+
+func (PopOut) Description() string {
+	return "Drop a piece, or pop one of yours out of the bottom."
+}
+
+// MaxPlayers is two: a pop that lines up pieces for both players is settled
+// between the two of them
+func (PopOut) MaxPlayers() int {
+	return 2
+}
+
+// LegalMoves lists the drops and the pops of the player to move
+func (PopOut) LegalMoves(pos *Position) []Action {
+	return popOutMoves(pos, pos.CurrentPlayer())
+}
+
+// popOutMoves lists the moves player could make on the current board
+func popOutMoves(pos *Position, player Player) []Action {
+	moves := Classic{}.LegalMoves(pos)
+	for _, lane := range Lanes(pos) {
+		if canPop(pos, lane, player) {
+			moves = append(moves, Action{Kind: POP, Coordinate: lane})
+		}
+	}
+	return moves
+}
+
+func (v PopOut) CheckMove(pos *Position, action Action) error {
+	switch action.Kind {
+	case DROP:
+		return v.Classic.CheckMove(pos, action)
+	case POP:
+		if _, err := pos.Lane(action.Coordinate); err != nil {
+			return err
+		}
+		if !canPop(pos, action.Coordinate, pos.CurrentPlayer()) {
+			return ErrIllegalPop
+		}
+		return nil
+	default:
+		return ErrMoveNotAllowed
+	}
+}
+
+// Apply drops a piece, or removes the bottom piece of a column and lets the
+// pieces stacked on it fall by one cell. A pop returns the emptied bottom cell.
+func (v PopOut) Apply(pos *Position, action Action) Coordinate {
+	if action.Kind != POP {
+		return v.Classic.Apply(pos, action)
+	}
+
+	return popPiece(pos, action.Coordinate)
+}
+
+// popPiece removes the piece at the gravity edge of a lane, lets the pieces
+// stacked on it fall by one cell and returns the emptied edge cell. A
+// Blocker stays where it is, along with the pieces resting on it.
+func popPiece(pos *Position, lane Coordinate) Coordinate {
+	cells, _ := pos.Lane(lane)
+	i := 0
+	for ; i+1 < len(cells) && pos.Cell(cells[i+1].Row, cells[i+1].Column) != 0 && pos.Cell(cells[i+1].Row, cells[i+1].Column) != Blocker; i++ {
+		pos.SetCell(cells[i].Row, cells[i].Column, pos.Cell(cells[i+1].Row, cells[i+1].Column))
+	}
+	pos.SetCell(cells[i].Row, cells[i].Column, 0)
+	return cells[0]
+}
+
+// canPop reports whether the piece at the gravity edge of a lane is player's
+func canPop(pos *Position, lane Coordinate, player Player) bool {
+	cells, err := pos.Lane(lane)
+	return err == nil && pos.Cell(cells[0].Row, cells[0].Column) == player.Piece()
+}
+
+// Outcome checks the lines of both players after a pop, calls a draw on the
+// third repetition of a position or when the next player cannot move
+func (v PopOut) Outcome(pos *Position, move Move) GameState {
+	mover := pos.CurrentPlayer()
+
+	if move.Kind == POP {
+		// Every piece of the column moved, so lines of either player can
+		// appear anywhere along it
+		lines := make(map[rune][]Coordinate)
+		cells, _ := pos.Lane(move.Coordinate)
+		for _, cell := range cells {
+			if piece := pos.Cell(cell.Row, cell.Column); piece != 0 {
+				lines[piece] = append(lines[piece], pos.LineCells(cell)...)
+			}
+		}
+
+		// Completing lines for both players wins for the one who popped
+		for _, player := range [2]Player{mover, pos.NextPlayer(mover)} {
+			if won := lines[player.Piece()]; len(won) > 0 {
+				pos.SetWinningCells(won)
+				return pos.Win(player)
+			}
+		}
+	} else if pos.CompletesLine(move.Coordinate) {
+		return pos.Win(mover)
+	}
+
+	if pos.Repetitions() >= 2 {
+		return DRAW
+	}
+	if len(popOutMoves(pos, pos.NextPlayer(mover))) == 0 {
+		return DRAW
+	}
+	return ONGOING
+}
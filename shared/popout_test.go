@@ -0,0 +1,96 @@
+package shared
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestPopOutPop(t *testing.T) {
+	p := NewGameInstance(GameSettings{Rows: 6, Columns: 7, Variant: "popout"})
+	p.MakeMove(Coordinate{Column: 3}) // Blue
+	p.MakeMove(Coordinate{Column: 3}) // Red, on top of Blue
+	p.MakeMove(Coordinate{Column: 0}) // Blue
+
+	if _, err := p.Play(Action{Kind: POP, Coordinate: Coordinate{Column: 3}}); !errors.Is(err, ErrIllegalPop) {
+		t.Fatalf("red popping a blue piece: expected ErrIllegalPop, got %v", err)
+	}
+	if _, err := p.Play(Action{Kind: POP, Coordinate: Coordinate{Column: 5}}); !errors.Is(err, ErrIllegalPop) {
+		t.Fatalf("popping an empty column: expected ErrIllegalPop, got %v", err)
+	}
+
+	p.MakeMove(Coordinate{Column: 6}) // Red
+	cell, err := p.Play(Action{Kind: POP, Coordinate: Coordinate{Column: 3}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cell != (Coordinate{Column: 3, Row: 5}) {
+		t.Errorf("expected the bottom cell to be popped, got %+v", cell)
+	}
+	board := p.GetBoard()
+	if board[5][3] != 'R' || board[4][3] != 0 {
+		t.Errorf("expected the red piece to fall to the bottom, got %q above %q", board[4][3], board[5][3])
+	}
+	if moves := p.History(); moves[len(moves)-1].Kind != POP {
+		t.Errorf("expected the history to record a pop, got %+v", moves[len(moves)-1])
+	}
+
+	p.Undo()
+	if board := p.GetBoard(); board[5][3] != 'B' || board[4][3] != 'R' {
+		t.Errorf("undo should put the popped piece back")
+	}
+
+	classic := NewGameInstance(GameSettings{Rows: 6, Columns: 7})
+	classic.MakeMove(Coordinate{Column: 0})
+	classic.MakeMove(Coordinate{Column: 1})
+	if _, err := classic.Play(Action{Kind: POP, Coordinate: Coordinate{Column: 0}}); !errors.Is(err, ErrMoveNotAllowed) {
+		t.Errorf("classic rules: expected ErrMoveNotAllowed, got %v", err)
+	}
+}
+
+func TestPopOutSimultaneousWin(t *testing.T) {
+	p := NewGameInstance(GameSettings{Rows: 6, Columns: 7, Variant: "popout"})
+
+	// Popping column 0 lines up red on the bottom row and blue on the row
+	// above at the same time
+	p.Board[5] = []rune{'B', 'R', 'R', 'R', 0, 0, 0}
+	p.Board[4] = []rune{'R', 'B', 'B', 'B', 0, 0, 0}
+	p.Board[3] = []rune{'B', 0, 0, 0, 0, 0, 0}
+	p.IsPlaying = BLUE
+
+	if _, err := p.Play(Action{Kind: POP, Coordinate: Coordinate{Column: 0}}); err != nil {
+		t.Fatal(err)
+	}
+	if !hasWon(p, BLUE) {
+		t.Fatalf("the player who popped should win, got %v", p.GetGameState())
+	}
+	for _, cell := range p.WinningCells() {
+		if cell.Row != 4 {
+			t.Errorf("only blue's line should be highlighted, got %+v", cell)
+		}
+	}
+}
+
+func TestPopOutRepetitionDraw(t *testing.T) {
+	p := NewGameInstance(GameSettings{Rows: 6, Columns: 7, Variant: "popout"})
+
+	// Each cycle comes back to the empty board with blue to move
+	cycle := []Action{
+		{Kind: DROP, Coordinate: Coordinate{Column: 0}},
+		{Kind: DROP, Coordinate: Coordinate{Column: 1}},
+		{Kind: POP, Coordinate: Coordinate{Column: 0}},
+		{Kind: POP, Coordinate: Coordinate{Column: 1}},
+	}
+	for round := 0; round < 2; round++ {
+		for _, action := range cycle {
+			if p.IsGameOver() {
+				t.Fatalf("game ended early, in round %d", round)
+			}
+			if _, err := p.Play(action); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if p.GetGameState() != DRAW {
+		t.Fatalf("expected a draw on the third repetition, got %v", p.GetGameState())
+	}
+}
@@ -0,0 +1,303 @@
+package shared
+
+import (
+	"crypto/rand"
+	"errors"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+)
+
+// DefaultRoomIdleTTL is how long a room nobody visits is kept
+const DefaultRoomIdleTTL = 30 * time.Minute
+
+// DefaultMaxRooms caps the rooms a manager keeps: the least recently
+// visited one makes room for a new one
+const DefaultMaxRooms = 1000
+
+// roomIDLength is the number of characters of a room ID
+const roomIDLength = 6
+
+// roomIDAlphabet leaves out characters easily mistaken for one another
+const roomIDAlphabet = "23456789abcdefghjkmnpqrstuvwxyz"
+
+// Errors returned for moves a room refuses
+var (
+	ErrNotYourTurn  = errors.New("it is not your turn")
+	ErrRoomNotReady = errors.New("the room is waiting for players")
+	ErrNotSeated    = errors.New("only the players of the room can do this")
+)
+
+// Room is a game hosted under a short ID, played from the browsers that
+// took its seats and watched by any other browser opening its link
+type Room interface {
+	Info() RoomInfo
+}
+
+// RoomInfo describes a room for the lobby
+type RoomInfo struct {
+	Mode       string // Game mode, as shown in the lobby
+	URL        string // Page of the room
+	Seats      int    // Players the game needs
+	Taken      int    // Seats held by a browser
+	Spectators int    // Open connections of browsers watching without a seat
+}
+
+// Open reports whether the room is waiting for players
+func (info RoomInfo) Open() bool {
+	return info.Taken < info.Seats
+}
+
+// RoomListing is a room as listed in the lobby
+type RoomListing struct {
+	RoomInfo
+	ID      string
+	Created time.Time
+}
+
+// RoomManager keeps the rooms of every mode in memory. Rooms that have not
+// been visited for longer than the idle TTL are dropped, and the manager
+// never holds more than max rooms.
+type RoomManager struct {
+	mu        sync.Mutex
+	rooms     map[string]*roomEntry
+	ttl       time.Duration
+	max       int
+	lastSweep time.Time
+}
+
+type roomEntry struct {
+	room     Room
+	created  time.Time
+	lastSeen time.Time
+}
+
+// Rooms holds the rooms of every mode, keyed by room ID
+var Rooms = NewRoomManager(DefaultRoomIdleTTL)
+
+// NewRoomManager creates a manager dropping rooms idle for ttl
+func NewRoomManager(ttl time.Duration) *RoomManager {
+	return &RoomManager{
+		rooms: make(map[string]*roomEntry),
+		ttl:   ttl,
+		max:   DefaultMaxRooms,
+	}
+}
+
+// SetIdleTTL changes how long an idle room is kept
+func (m *RoomManager) SetIdleTTL(ttl time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.ttl = ttl
+}
+
+// SetMaxRooms changes how many rooms are kept at most
+func (m *RoomManager) SetMaxRooms(max int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.max = max
+}
+
+// newRoomID generates a random room ID short enough to read out
+func newRoomID() string {
+	buf := make([]byte, roomIDLength)
+	if _, err := rand.Read(buf); err != nil {
+		panic("rooms: cannot read random bytes: " + err.Error())
+	}
+	for i, b := range buf {
+		buf[i] = roomIDAlphabet[int(b)%len(roomIDAlphabet)]
+	}
+	return string(buf)
+}
+
+// Create hosts the room built by newRoom under a fresh ID, dropping the
+// least recently visited room when the manager is full
+func (m *RoomManager) Create(newRoom func(id string) Room) Room {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	m.sweep(now)
+	for len(m.rooms) >= m.max && len(m.rooms) > 0 {
+		m.evictOldest()
+	}
+
+	id := newRoomID()
+	for m.rooms[id] != nil {
+		id = newRoomID()
+	}
+	room := newRoom(id)
+	m.rooms[id] = &roomEntry{room: room, created: now, lastSeen: now}
+	return room
+}
+
+// Lookup returns the room behind an ID and marks it as visited
+func (m *RoomManager) Lookup(id string) (Room, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	m.sweep(now)
+
+	entry, ok := m.rooms[id]
+	if !ok || now.Sub(entry.lastSeen) > m.ttl {
+		delete(m.rooms, id)
+		return nil, false
+	}
+	entry.lastSeen = now
+	return entry.room, true
+}
+
+// Remove drops a room before it expires
+func (m *RoomManager) Remove(id string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.rooms, id)
+}
+
+// LookupRoom returns the room behind an ID if it is of type T
+func LookupRoom[T Room](m *RoomManager, id string) (T, bool) {
+	room, ok := m.Lookup(id)
+	if !ok {
+		var zero T
+		return zero, false
+	}
+	typed, ok := room.(T)
+	return typed, ok
+}
+
+// List describes every room, oldest first
+func (m *RoomManager) List() []RoomListing {
+	m.mu.Lock()
+	now := time.Now()
+	m.sweep(now)
+	var listings []RoomListing
+	var rooms []Room
+	for id, entry := range m.rooms {
+		if now.Sub(entry.lastSeen) <= m.ttl {
+			listings = append(listings, RoomListing{ID: id, Created: entry.created})
+			rooms = append(rooms, entry.room)
+		}
+	}
+	m.mu.Unlock()
+
+	// Rooms lock themselves to describe their seats, so ask them once m.mu
+	// is released
+	for i := range listings {
+		listings[i].RoomInfo = rooms[i].Info()
+	}
+	slices.SortFunc(listings, func(a, b RoomListing) int {
+		return a.Created.Compare(b.Created)
+	})
+	return listings
+}
+
+// OpenRooms lists the rooms waiting for players, oldest first
+func (m *RoomManager) OpenRooms() []RoomListing {
+	var open []RoomListing
+	for _, listing := range m.List() {
+		if listing.Open() {
+			open = append(open, listing)
+		}
+	}
+	return open
+}
+
+// sweep drops idle rooms, at most once per TTL or sweep interval,
+// whichever is shorter. Callers hold m.mu.
+func (m *RoomManager) sweep(now time.Time) {
+	if now.Sub(m.lastSweep) < min(m.ttl, sweepInterval) {
+		return
+	}
+	m.lastSweep = now
+
+	for id, entry := range m.rooms {
+		if now.Sub(entry.lastSeen) > m.ttl {
+			delete(m.rooms, id)
+		}
+	}
+}
+
+// evictOldest drops the least recently visited room. Callers hold m.mu.
+func (m *RoomManager) evictOldest() {
+	var oldest string
+	var oldestSeen time.Time
+	for id, entry := range m.rooms {
+		if oldest == "" || entry.lastSeen.Before(oldestSeen) {
+			oldest, oldestSeen = id, entry.lastSeen
+		}
+	}
+	delete(m.rooms, oldest)
+}
+
+// TakeSeat returns the seat a session holds, giving it the first free one
+// if it has none. seats holds the session of each seat, empty while free.
+func TakeSeat(seats []string, session string) (int, bool) {
+	if session == "" {
+		return 0, false
+	}
+	if i := slices.Index(seats, session); i >= 0 {
+		return i, true
+	}
+	for i, seat := range seats {
+		if seat == "" {
+			seats[i] = session
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// SeatsTaken counts the seats held by a session
+func SeatsTaken(seats []string) int {
+	taken := 0
+	for _, seat := range seats {
+		if seat != "" {
+			taken++
+		}
+	}
+	return taken
+}
+
+// Audience is the set of sessions that opened a room without a seat, and
+// may watch it
+type Audience map[string]bool
+
+// Join adds a session to the audience, reporting whether it is new to it
+func (a Audience) Join(session string) bool {
+	if session == "" || a[session] {
+		return false
+	}
+	a[session] = true
+	return true
+}
+
+// Watches reports whether the request's session is in the audience
+func (a Audience) Watches(r *http.Request) bool {
+	cookie, err := r.Cookie(SessionCookieName)
+	return err == nil && a[cookie.Value]
+}
+
+// SeatOf returns the seat the request's session holds, without issuing a
+// session to newcomers
+func SeatOf(seats []string, r *http.Request) (int, bool) {
+	cookie, err := r.Cookie(SessionCookieName)
+	if err != nil || cookie.Value == "" {
+		return 0, false
+	}
+	i := slices.Index(seats, cookie.Value)
+	return i, i >= 0
+}
+
+// AbsoluteURL turns a path of this server into a link to share
+func AbsoluteURL(r *http.Request, path string) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host + path
+}
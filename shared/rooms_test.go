@@ -0,0 +1,119 @@
+package shared
+
+import (
+	"testing"
+	"time"
+)
+
+// testRoom is a room whose seats the test sets directly
+type testRoom struct {
+	seats []string
+}
+
+func (room *testRoom) Info() RoomInfo {
+	return RoomInfo{Mode: "Test", URL: "/test", Seats: len(room.seats), Taken: SeatsTaken(room.seats)}
+}
+
+func TestRoomManager(t *testing.T) {
+	m := NewRoomManager(time.Hour)
+
+	var id string
+	created := m.Create(func(roomID string) Room {
+		id = roomID
+		return &testRoom{seats: []string{"alice", ""}}
+	})
+	if len(id) != roomIDLength {
+		t.Fatalf("got room ID %q", id)
+	}
+	if room, ok := LookupRoom[*testRoom](m, id); !ok || room != created {
+		t.Fatalf("lookup of %q returned %v, %v", id, room, ok)
+	}
+	if _, ok := m.Lookup("nope"); ok {
+		t.Fatal("lookup of an unknown ID found a room")
+	}
+
+	full := m.Create(func(string) Room { return &testRoom{seats: []string{"alice", "bob"}} })
+	open := m.OpenRooms()
+	if len(open) != 1 || open[0].ID != id || open[0].Taken != 1 || open[0].Seats != 2 {
+		t.Fatalf("got open rooms %+v", open)
+	}
+
+	if all := m.List(); len(all) != 2 {
+		t.Fatalf("got rooms %+v", all)
+	}
+
+	// Filling the last seat takes the room off the list
+	full.(*testRoom).seats[1] = ""
+	created.(*testRoom).seats[1] = "bob"
+	if open := m.OpenRooms(); len(open) != 1 || open[0].ID == id {
+		t.Fatalf("got open rooms %+v", open)
+	}
+}
+
+func TestRoomManagerExpiry(t *testing.T) {
+	m := NewRoomManager(20 * time.Millisecond)
+
+	var id string
+	m.Create(func(roomID string) Room {
+		id = roomID
+		return &testRoom{seats: []string{"alice", ""}}
+	})
+	time.Sleep(40 * time.Millisecond)
+
+	if open := m.OpenRooms(); len(open) != 0 {
+		t.Fatalf("idle room still listed: %+v", open)
+	}
+	if _, ok := m.Lookup(id); ok {
+		t.Fatal("idle room still found")
+	}
+}
+
+func TestRoomManagerCap(t *testing.T) {
+	m := NewRoomManager(time.Hour)
+	m.SetMaxRooms(3)
+
+	var ids []string
+	for range 3 {
+		m.Create(func(roomID string) Room {
+			ids = append(ids, roomID)
+			return &testRoom{seats: []string{"alice", ""}}
+		})
+		time.Sleep(time.Millisecond)
+	}
+	m.Lookup(ids[0]) // Now the second room is the least recently visited
+	m.Create(func(string) Room { return &testRoom{seats: []string{"alice", ""}} })
+
+	if all := m.List(); len(all) != 3 {
+		t.Fatalf("manager holds %d rooms, want 3", len(all))
+	}
+	if _, ok := m.Lookup(ids[1]); ok {
+		t.Fatal("the least recently visited room was kept")
+	}
+	if _, ok := m.Lookup(ids[0]); !ok {
+		t.Fatal("a recently visited room was dropped")
+	}
+}
+
+func TestTakeSeat(t *testing.T) {
+	seats := []string{"alice", ""}
+
+	tests := []struct {
+		session string
+		want    int
+		ok      bool
+	}{
+		{"alice", 0, true},
+		{"bob", 1, true},
+		{"bob", 1, true},
+		{"carol", 0, false},
+		{"", 0, false},
+	}
+	for _, tt := range tests {
+		if got, ok := TakeSeat(seats, tt.session); got != tt.want || ok != tt.ok {
+			t.Errorf("TakeSeat(%q) = %d, %v, want %d, %v", tt.session, got, ok, tt.want, tt.ok)
+		}
+	}
+	if seats[1] != "bob" {
+		t.Fatalf("got seats %q", seats)
+	}
+}
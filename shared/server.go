@@ -24,6 +24,12 @@ func (w *statusWriter) WriteHeader(code int) {
 	w.ResponseWriter.WriteHeader(code)
 }
 
+// Unwrap lets http.ResponseController reach the connection, e.g. to hijack
+// it for a WebSocket
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
 // global request logger middleware
 func requestLogger(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -43,18 +49,13 @@ func requestLogger(next http.Handler) http.Handler {
 	})
 }
 
-// method guard for ServeMux (matches path only)
-func methodGuard(method string, next http.Handler) http.Handler {
-	if method == "" {
-		return next
+// pattern builds the ServeMux pattern of a route: the method, when set,
+// then the path, which may hold wildcards such as /online/{id}
+func (rt Route) pattern() string {
+	if rt.Method == "" {
+		return rt.Path
 	}
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != method {
-			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
-			return
-		}
-		next.ServeHTTP(w, r)
-	})
+	return rt.Method + " " + rt.Path
 }
 
 func RegisterRoute(mux *http.ServeMux, routes []Route) {
@@ -67,10 +68,8 @@ func RegisterRoute(mux *http.ServeMux, routes []Route) {
 			h = rt.Middleware(h)
 
 		}
-		// guard HTTP method
-		h = methodGuard(rt.Method, h)
-		// mount on path
-		mux.Handle(rt.Path, h)
+		// mount on method and path; ServeMux answers 405 to other methods
+		mux.Handle(rt.pattern(), h)
 
 	}
 }
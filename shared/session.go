@@ -0,0 +1,146 @@
+package shared
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// SessionCookieName is the cookie carrying the browser's session ID
+const SessionCookieName = "power4_session"
+
+// DefaultSessionTTL is how long an idle session is kept in memory
+const DefaultSessionTTL = 24 * time.Hour
+
+// DefaultMaxSessions caps the sessions a store keeps: the least recently
+// used one makes room for a new one
+const DefaultMaxSessions = 10000
+
+// sweepInterval is the longest time between two sweeps of expired
+// sessions, rooms or event streams
+const sweepInterval = time.Minute
+
+// sessionIDBytes is the amount of randomness in a session ID
+const sessionIDBytes = 16
+
+// SessionID returns the caller's session ID, issuing a new cookie when the
+// request does not carry a valid one
+func SessionID(w http.ResponseWriter, r *http.Request) string {
+	if cookie, err := r.Cookie(SessionCookieName); err == nil && isValidSessionID(cookie.Value) {
+		return cookie.Value
+	}
+
+	id := newSessionID()
+	http.SetCookie(w, &http.Cookie{
+		Name:     SessionCookieName,
+		Value:    id,
+		Path:     "/",
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	// Make the ID visible to later lookups while serving this request
+	r.AddCookie(&http.Cookie{Name: SessionCookieName, Value: id})
+	return id
+}
+
+// newSessionID generates a random hex-encoded session ID
+func newSessionID() string {
+	buf := make([]byte, sessionIDBytes)
+	if _, err := rand.Read(buf); err != nil {
+		panic("session: cannot read random bytes: " + err.Error())
+	}
+	return hex.EncodeToString(buf)
+}
+
+// isValidSessionID rejects cookies that could not have been issued by us
+func isValidSessionID(id string) bool {
+	if len(id) != sessionIDBytes*2 {
+		return false
+	}
+	_, err := hex.DecodeString(id)
+	return err == nil
+}
+
+// SessionStore keeps one value per browser session in memory. Entries that
+// have not been used for longer than the TTL are dropped, and the store never
+// holds more than max entries, so clients that never send their cookie back
+// cannot grow it without bound.
+type SessionStore[T any] struct {
+	mu        sync.Mutex
+	entries   map[string]*sessionEntry[T]
+	ttl       time.Duration
+	max       int
+	newValue  func() T
+	lastSweep time.Time
+}
+
+type sessionEntry[T any] struct {
+	value    T
+	lastSeen time.Time
+}
+
+// NewSessionStore creates a store whose sessions expire after ttl of
+// inactivity; newValue builds the value of a fresh session
+func NewSessionStore[T any](ttl time.Duration, newValue func() T) *SessionStore[T] {
+	return &SessionStore[T]{
+		entries:  make(map[string]*sessionEntry[T]),
+		ttl:      ttl,
+		max:      DefaultMaxSessions,
+		newValue: newValue,
+	}
+}
+
+// Get returns the value bound to the caller's session, creating the session
+// (and its cookie) when it does not exist or has expired
+func (s *SessionStore[T]) Get(w http.ResponseWriter, r *http.Request) T {
+	return s.Lookup(SessionID(w, r))
+}
+
+// Lookup returns the value bound to a session ID, creating it if needed
+func (s *SessionStore[T]) Lookup(id string) T {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.sweep(now)
+
+	entry, ok := s.entries[id]
+	if !ok || now.Sub(entry.lastSeen) > s.ttl {
+		if !ok && len(s.entries) >= s.max {
+			s.evictOldest()
+		}
+		entry = &sessionEntry[T]{value: s.newValue()}
+		s.entries[id] = entry
+	}
+	entry.lastSeen = now
+	return entry.value
+}
+
+// sweep drops expired sessions, at most once per TTL or sweep interval,
+// whichever is shorter. Callers hold s.mu.
+func (s *SessionStore[T]) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < min(s.ttl, sweepInterval) {
+		return
+	}
+	s.lastSweep = now
+
+	for id, entry := range s.entries {
+		if now.Sub(entry.lastSeen) > s.ttl {
+			delete(s.entries, id)
+		}
+	}
+}
+
+// evictOldest drops the least recently used session. Callers hold s.mu.
+func (s *SessionStore[T]) evictOldest() {
+	var oldest string
+	var oldestSeen time.Time
+	for id, entry := range s.entries {
+		if oldest == "" || entry.lastSeen.Before(oldestSeen) {
+			oldest, oldestSeen = id, entry.lastSeen
+		}
+	}
+	delete(s.entries, oldest)
+}
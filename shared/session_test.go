@@ -0,0 +1,77 @@
+package shared
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// counter numbers the values of fresh sessions
+type counter struct{ n int }
+
+func (c *counter) next() *int {
+	c.n++
+	n := c.n
+	return &n
+}
+
+func TestSessionStoreGet(t *testing.T) {
+	var c counter
+	store := NewSessionStore(time.Hour, c.next)
+
+	rec := httptest.NewRecorder()
+	first := store.Get(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != SessionCookieName {
+		t.Fatalf("got cookies %v", cookies)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.AddCookie(cookies[0])
+	if again := store.Get(httptest.NewRecorder(), req); again != first {
+		t.Fatal("the session cookie did not bring back the same value")
+	}
+}
+
+func TestSessionStoreExpiry(t *testing.T) {
+	var c counter
+	store := NewSessionStore(20*time.Millisecond, c.next)
+
+	first := store.Lookup("a")
+	store.Lookup("b")
+	time.Sleep(40 * time.Millisecond)
+
+	// An expired session gets a fresh value, and the sweep drops the others
+	if again := store.Lookup("a"); again == first {
+		t.Fatal("an expired session kept its value")
+	}
+	store.mu.Lock()
+	_, kept := store.entries["b"]
+	store.mu.Unlock()
+	if kept {
+		t.Fatal("the sweep kept an expired session")
+	}
+}
+
+func TestSessionStoreCap(t *testing.T) {
+	var c counter
+	store := NewSessionStore(time.Hour, c.next)
+	store.max = 3
+
+	for _, id := range []string{"a", "b", "c"} {
+		store.Lookup(id)
+		time.Sleep(time.Millisecond)
+	}
+	store.Lookup("a") // Now b is the least recently used
+	store.Lookup("d")
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if len(store.entries) != 3 {
+		t.Fatalf("store holds %d sessions, want 3", len(store.entries))
+	}
+	if _, kept := store.entries["b"]; kept {
+		t.Fatal("the least recently used session was kept")
+	}
+}
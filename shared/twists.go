@@ -0,0 +1,227 @@
+package shared
+
+import (
+	"errors"
+	"fmt"
+	"math/rand/v2"
+)
+
+// Twist is an event that changes the game between two turns
+type Twist int
+
+const (
+	FLIP_GRAVITY   Twist = iota // Inverts the gravity, the pieces stay where they are
+	ROTATE_BOARD                // Turns the board upside down, then the pieces fall back
+	LOCK_COLUMN                 // Closes a random column to drops for one round
+	SWAP_COLORS                 // Hands every piece over to the next player
+	ROTATE_QUARTER              // Turns the board a quarter clockwise, swapping Rows and Columns, then the pieces fall
+)
+
+// ErrColumnLocked is returned for a drop into a column closed by LOCK_COLUMN
+var ErrColumnLocked = errors.New("column is locked")
+
+// ErrInvalidTwists is returned by GameSettings.Validate for a schedule with
+// an unknown twist or no way to trigger its twists
+var ErrInvalidTwists = fmt.Errorf("%w: invalid twist schedule", ErrInvalidSettings)
+
+// TwistSchedule decides when twists happen. After every turn that leaves
+// the game going, a twist is due every Interval turns or, without an
+// interval, with the given Probability; it is picked at random among
+// Twists. The draws only depend on Seed and the turn number, so the same
+// game always gets the same twists, undo and redo included.
+type TwistSchedule struct {
+	Twists      []Twist // Twists to pick from, none for a game without twists
+	Interval    int     // Turns between two twists, 0 to draw them at random
+	Probability float64 // Chance of a twist after each turn when there is no interval
+	Seed        uint64  // Seed of the random draws
+}
+
+// TwistEvent is a twist that happened after a turn
+type TwistEvent struct {
+	Twist  Twist
+	Turn   int // Turn after which it happened
+	Column int // Column closed by LOCK_COLUMN
+}
+
+// validate checks that the schedule only has known twists and a way to
+// trigger them
+func (s TwistSchedule) validate() error {
+	for _, twist := range s.Twists {
+		if twist < FLIP_GRAVITY || twist > ROTATE_QUARTER {
+			return fmt.Errorf("%w: unknown twist %d", ErrInvalidTwists, twist)
+		}
+	}
+	if s.Interval < 0 {
+		return fmt.Errorf("%w: negative interval %d", ErrInvalidTwists, s.Interval)
+	}
+	if s.Probability < 0 || s.Probability > 1 {
+		return fmt.Errorf("%w: probability %v, want 0 to 1", ErrInvalidTwists, s.Probability)
+	}
+	if len(s.Twists) > 0 && s.Interval == 0 && s.Probability == 0 {
+		return fmt.Errorf("%w: twists need an interval or a probability", ErrInvalidTwists)
+	}
+	return nil
+}
+
+// due returns the twist to apply after turn, if any, and the random source
+// to draw its details from
+func (s TwistSchedule) due(turn int) (Twist, *rand.Rand, bool) {
+	if len(s.Twists) == 0 {
+		return 0, nil, false
+	}
+
+	rng := rand.New(rand.NewPCG(s.Seed, uint64(turn)))
+	if s.Interval > 0 {
+		if turn%s.Interval != 0 {
+			return 0, nil, false
+		}
+	} else if rng.Float64() >= s.Probability {
+		return 0, nil, false
+	}
+	return s.Twists[rng.IntN(len(s.Twists))], rng, true
+}
+
+// twist lifts a column lock whose round is over, then applies the twist
+// the schedule has for the turn just played. mover is the player who made
+// that turn; if the twist lines up pieces for several players, mover wins,
+// then the next in turn order. Callers hold p.mu.
+func (p *Power) twist(mover Player) GameState {
+	p.lastTwist = nil
+	if p.lockedUntil > 0 && (p.turns >= p.lockedUntil || len(p.openColumns(p.lockedColumn)) == 0) {
+		p.lockedUntil = 0
+	}
+
+	twist, rng, ok := p.Settings.Twists.due(p.turns)
+	if !ok {
+		return ONGOING
+	}
+
+	pos := p.position()
+	event := TwistEvent{Twist: twist, Turn: p.turns}
+	state := ONGOING
+	switch twist {
+	case FLIP_GRAVITY:
+		p.Gravity = p.Gravity.opposite()
+		if settler, ok := p.variant.(FlipSettler); ok {
+			state = settler.SettleOnFlip(pos, mover)
+		}
+	case ROTATE_BOARD, ROTATE_QUARTER:
+		p.rotate(twist == ROTATE_QUARTER)
+		if p.Gravity != NONE {
+			settle(pos)
+			state = lineAnywhere(pos, mover)
+		}
+	case LOCK_COLUMN:
+		// A column only closes while another one is left to play in
+		open := p.openColumns(-1)
+		if p.Gravity != DOWN && p.Gravity != UP || len(open) < 2 {
+			return ONGOING
+		}
+		event.Column = open[rng.IntN(len(open))]
+		p.lockedColumn, p.lockedUntil = event.Column, p.turns+p.Settings.Players
+	case SWAP_COLORS:
+		for row := range p.Board {
+			for col, piece := range p.Board[row] {
+				for player := Player(0); int(player) < p.Settings.Players; player++ {
+					if piece == player.Piece() {
+						p.Board[row][col] = p.nextPlayer(player).Piece()
+					}
+				}
+			}
+		}
+	}
+	p.lastTwist = &event
+
+	if state == ONGOING && p.isBoardFull() {
+		state = DRAW
+	}
+	return state
+}
+
+// rotate turns the board upside down, or a quarter clockwise so that the
+// left edge becomes the top one and Rows and Columns swap. Callers hold p.mu.
+func (p *Power) rotate(quarter bool) {
+	rows, cols := p.Settings.Rows, p.Settings.Columns
+	if !quarter {
+		rotated := make([][]rune, rows)
+		for row := range rotated {
+			rotated[row] = make([]rune, cols)
+			for col := range rotated[row] {
+				rotated[row][col] = p.Board[rows-1-row][cols-1-col]
+			}
+		}
+		p.Board = rotated
+		if p.lockedUntil > 0 {
+			p.lockedColumn = cols - 1 - p.lockedColumn
+		}
+		return
+	}
+
+	rotated := make([][]rune, cols)
+	for row := range rotated {
+		rotated[row] = make([]rune, rows)
+		for col := range rotated[row] {
+			rotated[row][col] = p.Board[rows-1-col][row]
+		}
+	}
+	p.Board = rotated
+	p.Settings.Rows, p.Settings.Columns = cols, rows
+	p.turned = !p.turned
+
+	// The locked column is a row now
+	p.lockedUntil = 0
+}
+
+// openColumns returns the columns a piece can be dropped in, except skip.
+// Callers hold p.mu.
+func (p *Power) openColumns(skip int) []int {
+	var open []int
+	for col := 0; col < p.Settings.Columns; col++ {
+		if _, _, err := p.landing(Coordinate{Column: col}); err == nil && col != skip {
+			open = append(open, col)
+		}
+	}
+	return open
+}
+
+// isLocked reports whether a LOCK_COLUMN twist keeps pieces out of the
+// column of coord. Callers hold p.mu.
+func (p *Power) isLocked(coord Coordinate) bool {
+	return p.lockedUntil > 0 && (p.Gravity == DOWN || p.Gravity == UP) && coord.Column == p.lockedColumn
+}
+
+// LastTwist returns the twist that happened after the last move, if any
+func (p *Power) LastTwist() (TwistEvent, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.lastTwist == nil {
+		return TwistEvent{}, false
+	}
+	return *p.lastTwist, true
+}
+
+// LockedColumn returns the column closed by a LOCK_COLUMN twist, if any
+func (p *Power) LockedColumn() (int, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.lockedColumn, p.lockedUntil > 0
+}
+
+func (twist Twist) String() string {
+	switch twist {
+	case FLIP_GRAVITY:
+		return "Flip gravity"
+	case ROTATE_BOARD:
+		return "Rotate board"
+	case LOCK_COLUMN:
+		return "Lock column"
+	case SWAP_COLORS:
+		return "Swap colors"
+	case ROTATE_QUARTER:
+		return "Quarter turn"
+	default:
+		return "Unknown"
+	}
+}
@@ -0,0 +1,172 @@
+package shared
+
+import (
+	"errors"
+	"testing"
+)
+
+// twistGame starts a 6x7 game with a single twist every interval turns
+func twistGame(twist Twist, interval int) *Power {
+	return NewGameInstance(GameSettings{Rows: 6, Columns: 7, Twists: TwistSchedule{Twists: []Twist{twist}, Interval: interval}})
+}
+
+func TestTwistFlipGravity(t *testing.T) {
+	p := twistGame(FLIP_GRAVITY, 2)
+	p.MakeMove(Coordinate{Column: 0})
+	if _, ok := p.LastTwist(); ok || p.GetGravity() != DOWN {
+		t.Fatal("expected no twist after the first turn")
+	}
+
+	p.MakeMove(Coordinate{Column: 1})
+	if event, ok := p.LastTwist(); !ok || event.Twist != FLIP_GRAVITY || event.Turn != 2 || p.GetGravity() != UP {
+		t.Fatalf("expected the gravity to flip after turn 2, got %v and gravity %v", event, p.GetGravity())
+	}
+	if p.Board[5][0] != 'B' {
+		t.Fatal("expected the pieces to stay where they are")
+	}
+
+	p.Undo()
+	if _, ok := p.LastTwist(); ok || p.GetGravity() != DOWN {
+		t.Fatal("undo should take the flip back")
+	}
+}
+
+func TestTwistRotateBoard(t *testing.T) {
+	p := twistGame(ROTATE_BOARD, 3)
+	for _, col := range []int{0, 0, 1} {
+		p.MakeMove(Coordinate{Column: col})
+	}
+
+	// Upside down, column 0 becomes column 6 and falls back red first
+	if p.Board[5][6] != 'R' || p.Board[4][6] != 'B' || p.Board[5][5] != 'B' || p.Board[5][0] != 0 {
+		t.Fatalf("expected the rotated pieces to fall back, got %q", p.Board)
+	}
+}
+
+func TestTwistRotateBoardLines(t *testing.T) {
+	p := twistGame(ROTATE_BOARD, 5)
+
+	// Once upside down and settled, blue lines up on the bottom row
+	for col, stack := range []string{"B", "RB", "RRB", "RB"} {
+		for i, piece := range stack {
+			p.Board[5-i][col] = piece
+		}
+	}
+	p.turns = 4
+	p.IsPlaying = RED
+
+	p.MakeMove(Coordinate{Column: 6})
+	if !hasWon(p, BLUE) {
+		t.Fatalf("expected blue to win once the board turned, got %v on %q", p.GetGameState(), p.Board)
+	}
+}
+
+func TestTwistLockColumn(t *testing.T) {
+	p := twistGame(LOCK_COLUMN, 2)
+	p.MakeMove(Coordinate{Column: 0})
+	p.MakeMove(Coordinate{Column: 0})
+
+	col, ok := p.LockedColumn()
+	if !ok {
+		t.Fatal("expected a column to be locked after turn 2")
+	}
+	if _, err := p.MakeMove(Coordinate{Column: col}); !errors.Is(err, ErrColumnLocked) {
+		t.Fatalf("expected ErrColumnLocked, got %v", err)
+	}
+	if moves := p.LegalMoves(); len(moves) != 6 {
+		t.Fatalf("expected 6 legal moves, got %d", len(moves))
+	}
+
+	// The lock lasts one round
+	p.MakeMove(Coordinate{Column: (col + 1) % 7})
+	if _, ok := p.LockedColumn(); !ok {
+		t.Fatal("expected the column to stay locked until the round is over")
+	}
+	p.Settings.Twists.Interval = 100
+	p.MakeMove(Coordinate{Column: (col + 1) % 7})
+	if _, ok := p.LockedColumn(); ok {
+		t.Fatal("expected the column to open again after a round")
+	}
+}
+
+func TestTwistSwapColors(t *testing.T) {
+	p := twistGame(SWAP_COLORS, 1)
+	p.MakeMove(Coordinate{Column: 0})
+	if p.Board[5][0] != 'R' || p.GetCurrentPlayer() != RED {
+		t.Fatalf("expected blue's piece to turn red, got %q", p.Board[5][0])
+	}
+}
+
+func TestTwistSchedule(t *testing.T) {
+	settings := GameSettings{Rows: 6, Columns: 7, Twists: TwistSchedule{
+		Twists:      []Twist{FLIP_GRAVITY, SWAP_COLORS},
+		Probability: 0.5,
+		Seed:        7,
+	}}
+
+	// The same seed gives the same twists
+	first, second := NewGameInstance(settings), NewGameInstance(settings)
+	twists := 0
+	for i := 0; i < 10; i++ {
+		first.MakeMove(Coordinate{Column: i % 7})
+		second.MakeMove(Coordinate{Column: i % 7})
+		a, okA := first.LastTwist()
+		b, okB := second.LastTwist()
+		if a != b || okA != okB {
+			t.Fatalf("turn %d: got twists %v and %v", i+1, a, b)
+		}
+		if okA {
+			twists++
+		}
+	}
+	if twists == 0 || twists == 10 {
+		t.Fatalf("expected some turns out of 10 to twist, got %d", twists)
+	}
+
+	for _, schedule := range []TwistSchedule{
+		{Twists: []Twist{FLIP_GRAVITY}},
+		{Twists: []Twist{Twist(9)}, Interval: 5},
+		{Twists: []Twist{FLIP_GRAVITY}, Probability: 2},
+		{Twists: []Twist{FLIP_GRAVITY}, Interval: -1},
+	} {
+		settings.Twists = schedule
+		if err := settings.Validate(); !errors.Is(err, ErrInvalidTwists) {
+			t.Errorf("expected ErrInvalidTwists for %+v, got %v", schedule, err)
+		}
+	}
+}
+
+func TestTwistRotateQuarter(t *testing.T) {
+	p := twistGame(ROTATE_QUARTER, 3)
+	for _, col := range []int{0, 0, 1} {
+		p.MakeMove(Coordinate{Column: col})
+	}
+
+	// The bottom row becomes the left column, then the pieces fall
+	settings := p.GetSettings()
+	if settings.Rows != 7 || settings.Columns != 6 || len(p.GetBoard()) != 7 || len(p.GetBoard()[0]) != 6 {
+		t.Fatalf("expected a 7x6 board after a quarter turn, got %dx%d", settings.Rows, settings.Columns)
+	}
+	if p.Board[6][0] != 'B' || p.Board[5][0] != 'B' || p.Board[6][1] != 'R' {
+		t.Fatalf("expected the turned pieces to fall, got %q", p.Board)
+	}
+	if placed, err := p.MakeMove(Coordinate{Column: 5}); err != nil || placed.Row != 6 {
+		t.Fatalf("expected a drop in the last column to land on row 6, got %v, %v", placed, err)
+	}
+
+	p.Undo()
+	p.Undo()
+	if settings := p.GetSettings(); settings.Rows != 6 || settings.Columns != 7 || p.Board[4][0] != 'R' || p.Board[5][1] != 0 {
+		t.Fatalf("undo should turn the board back, got %dx%d", settings.Rows, settings.Columns)
+	}
+	p.Redo()
+	p.ResetGame()
+	if settings := p.GetSettings(); settings.Rows != 6 || settings.Columns != 7 || len(p.Board) != 6 {
+		t.Fatalf("reset should restore the board size, got %dx%d", settings.Rows, settings.Columns)
+	}
+
+	cylinder := GameSettings{Rows: 6, Columns: 7, Topology: CYLINDER, Twists: TwistSchedule{Twists: []Twist{ROTATE_QUARTER}, Interval: 3}}
+	if err := cylinder.Validate(); !errors.Is(err, ErrCylinderQuarterTurn) {
+		t.Errorf("expected ErrCylinderQuarterTurn for a turning cylinder, got %v", err)
+	}
+}
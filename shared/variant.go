@@ -0,0 +1,459 @@
+package shared
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+)
+
+// DefaultVariant is the rule set used when GameSettings.Variant is empty
+const DefaultVariant = "classic"
+
+// ErrMoveNotAllowed is returned for a kind of move the variant does not have
+var ErrMoveNotAllowed = errors.New("move is not allowed by these rules")
+
+// Variant is a rule set played on a Power. The game calls its hooks with
+// its lock held: Start when a game is created or reset, then for every move
+// CheckMove, Apply, Outcome and, while the game goes on, AfterTurn once the
+// turn has passed. Hooks must only touch the game through the Position they
+// are given.
+type Variant interface {
+	// Name is the key the variant is registered and selected under
+	Name() string
+	// Description is a short sentence shown to players
+	Description() string
+	// Start prepares a new game before its first move
+	Start(pos *Position)
+	// LegalMoves lists the moves the player to move can make
+	LegalMoves(pos *Position) []Action
+	// CheckMove returns why a move is illegal, or nil
+	CheckMove(pos *Position, action Action) error
+	// Apply plays a move accepted by CheckMove for the player to move and
+	// returns the cell it changed
+	Apply(pos *Position, action Action) Coordinate
+	// Outcome returns the game state once move has been applied. The player
+	// to move is still the one who made it.
+	Outcome(pos *Position, move Move) GameState
+	// AfterTurn runs after every move that leaves the game ongoing
+	AfterTurn(pos *Position)
+}
+
+// PlayerLimit is implemented by variants that cannot be played by up to
+// MaxPlayers players
+type PlayerLimit interface {
+	// MaxPlayers is the largest number of players the variant supports
+	MaxPlayers() int
+}
+
+// FlipSettler is implemented by variants whose pieces fall to the new floor
+// whenever the gravity inverts, FLIP_GRAVITY twists included
+type FlipSettler interface {
+	// SettleOnFlip moves the pieces once the gravity has inverted and
+	// returns the game state. mover is the player who made the last move.
+	SettleOnFlip(pos *Position, mover Player) GameState
+}
+
+// Position gives a Variant access to a game while its hooks run. It is only
+// valid during the hook call.
+type Position struct {
+	p *Power
+}
+
+// position returns the view handed to variant hooks. Callers hold p.mu.
+func (p *Power) position() *Position {
+	return &Position{p: p}
+}
+
+// Settings returns the settings of the game
+func (pos *Position) Settings() GameSettings {
+	return pos.p.Settings
+}
+
+// Cell returns the piece in a cell, 0 when it is empty
+func (pos *Position) Cell(row, col int) rune {
+	return pos.p.Board[row][col]
+}
+
+// SetCell puts a piece in a cell, 0 to empty it
+func (pos *Position) SetCell(row, col int, piece rune) {
+	pos.p.Board[row][col] = piece
+}
+
+// CurrentPlayer returns the player whose turn it is
+func (pos *Position) CurrentPlayer() Player {
+	return pos.p.IsPlaying
+}
+
+// NextPlayer returns the player who plays after player
+func (pos *Position) NextPlayer(player Player) Player {
+	return pos.p.nextPlayer(player)
+}
+
+// Win makes player the winner and returns the state to report from Outcome
+func (pos *Position) Win(player Player) GameState {
+	pos.p.winner = player
+	return WON
+}
+
+// Turns returns the number of moves played, including the current one once
+// it has been applied
+func (pos *Position) Turns() int {
+	return pos.p.turns
+}
+
+// Gravity returns the direction pieces fall in
+func (pos *Position) Gravity() Gravity {
+	return pos.p.Gravity
+}
+
+// SetGravity changes the direction the next pieces fall in
+func (pos *Position) SetGravity(gravity Gravity) {
+	pos.p.Gravity = gravity
+}
+
+// Phase returns the stage of the game
+func (pos *Position) Phase() Phase {
+	return pos.p.phase
+}
+
+// SetPhase moves the game to another stage
+func (pos *Position) SetPhase(phase Phase) {
+	pos.p.phase = phase
+}
+
+// Captured returns how many pieces a player has taken off the board
+func (pos *Position) Captured(player Player) int {
+	return pos.p.captured[player]
+}
+
+// Capture counts one more piece taken off the board by player
+func (pos *Position) Capture(player Player) {
+	pos.p.captured[player]++
+}
+
+// KeepTurn makes the player who is moving play again. Only meaningful from
+// Outcome.
+func (pos *Position) KeepTurn() {
+	pos.p.keepTurn = true
+}
+
+// Lane returns the cells of the column of coord (or its row, when pieces
+// fall sideways), starting from the gravity edge
+func (pos *Position) Lane(coord Coordinate) ([]Coordinate, error) {
+	return pos.p.lane(coord)
+}
+
+// Landing returns the cell where a piece played in coord comes to rest under
+// the current gravity, or why it cannot be played
+func (pos *Position) Landing(coord Coordinate) (Coordinate, error) {
+	if pos.p.isLocked(coord) {
+		return Coordinate{}, ErrColumnLocked
+	}
+	row, col, err := pos.p.landing(coord)
+	return Coordinate{Column: col, Row: row}, err
+}
+
+// CompletesLine reports whether the piece in cell is part of a line of at
+// least WinLength pieces, and marks the winning cells if so
+func (pos *Position) CompletesLine(cell Coordinate) bool {
+	return pos.p.checkVictory(cell.Row, cell.Column)
+}
+
+// LineCells returns every cell of the lines of at least WinLength pieces
+// through cell, without marking them, or nil when there is none
+func (pos *Position) LineCells(cell Coordinate) []Coordinate {
+	return pos.p.winningLine(cell.Row, cell.Column)
+}
+
+// SetWinningCells marks the cells of the winning line(s), ignoring duplicates
+func (pos *Position) SetWinningCells(cells []Coordinate) {
+	seen := make(map[Coordinate]bool, len(cells))
+	pos.p.winningCells = nil
+	for _, cell := range cells {
+		if !seen[cell] {
+			seen[cell] = true
+			pos.p.winningCells = append(pos.p.winningCells, cell)
+		}
+	}
+}
+
+// Repetitions counts how often the position reached by the move being
+// played (same board, next player to move) occurred earlier in the game
+func (pos *Position) Repetitions() int {
+	return pos.p.repetitions()
+}
+
+// IsFull reports whether every cell of the board holds a piece
+func (pos *Position) IsFull() bool {
+	return pos.p.isBoardFull()
+}
+
+// Classic is the standard rule set: pieces fall with the gravity, two
+// players alternate and the first line of WinLength pieces wins. Other
+// variants embed it and override the hooks they change.
+type Classic struct{}
+
+func (Classic) Name() string {
+	return DefaultVariant
+}
+
+func (Classic) Description() string {
+	return "Standard rules: line up pieces to win."
+}
+
+// LegalMoves lists a drop in every column (or row, when pieces fall
+// sideways, or cell without gravity) with room
+func (Classic) LegalMoves(pos *Position) []Action {
+	var moves []Action
+	for _, lane := range Lanes(pos) {
+		if _, err := pos.Landing(lane); err == nil {
+			moves = append(moves, Action{Kind: DROP, Coordinate: lane})
+		}
+	}
+	return moves
+}
+
+func (Classic) Start(pos *Position) {}
+
+func (Classic) CheckMove(pos *Position, action Action) error {
+	if action.Kind != DROP {
+		return ErrMoveNotAllowed
+	}
+	_, err := pos.Landing(action.Coordinate)
+	return err
+}
+
+func (Classic) Apply(pos *Position, action Action) Coordinate {
+	cell, _ := pos.Landing(action.Coordinate)
+	pos.SetCell(cell.Row, cell.Column, pos.CurrentPlayer().Piece())
+	return cell
+}
+
+// Outcome gives the win to the player who completed a line and calls a draw
+// once the board is full
+func (Classic) Outcome(pos *Position, move Move) GameState {
+	if pos.CompletesLine(move.Coordinate) {
+		return pos.Win(pos.CurrentPlayer())
+	}
+	if pos.IsFull() {
+		return DRAW
+	}
+	return ONGOING
+}
+
+func (Classic) AfterTurn(pos *Position) {}
+
+// Lanes returns one coordinate per column, or per row when pieces fall
+// sideways, to play a move in. Without gravity every cell is a lane.
+func Lanes(pos *Position) []Coordinate {
+	settings := pos.Settings()
+	if pos.Gravity() == NONE {
+		lanes := make([]Coordinate, 0, settings.Rows*settings.Columns)
+		for row := 0; row < settings.Rows; row++ {
+			for col := 0; col < settings.Columns; col++ {
+				lanes = append(lanes, Coordinate{Column: col, Row: row})
+			}
+		}
+		return lanes
+	}
+	if pos.Gravity() == LEFT || pos.Gravity() == RIGHT {
+		lanes := make([]Coordinate, settings.Rows)
+		for row := range lanes {
+			lanes[row] = Coordinate{Row: row}
+		}
+		return lanes
+	}
+
+	lanes := make([]Coordinate, settings.Columns)
+	for col := range lanes {
+		lanes[col] = Coordinate{Column: col}
+	}
+	return lanes
+}
+
+// GravityFlip plays the classic rules but inverts the gravity (DOWN and UP,
+// LEFT and RIGHT) every Interval turns. A game without gravity is left
+// alone, and a game whose twist schedule has FLIP_GRAVITY leaves the flips
+// to the twists.
+type GravityFlip struct {
+	Classic
+	Interval int
+}
+
+func (GravityFlip) Name() string {
+	return "gravity-flip"
+}
+
+func (v GravityFlip) Description() string {
+	return fmt.Sprintf("Every %d turns, gravity inverts!", v.Interval)
+}
+
+func (v GravityFlip) AfterTurn(pos *Position) {
+	v.flip(pos)
+}
+
+// flip inverts the gravity when the variant's schedule calls for it and
+// reports whether it did
+func (v GravityFlip) flip(pos *Position) bool {
+	if v.Interval <= 0 || pos.Gravity() == NONE {
+		return false
+	}
+	if slices.Contains(pos.Settings().Twists.Twists, FLIP_GRAVITY) {
+		return false
+	}
+	schedule := TwistSchedule{Twists: []Twist{FLIP_GRAVITY}, Interval: v.Interval}
+	if _, _, ok := schedule.due(pos.Turns()); !ok {
+		return false
+	}
+	pos.SetGravity(pos.Gravity().opposite())
+	return true
+}
+
+// GravitySettle is GravityFlip with physical gravity: when the gravity
+// inverts, every piece falls to the new floor. Lines formed by the fall
+// count for every player; when several players line up at once, the one
+// who made the move wins, then the next in turn order.
+type GravitySettle struct {
+	GravityFlip
+}
+
+func (GravitySettle) Name() string {
+	return "gravity-settle"
+}
+
+func (v GravitySettle) Description() string {
+	return fmt.Sprintf("Every %d turns, gravity inverts and every piece falls to the other side!", v.Interval)
+}
+
+// Outcome checks the move as the classic rules do, then flips the gravity
+// when it is due and looks for lines once the pieces have settled
+func (v GravitySettle) Outcome(pos *Position, move Move) GameState {
+	mover := pos.CurrentPlayer()
+	if pos.CompletesLine(move.Coordinate) {
+		return pos.Win(mover)
+	}
+
+	if v.flip(pos) {
+		settle(pos)
+		if state := lineAnywhere(pos, mover); state != ONGOING {
+			return state
+		}
+	}
+
+	if pos.IsFull() {
+		return DRAW
+	}
+	return ONGOING
+}
+
+// AfterTurn does nothing: the gravity already flipped in Outcome
+func (GravitySettle) AfterTurn(pos *Position) {}
+
+// SettleOnFlip lets the pieces fall after a FLIP_GRAVITY twist, as they do
+// after the variant's own flips
+func (GravitySettle) SettleOnFlip(pos *Position, mover Player) GameState {
+	settle(pos)
+	return lineAnywhere(pos, mover)
+}
+
+// lineAnywhere looks for lines all over the board once pieces have moved.
+// The first player with a line wins, starting from first in turn order.
+func lineAnywhere(pos *Position, first Player) GameState {
+	lines := make(map[rune][]Coordinate)
+	settings := pos.Settings()
+	for row := 0; row < settings.Rows; row++ {
+		for col := 0; col < settings.Columns; col++ {
+			if piece := pos.Cell(row, col); piece != 0 && piece != Blocker {
+				lines[piece] = append(lines[piece], pos.LineCells(Coordinate{Column: col, Row: row})...)
+			}
+		}
+	}
+
+	player := first
+	for range settings.players() {
+		if won := lines[player.Piece()]; len(won) > 0 {
+			pos.SetWinningCells(won)
+			return pos.Win(player)
+		}
+		player = pos.NextPlayer(player)
+	}
+	return ONGOING
+}
+
+// settle lets every piece fall to the gravity edge of its lane. Blockers
+// stay where they are and the pieces above them come to rest on them.
+func settle(pos *Position) {
+	for _, start := range Lanes(pos) {
+		cells, _ := pos.Lane(start)
+		floor := 0
+		for i, cell := range cells {
+			switch piece := pos.Cell(cell.Row, cell.Column); piece {
+			case 0:
+			case Blocker:
+				floor = i + 1
+			default:
+				pos.SetCell(cell.Row, cell.Column, 0)
+				pos.SetCell(cells[floor].Row, cells[floor].Column, piece)
+				floor++
+			}
+		}
+	}
+}
+
+var (
+	variantsMu sync.RWMutex
+	variants   = make(map[string]Variant)
+)
+
+func init() {
+	RegisterVariant(Classic{})
+	RegisterVariant(GravityFlip{Interval: 5})
+	RegisterVariant(GravitySettle{GravityFlip{Interval: 5}})
+	RegisterVariant(PopOut{})
+	RegisterVariant(Pop10{Goal: 10})
+}
+
+// RegisterVariant makes a rule set available by name. It panics if the name
+// is empty or already taken.
+func RegisterVariant(v Variant) {
+	variantsMu.Lock()
+	defer variantsMu.Unlock()
+
+	name := v.Name()
+	if name == "" {
+		panic("shared: RegisterVariant with an empty name")
+	}
+	if _, taken := variants[name]; taken {
+		panic("shared: RegisterVariant called twice for " + name)
+	}
+	variants[name] = v
+}
+
+// LookupVariant returns the rule set registered under name, the classic one
+// for an empty name
+func LookupVariant(name string) (Variant, bool) {
+	if name == "" {
+		name = DefaultVariant
+	}
+
+	variantsMu.RLock()
+	defer variantsMu.RUnlock()
+
+	v, ok := variants[name]
+	return v, ok
+}
+
+// Variants returns every registered rule set, sorted by name
+func Variants() []Variant {
+	variantsMu.RLock()
+	defer variantsMu.RUnlock()
+
+	list := make([]Variant, 0, len(variants))
+	for _, v := range variants {
+		list = append(list, v)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name() < list[j].Name() })
+	return list
+}
@@ -0,0 +1,127 @@
+package shared
+
+import (
+	"errors"
+	"testing"
+)
+
+// cornerRule is a test variant that plays the classic rules but also lets a
+// piece in a corner win
+type cornerRule struct {
+	Classic
+}
+
+func (cornerRule) Name() string {
+	return "test-corner"
+}
+
+func (v cornerRule) Outcome(pos *Position, move Move) GameState {
+	settings := pos.Settings()
+	if (move.Row == 0 || move.Row == settings.Rows-1) && (move.Column == 0 || move.Column == settings.Columns-1) {
+		return pos.Win(pos.CurrentPlayer())
+	}
+	return v.Classic.Outcome(pos, move)
+}
+
+func TestRegisteredVariant(t *testing.T) {
+	if _, ok := LookupVariant("test-corner"); !ok {
+		RegisterVariant(cornerRule{})
+	}
+
+	settings := GameSettings{Rows: 6, Columns: 7, Variant: "test-corner"}
+	if err := settings.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	p := NewGameInstance(settings)
+	p.MakeMove(Coordinate{Column: 3})
+	p.MakeMove(Coordinate{Column: 6})
+	if !hasWon(p, RED) {
+		t.Fatalf("expected the corner move to win, got %v", p.GetGameState())
+	}
+
+	if err := (GameSettings{Rows: 6, Columns: 7, Variant: "nope"}).Validate(); !errors.Is(err, ErrInvalidSettings) {
+		t.Errorf("expected ErrInvalidSettings for an unknown variant, got %v", err)
+	}
+}
+
+func TestGravityFlipVariant(t *testing.T) {
+	p := NewGameInstance(GameSettings{Rows: 6, Columns: 7, Variant: "gravity-flip"})
+	for i := 0; i < 5; i++ {
+		p.MakeMove(Coordinate{Column: i})
+	}
+	if p.GetGravity() != UP || p.Turns() != 5 {
+		t.Fatalf("expected gravity UP after 5 turns, got %v after %d", p.GetGravity(), p.Turns())
+	}
+	if placed, _ := p.MakeMove(Coordinate{Column: 0}); placed.Row != 0 {
+		t.Fatalf("expected the sixth piece to stack from the top, got row %d", placed.Row)
+	}
+
+	p.Undo()
+	p.Undo()
+	if p.GetGravity() != DOWN || p.Turns() != 4 {
+		t.Fatalf("undo should restore gravity DOWN and 4 turns, got %v and %d", p.GetGravity(), p.Turns())
+	}
+	p.Redo()
+	if p.GetGravity() != UP || p.Turns() != 5 {
+		t.Fatalf("redo should restore gravity UP and 5 turns, got %v and %d", p.GetGravity(), p.Turns())
+	}
+}
+
+func TestGravitySettleVariant(t *testing.T) {
+	p := NewGameInstance(GameSettings{Rows: 6, Columns: 7, Variant: "gravity-settle"})
+	for _, col := range []int{0, 1, 0, 1, 0} {
+		p.MakeMove(Coordinate{Column: col})
+	}
+	if p.GetGravity() != UP {
+		t.Fatalf("expected gravity UP after 5 turns, got %v", p.GetGravity())
+	}
+	if p.Board[0][0] != 'B' || p.Board[2][0] != 'B' || p.Board[5][0] != 0 || p.Board[1][1] != 'R' {
+		t.Fatalf("expected the pieces to fall to the top, got %q", p.Board)
+	}
+	p.Undo()
+	if p.Board[5][0] != 'B' || p.Board[0][0] != 0 {
+		t.Fatalf("undo should put the pieces back, got %q", p.Board)
+	}
+}
+
+func TestGravitySettleFlipTwist(t *testing.T) {
+	p := NewGameInstance(GameSettings{
+		Rows:    6,
+		Columns: 7,
+		Variant: "gravity-settle",
+		Twists:  TwistSchedule{Twists: []Twist{FLIP_GRAVITY}, Interval: 5, Seed: 1},
+	})
+
+	// The twist flips the gravity once and the pieces fall with it
+	for _, col := range []int{0, 1, 0, 1, 0, 2} {
+		p.MakeMove(Coordinate{Column: col})
+	}
+	if p.GetGravity() != UP {
+		t.Fatalf("expected gravity UP after the twist, got %v", p.GetGravity())
+	}
+	if p.Board[0][0] != 'B' || p.Board[2][0] != 'B' || p.Board[5][0] != 0 || p.Board[0][2] != 'R' {
+		t.Fatalf("expected the pieces to fall to the top, got %q", p.Board)
+	}
+}
+
+func TestGravitySettleSimultaneousLines(t *testing.T) {
+	p := NewGameInstance(GameSettings{Rows: 6, Columns: 7, Variant: "gravity-settle"})
+
+	// Once the columns fall to the top, blue lines up on row 0 and red on
+	// row 1
+	for col, stack := range []string{"RB", "BRB", "RB", "RRB"} {
+		for i, piece := range stack {
+			p.Board[5-i][col] = piece
+		}
+	}
+	p.turns = 4
+	p.IsPlaying = RED
+
+	p.MakeMove(Coordinate{Column: 6})
+	if !hasWon(p, RED) {
+		t.Fatalf("expected red, who moved, to win the tie, got %v on %q", p.GetGameState(), p.Board)
+	}
+	if len(p.WinningCells()) != 4 || p.WinningCells()[0].Row != 1 {
+		t.Fatalf("expected red's line on row 1 to be marked, got %v", p.WinningCells())
+	}
+}
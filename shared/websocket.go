@@ -0,0 +1,333 @@
+package shared
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// websocketGUID is appended to the client key to build the accept key
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// MaxWebSocketMessage is the largest message a WebSocket accepts
+const MaxWebSocketMessage = 64 << 10
+
+// websocketWriteTimeout bounds the time spent writing one frame
+const websocketWriteTimeout = 10 * time.Second
+
+// WebSocket frame opcodes
+const (
+	opContinuation = 0x0
+	opText         = 0x1
+	opBinary       = 0x2
+	opClose        = 0x8
+	opPing         = 0x9
+	opPong         = 0xA
+)
+
+// Errors returned by WebSocket methods
+var (
+	ErrWebSocketHandshake = errors.New("websocket: bad handshake")
+	ErrWebSocketProtocol  = errors.New("websocket: protocol error")
+	ErrWebSocketTooLarge  = errors.New("websocket: message too large")
+)
+
+// WebSocket is a WebSocket connection (RFC 6455) exchanging whole messages.
+// Pings are answered while reading. A WebSocket is safe for one reader and
+// any number of concurrent writers.
+type WebSocket struct {
+	conn    net.Conn
+	reader  *bufio.Reader
+	client  bool // Client frames are masked, server frames are not
+	writeMu sync.Mutex
+	closed  bool // A close frame was sent, guarded by writeMu
+}
+
+// UpgradeWebSocket answers a WebSocket handshake and takes over the
+// connection. On failure the HTTP error has already been written. Browsers
+// send an Origin header; it must match the requested host so other sites
+// cannot drive a player's session.
+func UpgradeWebSocket(w http.ResponseWriter, r *http.Request) (*WebSocket, error) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return nil, ErrWebSocketHandshake
+	}
+	if !headerHasToken(r.Header, "Connection", "upgrade") || !headerHasToken(r.Header, "Upgrade", "websocket") {
+		http.Error(w, "WebSocket upgrade required", http.StatusBadRequest)
+		return nil, ErrWebSocketHandshake
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, "Unsupported WebSocket version", http.StatusUpgradeRequired)
+		return nil, ErrWebSocketHandshake
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if decoded, err := base64.StdEncoding.DecodeString(key); err != nil || len(decoded) != 16 {
+		http.Error(w, "Invalid WebSocket key", http.StatusBadRequest)
+		return nil, ErrWebSocketHandshake
+	}
+	if origin := r.Header.Get("Origin"); origin != "" {
+		if u, err := url.Parse(origin); err != nil || !strings.EqualFold(u.Host, r.Host) {
+			http.Error(w, "Cross-origin WebSocket refused", http.StatusForbidden)
+			return nil, ErrWebSocketHandshake
+		}
+	}
+
+	conn, rw, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		http.Error(w, "WebSocket not supported", http.StatusInternalServerError)
+		return nil, err
+	}
+	fmt.Fprintf(rw, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: %s\r\n\r\n", acceptKey(key))
+	if err := rw.Flush(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{})
+	return &WebSocket{conn: conn, reader: rw.Reader}, nil
+}
+
+// DialWebSocket opens a client WebSocket to a ws:// URL, sending header
+// (cookies, Origin) with the handshake
+func DialWebSocket(rawURL string, header http.Header) (*WebSocket, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "ws" {
+		return nil, fmt.Errorf("%w: unsupported scheme %q", ErrWebSocketHandshake, u.Scheme)
+	}
+	conn, err := net.Dial("tcp", u.Host)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := make([]byte, 16)
+	rand.Read(buf)
+	key := base64.StdEncoding.EncodeToString(buf)
+	req := &http.Request{Method: http.MethodGet, URL: u, Host: u.Host, Header: http.Header{}}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	req.Header.Set("Sec-WebSocket-Key", key)
+	if err := req.Write(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, req)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols || resp.Header.Get("Sec-WebSocket-Accept") != acceptKey(key) {
+		conn.Close()
+		return nil, fmt.Errorf("%w: status %s", ErrWebSocketHandshake, resp.Status)
+	}
+	return &WebSocket{conn: conn, reader: reader, client: true}, nil
+}
+
+// acceptKey derives the Sec-WebSocket-Accept value from the client key
+func acceptKey(key string) string {
+	sum := sha1.Sum([]byte(key + websocketGUID))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// headerHasToken reports whether a comma-separated header lists token
+func headerHasToken(header http.Header, name, token string) bool {
+	for _, value := range header.Values(name) {
+		for _, part := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(part), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ReadMessage returns the next text or binary message. It returns io.EOF
+// once the peer closed the connection.
+func (ws *WebSocket) ReadMessage() ([]byte, error) {
+	var message []byte
+	started := false
+	for {
+		fin, opcode, payload, err := ws.readFrame()
+		if err != nil {
+			if errors.Is(err, ErrWebSocketProtocol) || errors.Is(err, ErrWebSocketTooLarge) {
+				ws.closeWith(1002)
+			}
+			return nil, err
+		}
+
+		switch opcode {
+		case opPing:
+			if err := ws.writeFrame(opPong, payload); err != nil {
+				return nil, err
+			}
+			continue
+		case opPong:
+			continue
+		case opClose:
+			ws.closeWith(1000)
+			return nil, io.EOF
+		case opText, opBinary:
+			if started {
+				ws.closeWith(1002)
+				return nil, ErrWebSocketProtocol
+			}
+			started = true
+		case opContinuation:
+			if !started {
+				ws.closeWith(1002)
+				return nil, ErrWebSocketProtocol
+			}
+		default:
+			ws.closeWith(1002)
+			return nil, ErrWebSocketProtocol
+		}
+
+		if len(message)+len(payload) > MaxWebSocketMessage {
+			ws.closeWith(1009)
+			return nil, ErrWebSocketTooLarge
+		}
+		message = append(message, payload...)
+		if fin {
+			return message, nil
+		}
+	}
+}
+
+// readFrame reads one frame and unmasks its payload
+func (ws *WebSocket) readFrame() (fin bool, opcode byte, payload []byte, err error) {
+	var head [2]byte
+	if _, err := io.ReadFull(ws.reader, head[:]); err != nil {
+		return false, 0, nil, err
+	}
+	fin = head[0]&0x80 != 0
+	opcode = head[0] & 0x0F
+	if head[0]&0x70 != 0 {
+		return false, 0, nil, ErrWebSocketProtocol
+	}
+
+	// Clients must mask their frames, servers must not
+	masked := head[1]&0x80 != 0
+	if masked == ws.client {
+		return false, 0, nil, ErrWebSocketProtocol
+	}
+
+	length := uint64(head[1] & 0x7F)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(ws.reader, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(ws.reader, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+	if opcode >= opClose && (!fin || length > 125) {
+		return false, 0, nil, ErrWebSocketProtocol
+	}
+	if length > MaxWebSocketMessage {
+		return false, 0, nil, ErrWebSocketTooLarge
+	}
+
+	var mask [4]byte
+	if masked {
+		if _, err := io.ReadFull(ws.reader, mask[:]); err != nil {
+			return false, 0, nil, err
+		}
+	}
+	payload = make([]byte, length)
+	if _, err := io.ReadFull(ws.reader, payload); err != nil {
+		return false, 0, nil, err
+	}
+	if masked {
+		for i := range payload {
+			payload[i] ^= mask[i%4]
+		}
+	}
+	return fin, opcode, payload, nil
+}
+
+// WriteMessage sends a text message
+func (ws *WebSocket) WriteMessage(data []byte) error {
+	return ws.writeFrame(opText, data)
+}
+
+// writeFrame sends a single, final frame
+func (ws *WebSocket) writeFrame(opcode byte, payload []byte) error {
+	ws.writeMu.Lock()
+	defer ws.writeMu.Unlock()
+
+	if ws.closed {
+		return net.ErrClosed
+	}
+	if opcode == opClose {
+		ws.closed = true
+	}
+
+	frame := []byte{0x80 | opcode}
+	maskBit := byte(0)
+	if ws.client {
+		maskBit = 0x80
+	}
+	switch n := len(payload); {
+	case n <= 125:
+		frame = append(frame, maskBit|byte(n))
+	case n <= 0xFFFF:
+		frame = append(frame, maskBit|126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(n))
+	default:
+		frame = append(frame, maskBit|127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(n))
+	}
+
+	if ws.client {
+		var mask [4]byte
+		rand.Read(mask[:])
+		frame = append(frame, mask[:]...)
+		start := len(frame)
+		frame = append(frame, payload...)
+		for i := range frame[start:] {
+			frame[start+i] ^= mask[i%4]
+		}
+	} else {
+		frame = append(frame, payload...)
+	}
+
+	ws.conn.SetWriteDeadline(time.Now().Add(websocketWriteTimeout))
+	_, err := ws.conn.Write(frame)
+	return err
+}
+
+// closeWith sends a close frame with a status code, if none was sent yet
+func (ws *WebSocket) closeWith(code uint16) {
+	ws.writeFrame(opClose, binary.BigEndian.AppendUint16(nil, code))
+}
+
+// Close says goodbye to the peer and closes the connection
+func (ws *WebSocket) Close() error {
+	ws.closeWith(1000)
+	return ws.conn.Close()
+}
@@ -0,0 +1,108 @@
+package shared
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// echoServer echoes every WebSocket message and reports how the read loop
+// ended
+func echoServer(t *testing.T, done chan<- error) *httptest.Server {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws, err := UpgradeWebSocket(w, r)
+		if err != nil {
+			return
+		}
+		defer ws.Close()
+		for {
+			message, err := ws.ReadMessage()
+			if err != nil {
+				done <- err
+				return
+			}
+			if err := ws.WriteMessage(message); err != nil {
+				done <- err
+				return
+			}
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestWebSocketEcho(t *testing.T) {
+	done := make(chan error, 1)
+	server := echoServer(t, done)
+
+	ws, err := DialWebSocket("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, message := range [][]byte{[]byte("hello"), bytes.Repeat([]byte("x"), 1000), bytes.Repeat([]byte("y"), MaxWebSocketMessage)} {
+		if err := ws.WriteMessage(message); err != nil {
+			t.Fatal(err)
+		}
+		echo, err := ws.ReadMessage()
+		if err != nil || !bytes.Equal(echo, message) {
+			t.Fatalf("expected a %d byte echo, got %d bytes and %v", len(message), len(echo), err)
+		}
+	}
+
+	// A ping is answered without disturbing the messages
+	if err := ws.writeFrame(opPing, []byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+	if _, opcode, payload, err := ws.readFrame(); err != nil || opcode != opPong || string(payload) != "ping" {
+		t.Fatalf("expected a pong, got opcode %d %q and %v", opcode, payload, err)
+	}
+
+	ws.Close()
+	if err := <-done; !errors.Is(err, io.EOF) {
+		t.Fatalf("expected the server to see the close, got %v", err)
+	}
+}
+
+func TestWebSocketTooLarge(t *testing.T) {
+	done := make(chan error, 1)
+	server := echoServer(t, done)
+
+	ws, err := DialWebSocket("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+	ws.WriteMessage(make([]byte, MaxWebSocketMessage+1))
+	if err := <-done; !errors.Is(err, ErrWebSocketTooLarge) {
+		t.Fatalf("expected ErrWebSocketTooLarge, got %v", err)
+	}
+}
+
+func TestWebSocketHandshake(t *testing.T) {
+	server := echoServer(t, make(chan error, 1))
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http")
+
+	if _, err := DialWebSocket(wsURL, http.Header{"Origin": {"http://evil.example"}}); !errors.Is(err, ErrWebSocketHandshake) {
+		t.Fatalf("expected a cross-origin handshake to fail, got %v", err)
+	}
+	ws, err := DialWebSocket(wsURL, http.Header{"Origin": {server.URL}})
+	if err != nil {
+		t.Fatalf("expected a same-origin handshake to succeed, got %v", err)
+	}
+	ws.Close()
+
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("plain GET returned status %d", resp.StatusCode)
+	}
+}